@@ -0,0 +1,131 @@
+// Package conformance runs the CSI conformance suite of the sanity package
+// as ordinary testing.T subtests so that plug-in authors may check their
+// plug-ins with "go test":
+//
+//	func TestConformance(t *testing.T) {
+//	    conformance.TestStoragePlugin(t, provider.New(), conformance.Config{
+//	        Parameters: map[string]string{"tier": "gold"},
+//	    })
+//	}
+//
+// Each test of the suite is a subtest, for example
+// "TestConformance/Controller/CreateVolume/Idempotent", and may be selected
+// with the -run flag. Tests that require a capability the plug-in does not
+// advertise are skipped.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akutz/memconn"
+	"google.golang.org/grpc"
+
+	"github.com/rexray/gocsi"
+	"github.com/rexray/gocsi/sanity"
+)
+
+// Config configures the suite.
+type Config struct {
+	// Parameters are sent with CreateVolume and CreateSnapshot.
+	Parameters map[string]string
+
+	// Secrets are sent with every RPC that accepts secrets.
+	Secrets map[string]string
+
+	// CapacityBytes is the capacity requested for created volumes.
+	// sanity.DefaultCapacityBytes is used if not set.
+	CapacityBytes int64
+
+	// TargetPath returns the target path at which a volume is published.
+	// The returned path's parent directory must exist. If nil, the target
+	// paths are created beneath ScratchDir.
+	TargetPath func(volumeID string) (string, error)
+
+	// ScratchDir is the directory beneath which the staging paths and,
+	// if TargetPath is nil, the target paths are created. The system's
+	// temporary directory is used if empty.
+	ScratchDir string
+
+	// Skip excludes the tests whose names match, for example tests of
+	// behavior the plug-in is known not to conform to.
+	Skip *regexp.Regexp
+
+	// Timeout is the timeout of each RPC. sanity.DefaultTimeout is used
+	// if not set.
+	Timeout time.Duration
+}
+
+// Test runs the suite against the plug-in served by conn. Each test is
+// run as a subtest of t.
+func Test(t *testing.T, conn *grpc.ClientConn, config Config) {
+	ctx := context.Background()
+	suite, err := sanity.NewSuite(ctx, conn, sanity.Config{
+		Parameters:    config.Parameters,
+		Secrets:       config.Secrets,
+		CapacityBytes: config.CapacityBytes,
+		TargetPath:    config.TargetPath,
+		ScratchDir:    config.ScratchDir,
+		Skip:          config.Skip,
+		Timeout:       config.Timeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer suite.Close()
+
+	for _, name := range suite.Tests() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			res := suite.RunTest(ctx, name)
+			for _, l := range res.Output {
+				t.Log(l)
+			}
+			switch {
+			case res.Failed:
+				t.FailNow()
+			case res.Skipped:
+				t.SkipNow()
+			}
+		})
+	}
+}
+
+var listeners uint64
+
+// TestStoragePlugin serves sp in-process and runs the suite against it.
+// Each test is run as a subtest of t. The plug-in is stopped when the
+// suite completes.
+func TestStoragePlugin(
+	t *testing.T,
+	sp gocsi.StoragePluginProvider,
+	config Config) {
+
+	ctx := context.Background()
+	addr := fmt.Sprintf("csi-conformance-%d",
+		atomic.AddUint64(&listeners, 1))
+
+	lis, err := memconn.Listen("memu", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sp.Serve(ctx, lis)
+	defer sp.GracefulStop(ctx)
+
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return memconn.Dial("memu", addr)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	Test(t, conn, config)
+}
@@ -0,0 +1,45 @@
+package conformance_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/rexray/gocsi/conformance"
+	"github.com/rexray/gocsi/mock/provider"
+)
+
+// mockDeviations matches the tests that the mock SP is known to fail.
+var mockDeviations = regexp.MustCompile(
+	`^Controller/(ValidateVolumeCapabilities/NotFound|ListVolumes/InvalidToken)$`)
+
+func TestMock(t *testing.T) {
+	conformance.TestStoragePlugin(t, provider.New(), conformance.Config{
+		Parameters: map[string]string{"tier": "gold"},
+		Skip:       mockDeviations,
+	})
+}
+
+func TestMock_TargetPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	conformance.TestStoragePlugin(t, provider.New(), conformance.Config{
+		TargetPath: func(volumeID string) (string, error) {
+			p := filepath.Join(dir, volumeID, "mnt")
+			paths = append(paths, p)
+			return p, os.MkdirAll(filepath.Dir(p), 0755)
+		},
+		Skip: mockDeviations,
+	})
+
+	if len(paths) == 0 {
+		t.Fatal("target path factory not used")
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var getVolumeCmd = &cobra.Command{
+	Use:     "get-volume",
+	Aliases: []string{"get"},
+	Short:   `invokes the rpc "ControllerGetVolume"`,
+	Example: `
+USAGE
+
+    csc controller get-volume [flags] VOLUME_ID [VOLUME_ID...]
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		req := csi.ControllerGetVolumeRequest{}
+
+		for i := range args {
+			ctx, cancel := context.WithTimeout(root.ctx, root.timeout)
+			defer cancel()
+
+			// Set the volume ID for the current request.
+			req.VolumeId = args[i]
+
+			log.WithField("request", req).Debug("getting volume")
+			rep, err := controller.client.ControllerGetVolume(ctx, &req)
+			if err != nil {
+				return err
+			}
+			if err := root.tpl.Execute(os.Stdout, rep); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	controllerCmd.AddCommand(getVolumeCmd)
+
+	getVolumeCmd.Flags().StringVar(
+		&root.format,
+		"format",
+		"",
+		"The Go template format used to emit the results")
+}
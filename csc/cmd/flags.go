@@ -190,6 +190,17 @@ func flagParameters(fs *flag.FlagSet, addr *mapOfStringArg) {
             --params key1=val1,key2=val2 --params=key3=val3`)
 }
 
+// flagSnapshotIDs adds the --snapshot-id flag to the specified flagset.
+func flagSnapshotIDs(fs *flag.FlagSet, addr *[]string) {
+	fs.StringSliceVar(
+		addr,
+		"snapshot-id",
+		nil,
+		`The IDs of the snapshots that belong to the group snapshot.
+        This flag may be specified more than once or with a
+        comma-separated list`)
+}
+
 // flagStagingTargetPath adds the --staging-target-path flag to the specified
 // flagset.
 func flagStagingTargetPath(fs *flag.FlagSet, addr *string) {
@@ -256,9 +267,29 @@ const flagVolumeCapabilityDescSuffix = `
             --cap 5,1
             --cap MULTI_NODE_MULTI_WRITER,block
 
+        The access modes are:
+
+            1  SINGLE_NODE_WRITER
+            2  SINGLE_NODE_READER_ONLY
+            3  MULTI_NODE_READER_ONLY
+            4  MULTI_NODE_SINGLE_WRITER
+            5  MULTI_NODE_MULTI_WRITER
+            6  SINGLE_NODE_SINGLE_WRITER
+            7  SINGLE_NODE_MULTI_WRITER
+
+        The SINGLE_NODE_SINGLE_WRITER and SINGLE_NODE_MULTI_WRITER modes
+        require the plug-in's SINGLE_NODE_MULTI_WRITER capability.
+
         If the access type specified is "mount" (or its gRPC field value of 2)
         then it's possible to specify a filesystem type and mount flags for
         the volume capability. Multiple mount flags may be specified using
         commas. For example:
 
-            --cap MULTI_NODE_MULTI_WRITER,mount,xfs,uid=500,gid=500`
+            --cap MULTI_NODE_MULTI_WRITER,mount,xfs,uid=500,gid=500
+
+        The mount flag "volume_mount_group" specifies the group with
+        which the volume is published instead of being sent as a mount
+        flag. It requires the plug-in's VOLUME_MOUNT_GROUP capability.
+        For example:
+
+            --cap SINGLE_NODE_WRITER,mount,nfs,volume_mount_group=1000`
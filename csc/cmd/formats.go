@@ -12,6 +12,24 @@ const volumeInfoFormat = `{{printf "%q\t%d" .VolumeId .CapacityBytes}}` +
 const snapshotInfoFormat = `{{printf "%q\t%d\t%s\t%s\t%t\n" ` +
 	`.SnapshotId .SizeBytes .SourceVolumeId .CreationTime .ReadyToUse}}`
 
+// volumeConditionFormat is the default Go template format for emitting
+// the csi.VolumeCondition of a volume status or NodeGetVolumeStatsResponse
+const volumeConditionFormat = `{{with .VolumeCondition}}` +
+	`{{printf "\tabnormal=%t\t%q" .Abnormal .Message}}{{end}}`
+
+// getVolumeFormat is the default Go template format for emitting a
+// ControllerGetVolumeResponse
+const getVolumeFormat = `{{with .Volume}}` +
+	`{{printf "%q\t%d" .VolumeId .CapacityBytes}}{{end}}` +
+	`{{with .Status}}{{printf "\tpublished=%q" .PublishedNodeIds}}` +
+	volumeConditionFormat + `{{end}}{{"\n"}}`
+
+// groupSnapshotFormat is the default Go template format for emitting a
+// csi.VolumeGroupSnapshot followed by its snapshots
+const groupSnapshotFormat = `{{printf "%q\t%s\t%t\n" ` +
+	`.GroupSnapshotId .CreationTime .ReadyToUse}}` +
+	`{{range .Snapshots}}{{"\t"}}` + snapshotInfoFormat + `{{end}}`
+
 // listVolumesFormat is the default Go template format for emitting a
 // ListVolumesResponse
 const listVolumesFormat = `{{range $k, $v := .Entries}}` +
@@ -59,6 +77,8 @@ const probeFormat = `{{printf "%t\n" .Ready.Value}}`
 const statsFormat = `{{printf "%s\t%s\t" .Name .Path}}` +
 	`{{range .Resp.Usage}}` +
 	`{{printf "%d\t%d\t%d\t%s\n" .Available .Total .Used .Unit}}` +
-	`{{end}}`
+	`{{end}}` +
+	`{{with .Resp.VolumeCondition}}` +
+	`{{printf "abnormal=%t\t%q\n" .Abnormal .Message}}{{end}}`
 
 const nodeInfoFormat = `{{printf "%s\t%d\t%#v\n" .NodeId .MaxVolumesPerNode .AccessibleTopology}}`
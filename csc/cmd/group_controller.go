@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/spf13/cobra"
+)
+
+var groupController struct {
+	client csi.GroupControllerClient
+}
+
+// groupControllerCmd represents the group-controller command
+var groupControllerCmd = &cobra.Command{
+	Use:     "group-controller",
+	Aliases: []string{"g", "gc"},
+	Short:   "the csi group controller service rpcs",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if f := cmd.Root().PersistentPreRunE; f != nil {
+			if err := f(cmd, args); err != nil {
+				return err
+			}
+		}
+		groupController.client = csi.NewGroupControllerClient(root.client)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(groupControllerCmd)
+}
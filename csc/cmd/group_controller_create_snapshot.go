@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var createGroupSnapshot struct {
+	sourceVols []string
+	params     mapOfStringArg
+}
+
+var createGroupSnapshotCmd = &cobra.Command{
+	Use:     "create-group-snapshot",
+	Aliases: []string{"create", "s", "snap"},
+	Short:   `invokes the rpc "CreateVolumeGroupSnapshot"`,
+	Example: `
+CREATING A GROUP SNAPSHOT
+        The following example illustrates how to snapshot two volumes
+        together:
+
+            csc group-controller snap --endpoint /csi/server.sock
+                                      --source-volume MyVolume1
+                                      --source-volume MyVolume2
+                                      MyNewGroupSnapshot
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		req := csi.CreateVolumeGroupSnapshotRequest{
+			SourceVolumeIds: createGroupSnapshot.sourceVols,
+			Parameters:      createGroupSnapshot.params.data,
+			Secrets:         root.secrets,
+		}
+
+		for i := range args {
+			ctx, cancel := context.WithTimeout(root.ctx, root.timeout)
+			defer cancel()
+
+			// Set the group snapshot name for the current request.
+			req.Name = args[i]
+			if len(createGroupSnapshot.sourceVols) == 0 {
+				return fmt.Errorf("--source-volume MUST be provided")
+			}
+
+			log.WithField("request", req).Debug("creating group snapshot")
+			rep, err := groupController.client.CreateVolumeGroupSnapshot(
+				ctx, &req)
+			if err != nil {
+				return err
+			}
+			if err := root.tpl.Execute(
+				os.Stdout, rep.GroupSnapshot); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	groupControllerCmd.AddCommand(createGroupSnapshotCmd)
+
+	createGroupSnapshotCmd.Flags().StringSliceVar(
+		&createGroupSnapshot.sourceVols,
+		"source-volume",
+		nil,
+		`The source volumes to snapshot together. This flag may be
+        specified more than once or with a comma-separated list`)
+
+	flagParameters(createGroupSnapshotCmd.Flags(), &createGroupSnapshot.params)
+
+	flagWithRequiresCreds(
+		createGroupSnapshotCmd.Flags(),
+		&root.withRequiresCreds,
+		"")
+}
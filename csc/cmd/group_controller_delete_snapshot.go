@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var deleteGroupSnapshot struct {
+	snapIDs []string
+}
+
+var deleteGroupSnapshotCmd = &cobra.Command{
+	Use:     "delete-group-snapshot",
+	Aliases: []string{"delete", "ds", "delsnap"},
+	Short:   `invokes the rpc "DeleteVolumeGroupSnapshot"`,
+	Example: `
+USAGE
+
+    csc group-controller delete-group-snapshot [flags]
+        --snapshot-id SNAPSHOT_ID [--snapshot-id SNAPSHOT_ID...]
+        GROUP_SNAPSHOT_ID
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ctx, cancel := context.WithTimeout(root.ctx, root.timeout)
+		defer cancel()
+
+		req := csi.DeleteVolumeGroupSnapshotRequest{
+			GroupSnapshotId: args[0],
+			SnapshotIds:     deleteGroupSnapshot.snapIDs,
+			Secrets:         root.secrets,
+		}
+
+		log.WithField("request", req).Debug("deleting group snapshot")
+		_, err := groupController.client.DeleteVolumeGroupSnapshot(ctx, &req)
+		if err != nil {
+			return err
+		}
+		fmt.Println(args[0])
+
+		return nil
+	},
+}
+
+func init() {
+	groupControllerCmd.AddCommand(deleteGroupSnapshotCmd)
+
+	flagSnapshotIDs(deleteGroupSnapshotCmd.Flags(), &deleteGroupSnapshot.snapIDs)
+
+	flagWithRequiresCreds(
+		deleteGroupSnapshotCmd.Flags(),
+		&root.withRequiresCreds,
+		"")
+}
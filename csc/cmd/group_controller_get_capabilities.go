@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var groupControllerGetCapabilitiesCmd = &cobra.Command{
+	Use:     "get-capabilities",
+	Aliases: []string{"capabilities"},
+	Short:   `invokes the rpc "GroupControllerGetCapabilities"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ctx, cancel := context.WithTimeout(root.ctx, root.timeout)
+		defer cancel()
+
+		rep, err := groupController.client.GroupControllerGetCapabilities(
+			ctx,
+			&csi.GroupControllerGetCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+
+		for _, cap := range rep.Capabilities {
+			fmt.Println(cap.Type)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	groupControllerCmd.AddCommand(groupControllerGetCapabilitiesCmd)
+}
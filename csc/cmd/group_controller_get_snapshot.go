@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var getGroupSnapshot struct {
+	snapIDs []string
+}
+
+var getGroupSnapshotCmd = &cobra.Command{
+	Use:     "get-group-snapshot",
+	Aliases: []string{"get"},
+	Short:   `invokes the rpc "GetVolumeGroupSnapshot"`,
+	Example: `
+USAGE
+
+    csc group-controller get-group-snapshot [flags]
+        --snapshot-id SNAPSHOT_ID [--snapshot-id SNAPSHOT_ID...]
+        GROUP_SNAPSHOT_ID
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ctx, cancel := context.WithTimeout(root.ctx, root.timeout)
+		defer cancel()
+
+		req := csi.GetVolumeGroupSnapshotRequest{
+			GroupSnapshotId: args[0],
+			SnapshotIds:     getGroupSnapshot.snapIDs,
+			Secrets:         root.secrets,
+		}
+
+		log.WithField("request", req).Debug("getting group snapshot")
+		rep, err := groupController.client.GetVolumeGroupSnapshot(ctx, &req)
+		if err != nil {
+			return err
+		}
+		return root.tpl.Execute(os.Stdout, rep.GroupSnapshot)
+	},
+}
+
+func init() {
+	groupControllerCmd.AddCommand(getGroupSnapshotCmd)
+
+	flagSnapshotIDs(getGroupSnapshotCmd.Flags(), &getGroupSnapshot.snapIDs)
+
+	getGroupSnapshotCmd.Flags().StringVar(
+		&root.format,
+		"format",
+		"",
+		"The Go template format used to emit the results")
+
+	flagWithRequiresCreds(
+		getGroupSnapshotCmd.Flags(),
+		&root.withRequiresCreds,
+		"")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rexray/gocsi/middleware/specvalidator/paramschema"
+)
+
+var paramSchema struct {
+	json bool
+}
+
+var paramSchemaCmd = &cobra.Command{
+	Use:   "param-schema FILE",
+	Short: "prints a CreateVolume parameter schema",
+	Long: `Prints the CreateVolume parameter schema read from the JSON
+file FILE, or from stdin if FILE is "-", as a table suitable for
+documentation. The schema is validated before it is printed.`,
+	Example: `
+USAGE
+
+    csc param-schema [flags] FILE`,
+	Args: cobra.ExactArgs(1),
+
+	// The schema is read from a file, so there is no need to connect
+	// to an endpoint.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		f := os.Stdin
+		if args[0] != "-" {
+			var err error
+			if f, err = os.Open(args[0]); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+
+		schema, err := paramschema.Load(f)
+		if err != nil {
+			return err
+		}
+
+		if paramSchema.json {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(schema)
+		}
+		return schema.WriteTable(os.Stdout)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(paramSchemaCmd)
+
+	paramSchemaCmd.Flags().BoolVar(
+		&paramSchema.json,
+		"json",
+		false,
+		"Prints the validated schema as JSON instead of a table")
+}
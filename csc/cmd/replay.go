@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rexray/gocsi/middleware/recorder"
+	"github.com/rexray/gocsi/replay"
+)
+
+var replayArgs struct {
+	timeScale float64
+	ignore    []string
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "replays a recording against the endpoint",
+	Long: `Replays a recording against the endpoint. The recording is the file
+written by a plug-in with X_CSI_RECORD_FILE set. The calls are re-issued
+in order and each response and status is compared with the recorded one.
+Response fields that are expected to differ, such as timestamps and IDs,
+may be ignored with --ignore.
+
+The values of the requests' secrets are redacted from a recording. They
+are replaced with the value of X_CSI_SECRETS if it is set.`,
+	Example: `
+USAGE
+
+    csc replay [flags] RECORDING`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		entries, err := recorder.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		config := replay.Config{
+			TimeScale: replayArgs.timeScale,
+			Ignore:    []string{},
+			Timeout:   root.timeout,
+			Output:    os.Stdout,
+		}
+		for _, f := range replayArgs.ignore {
+			if f != "" {
+				config.Ignore = append(config.Ignore, f)
+			}
+		}
+		if len(root.secrets) > 0 {
+			config.Secrets = root.secrets
+		}
+
+		report, err := replay.Run(root.ctx, root.client, entries, config)
+		if err != nil {
+			return err
+		}
+
+		if report.Failed() {
+			return fmt.Errorf("replay: responses differ from the recording")
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+
+	// This file's init function runs after the root command's, which
+	// configures the help and usage of the commands added before it.
+	setHelpAndUsage(replayCmd)
+
+	replayCmd.Flags().Float64Var(
+		&replayArgs.timeScale,
+		"time-scale",
+		1,
+		`Scales the recorded intervals between the calls. A value of 1
+        replays the calls with the original timing, 0.5 replays them
+        twice as fast, and 0 issues them back to back`)
+
+	replayCmd.Flags().StringSliceVar(
+		&replayArgs.ignore,
+		"ignore",
+		replay.DefaultIgnore,
+		`The response fields that are not compared. A field name matches
+        the field at any depth, and a dotted path, ex. volume.volume_id,
+        matches the field at that path. A "*" path element matches any
+        field name. Specify --ignore "" to compare every field`)
+}
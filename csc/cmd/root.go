@@ -11,6 +11,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/rexray/gocsi/middleware/specvalidator"
 	"github.com/rexray/gocsi/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -93,6 +94,10 @@ var RootCmd = &cobra.Command{
 				root.format = snapshotInfoFormat
 			case createVolumeCmd.Name():
 				root.format = volumeInfoFormat
+			case getVolumeCmd.Name():
+				root.format = getVolumeFormat
+			case createGroupSnapshotCmd.Name(), getGroupSnapshotCmd.Name():
+				root.format = groupSnapshotFormat
 			case pluginInfoCmd.Name():
 				root.format = pluginInfoFormat
 			case pluginCapsCmd.Name():
@@ -167,6 +172,7 @@ func Execute() {
 		if stat, ok := status.FromError(err); ok {
 			exitCode = int(stat.Code())
 			fmt.Fprintln(os.Stderr, stat.Message())
+			printFieldViolations(os.Stderr, err)
 		} else {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
@@ -230,6 +236,23 @@ func init() {
         Read more on gRPC metadata at https://goo.gl/iTci67`)
 }
 
+// printFieldViolations writes the field violations, if any, from the
+// google.rpc.BadRequest details of a gRPC status error to w.
+func printFieldViolations(w io.Writer, err error) {
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nfield violations:")
+	for _, fv := range fvs {
+		field := fv.Field
+		if field == "" {
+			field = "-"
+		}
+		fmt.Fprintf(w, "  %s: %s\n", field, fv.Description)
+	}
+}
+
 type logger struct {
 	f func(msg string, args ...interface{})
 	w io.Writer
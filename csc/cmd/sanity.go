@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rexray/gocsi/sanity"
+)
+
+var sanityArgs struct {
+	run         string
+	skip        string
+	junit       string
+	paramsFile  string
+	secretsFile string
+	scratchDir  string
+	reqBytes    int64
+	list        bool
+}
+
+var sanityCmd = &cobra.Command{
+	Use:   "sanity",
+	Short: "runs a CSI conformance suite against the endpoint",
+	Long: `Runs a CSI conformance suite against the endpoint. The suite
+checks the idempotency of the mutating RPCs, the NotFound behavior of
+RPCs given unknown IDs, the pagination of ListVolumes and ListSnapshots,
+and that the plug-in's advertised capabilities are consistent with the
+RPCs it implements. Tests that require a capability the plug-in does not
+advertise are skipped. Everything the suite creates is removed when the
+test that created it completes.
+
+The suite creates volumes and snapshots, and it stages and publishes
+volumes using paths beneath the scratch directory. It should be run
+against a plug-in dedicated to testing.`,
+	Example: `
+USAGE
+
+    csc sanity [flags]`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if sanityArgs.list {
+			return nil
+		}
+		return cmd.Root().PersistentPreRunE(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if sanityArgs.list {
+			for _, name := range sanity.Tests() {
+				fmt.Println(name)
+			}
+			return nil
+		}
+
+		config := sanity.Config{
+			Secrets:       root.secrets,
+			ScratchDir:    sanityArgs.scratchDir,
+			CapacityBytes: sanityArgs.reqBytes,
+			Timeout:       root.timeout,
+			Output:        os.Stdout,
+		}
+
+		var err error
+		if config.Run, err = compileArg("run", sanityArgs.run); err != nil {
+			return err
+		}
+		if config.Skip, err = compileArg("skip", sanityArgs.skip); err != nil {
+			return err
+		}
+		if sanityArgs.paramsFile != "" {
+			if config.Parameters, err = readMapFile(
+				sanityArgs.paramsFile); err != nil {
+				return err
+			}
+		}
+		if sanityArgs.secretsFile != "" {
+			if config.Secrets, err = readMapFile(
+				sanityArgs.secretsFile); err != nil {
+				return err
+			}
+		}
+
+		report, err := sanity.Run(root.ctx, root.client, config)
+		if err != nil {
+			return err
+		}
+
+		if sanityArgs.junit != "" {
+			f, err := os.Create(sanityArgs.junit)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := report.WriteJUnit(f); err != nil {
+				return err
+			}
+		}
+
+		if _, failed, _ := report.Counts(); failed > 0 {
+			return fmt.Errorf("sanity: %d test(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+func compileArg(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	rx, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %v", name, err)
+	}
+	return rx, nil
+}
+
+// readMapFile reads key/value pairs from a file that contains either a
+// JSON object of strings or KEY=VALUE lines. Blank lines and lines that
+// begin with "#" are ignored.
+func readMapFile(path string) (map[string]string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{}
+	if b := bytes.TrimSpace(buf); len(b) > 0 && b[0] == '{' {
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return data, nil
+	}
+
+	scan := bufio.NewScanner(bytes.NewReader(buf))
+	for n := 1; scan.Scan(); n++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := strings.SplitN(line, "=", 2)
+		if len(p) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		data[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+	}
+	return data, scan.Err()
+}
+
+func init() {
+	RootCmd.AddCommand(sanityCmd)
+
+	// This file's init function runs after the root command's, which
+	// configures the help and usage of the commands added before it.
+	setHelpAndUsage(sanityCmd)
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.run,
+		"run",
+		"",
+		`Runs only the tests whose names match the regular expression,
+        for example:
+
+            --run '^Controller/.*/Idempotent$'`)
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.skip,
+		"skip",
+		"",
+		"Skips the tests whose names match the regular expression")
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.junit,
+		"junit",
+		"",
+		"Writes the results as JUnit XML to the specified file")
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.paramsFile,
+		"params-file",
+		"",
+		`Reads the CreateVolume and CreateSnapshot parameters from the
+        specified file, which contains either a JSON object or KEY=VALUE
+        lines`)
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.secretsFile,
+		"secrets-file",
+		"",
+		`Reads the secrets sent with each RPC from the specified file,
+        which contains either a JSON object or KEY=VALUE lines. The
+        secrets default to the value of X_CSI_SECRETS`)
+
+	sanityCmd.Flags().StringVar(
+		&sanityArgs.scratchDir,
+		"scratch-dir",
+		"",
+		`The directory beneath which staging and target paths are
+        created. The system's temporary directory is used by default`)
+
+	sanityCmd.Flags().Int64Var(
+		&sanityArgs.reqBytes,
+		"req-bytes",
+		sanity.DefaultCapacityBytes,
+		"The required size in bytes of the volumes the suite creates")
+
+	sanityCmd.Flags().BoolVar(
+		&sanityArgs.list,
+		"list",
+		false,
+		"Lists the names of the tests and exits")
+}
@@ -34,7 +34,11 @@ func argName(cmd *cobra.Command) string {
 		nodePublishVolumeCmd,
 		nodeUnpublishVolumeCmd:
 		return "VOLUME_ID [VOLUME_ID...]"
-	case RootCmd, controllerCmd, identityCmd, nodeCmd:
+	case createGroupSnapshotCmd:
+		return "GROUP_SNAPSHOT_NAME [GROUP_SNAPSHOT_NAME...]"
+	case deleteGroupSnapshotCmd, getGroupSnapshotCmd:
+		return "GROUP_SNAPSHOT_ID"
+	case RootCmd, controllerCmd, groupControllerCmd, identityCmd, nodeCmd:
 		return "CMD"
 		//case docCmd:
 		//	return "DIR"
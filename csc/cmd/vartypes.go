@@ -42,6 +42,10 @@ func (s *mapOfStringArg) Set(val string) error {
 	return nil
 }
 
+// volumeMountGroupKey is the prefix of the mount flag that specifies a
+// mount volume capability's VolumeMountGroup.
+const volumeMountGroupKey = "volume_mount_group="
+
 // volumeCapabilitySliceArg is used for parsing one or more volume
 // capabilities from the command line
 type volumeCapabilitySliceArg struct {
@@ -69,7 +73,7 @@ func (s *volumeCapabilitySliceArg) Set(val string) error {
 
 	var cap csi.VolumeCapability
 
-	szMode := data[0]
+	szMode := strings.ToUpper(data[0])
 	if i, ok := csi.VolumeCapability_AccessMode_Mode_value[szMode]; ok {
 		cap.AccessMode = &csi.VolumeCapability_AccessMode{
 			Mode: csi.VolumeCapability_AccessMode_Mode(i),
@@ -79,10 +83,11 @@ func (s *volumeCapabilitySliceArg) Set(val string) error {
 		if err != nil {
 			return fmt.Errorf("invalid access mode: %v: %v", szMode, err)
 		}
-		if _, ok := csi.VolumeCapability_AccessMode_Mode_name[int32(i)]; ok {
-			cap.AccessMode = &csi.VolumeCapability_AccessMode{
-				Mode: csi.VolumeCapability_AccessMode_Mode(i),
-			}
+		if _, ok := csi.VolumeCapability_AccessMode_Mode_name[int32(i)]; !ok {
+			return fmt.Errorf("invalid access mode: %v", szMode)
+		}
+		cap.AccessMode = &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_Mode(i),
 		}
 	}
 
@@ -109,9 +114,17 @@ func (s *volumeCapabilitySliceArg) Set(val string) error {
 			Mount: mountCap,
 		}
 
-		// If there is data remaining then treat it as mount flags.
+		// If there is data remaining then treat it as mount flags. The
+		// volume mount group is specified as a mount flag with the
+		// key volumeMountGroupKey.
 		if len(data) > 3 {
-			mountCap.MountFlags = strings.Split(data[3], ",")
+			for _, f := range strings.Split(data[3], ",") {
+				if strings.HasPrefix(f, volumeMountGroupKey) {
+					mountCap.VolumeMountGroup = f[len(volumeMountGroupKey):]
+					continue
+				}
+				mountCap.MountFlags = append(mountCap.MountFlags, f)
+			}
 		}
 
 		s.data = append(s.data, &cap)
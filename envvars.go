@@ -75,7 +75,8 @@ const (
 	//
 	// If unset or set to an empty value the storage plug-in activates
 	// both controller and node services. The identity service is always
-	// activated.
+	// activated. The group controller service, if provided, is activated
+	// along with the controller service.
 	EnvVarMode = "X_CSI_MODE"
 
 	// EnvVarReqLogging is the name of the environment variable
@@ -100,6 +101,18 @@ const (
 	// of the VolumeContext field
 	EnvVarLoggingDisableVolCtx = "X_CSI_LOG_DISABLE_VOL_CTX"
 
+	// EnvVarSecretGuard is the name of the environment variable used to
+	// determine whether or not to redact the values of a request's secrets
+	// from the response and the returned error.
+	EnvVarSecretGuard = "X_CSI_SECRET_GUARD"
+
+	// EnvVarSecretGuardFail is the name of the environment variable used
+	// to determine whether or not calls whose response or error contains
+	// a value of the request's secrets fail with the gRPC error code
+	// Internal. Setting X_CSI_SECRET_GUARD_FAIL=true sets
+	// X_CSI_SECRET_GUARD=true.
+	EnvVarSecretGuardFail = "X_CSI_SECRET_GUARD_FAIL"
+
 	// EnvVarReqIDInjection is the name of the environment variable
 	// used to determine whether or not to enable request ID injection.
 	EnvVarReqIDInjection = "X_CSI_REQ_ID_INJECTION"
@@ -122,6 +135,30 @@ const (
 	// a code of "Internal."
 	EnvVarSpecRepValidation = "X_CSI_SPEC_REP_VALIDATION"
 
+	// EnvVarSpecErrCodeValidation is the name of the environment variable
+	// used to determine whether or not to validate the gRPC status codes
+	// of errors returned by RPCs against the codes permitted by the spec.
+	EnvVarSpecErrCodeValidation = "X_CSI_SPEC_ERR_CODE_VALIDATION"
+
+	// EnvVarSpecReportOnly is the name of the environment variable
+	// used to determine whether or not spec violations are logged and
+	// counted instead of rejected. Setting X_CSI_SPEC_REPORT_ONLY=true
+	// is the equivalent to setting X_CSI_SPEC_REQ_REPORT_ONLY=true and
+	// X_CSI_SPEC_REP_REPORT_ONLY=true.
+	EnvVarSpecReportOnly = "X_CSI_SPEC_REPORT_ONLY"
+
+	// EnvVarSpecReqReportOnly is the name of the environment variable
+	// used to determine whether or not to enable validation of CSI request
+	// messages in report-only mode. Invalid requests are logged and
+	// counted but passed to the plug-in unchanged.
+	EnvVarSpecReqReportOnly = "X_CSI_SPEC_REQ_REPORT_ONLY"
+
+	// EnvVarSpecRepReportOnly is the name of the environment variable
+	// used to determine whether or not to enable validation of CSI
+	// response messages in report-only mode. Invalid responses are logged
+	// and counted but returned to the client unchanged.
+	EnvVarSpecRepReportOnly = "X_CSI_SPEC_REP_REPORT_ONLY"
+
 	// EnvVarDisableFieldLen is the name of the environment variable used
 	// to determine whether or not to disable validation of CSI request and
 	// response field lengths against the permitted lenghts defined in the spec
@@ -179,6 +216,106 @@ const (
 	// for the eponymous RPC.
 	EnvVarCredsNodePubVol = "X_CSI_REQUIRE_CREDS_NODE_PUB_VOL"
 
+	// EnvVarCredsCreateSnap is the name of the environment variable
+	// used to determine whether or not user credentials are required for
+	// the eponymous RPC.
+	EnvVarCredsCreateSnap = "X_CSI_REQUIRE_CREDS_CREATE_SNAP"
+
+	// EnvVarCredsDeleteSnap is the name of the environment variable
+	// used to determine whether or not user credentials are required for
+	// the eponymous RPC.
+	EnvVarCredsDeleteSnap = "X_CSI_REQUIRE_CREDS_DELETE_SNAP"
+
+	// EnvVarCredsListSnap is the name of the environment variable
+	// used to determine whether or not user credentials are required for
+	// the ListSnapshots RPC. This value is not affected by EnvVarCreds
+	// since ListSnapshots secrets are optional in the CSI specification.
+	EnvVarCredsListSnap = "X_CSI_REQUIRE_CREDS_LIST_SNAP"
+
+	// EnvVarCredsCtrlrExpandVol is the name of the environment
+	// variable used to determine whether or not user credentials are required
+	// for the ControllerExpandVolume RPC.
+	EnvVarCredsCtrlrExpandVol = "X_CSI_REQUIRE_CREDS_CTRLR_EXPAND_VOL"
+
+	// EnvVarLeaderElection is the name of the environment variable
+	// used to determine whether or not to enable leader election. When
+	// enabled, only the elected leader handles Controller RPCs.
+	EnvVarLeaderElection = "X_CSI_LEADER_ELECTION"
+
+	// EnvVarLifecycleValidation is the name of the environment variable
+	// used to determine whether or not to track the lifecycle of each
+	// volume and log calls made out of the order defined by the spec.
+	EnvVarLifecycleValidation = "X_CSI_LIFECYCLE_VALIDATION"
+
+	// EnvVarLifecycleEnforce is the name of the environment variable used
+	// to determine whether or not calls made out of the order defined by
+	// the spec are rejected with the gRPC error code FailedPrecondition.
+	// Setting X_CSI_LIFECYCLE_ENFORCE=true sets
+	// X_CSI_LIFECYCLE_VALIDATION=true.
+	EnvVarLifecycleEnforce = "X_CSI_LIFECYCLE_ENFORCE"
+
+	// EnvVarLifecycleStateFile is the name of the environment variable
+	// used to specify the file in which the lifecycle validator persists
+	// the volumes' states. If unset the states are kept in memory only.
+	EnvVarLifecycleStateFile = "X_CSI_LIFECYCLE_STATE_FILE"
+
+	// EnvVarCapabilityGating is the name of the environment variable
+	// used to determine whether or not to reject RPCs and request
+	// features that require capabilities the plug-in does not advertise.
+	// The capabilities are cached at startup and refreshed on SIGHUP.
+	EnvVarCapabilityGating = "X_CSI_CAPABILITY_GATING"
+
+	// EnvVarDryRun is the name of the environment variable used to
+	// determine whether or not mutating RPCs are short-circuited after
+	// validation, locking and logging and answered with synthesized
+	// responses instead of reaching the plug-in.
+	EnvVarDryRun = "X_CSI_DRY_RUN"
+
+	// EnvVarDryRunRecordFile is the name of the environment variable used
+	// to specify the JSON-lines file to which the calls short-circuited
+	// in dry-run mode are appended.
+	EnvVarDryRunRecordFile = "X_CSI_DRY_RUN_RECORD_FILE"
+
+	// EnvVarRecordFile is the name of the environment variable used to
+	// specify the file to which every call is recorded so that the calls
+	// may be replayed with "csc replay".
+	EnvVarRecordFile = "X_CSI_RECORD_FILE"
+
+	// EnvVarFaultInjectRules is the name of the environment variable used
+	// to specify a JSON array of the rules with which the fault injector
+	// fails, delays or hangs calls. The rules are appended to those read
+	// from X_CSI_FAULT_INJECT_FILE.
+	EnvVarFaultInjectRules = "X_CSI_FAULT_INJECT_RULES"
+
+	// EnvVarFaultInjectFile is the name of the environment variable used
+	// to specify a file that contains a JSON array of fault injection
+	// rules.
+	EnvVarFaultInjectFile = "X_CSI_FAULT_INJECT_FILE"
+
+	// EnvVarFaultInjectAddr is the name of the environment variable used
+	// to specify the address of the fault injector's HTTP admin endpoint,
+	// ex. "127.0.0.1:9099". The rules are read with GET, replaced with PUT
+	// and removed with DELETE at the path /faultinject/rules.
+	EnvVarFaultInjectAddr = "X_CSI_FAULT_INJECT_ADDR"
+
+	// EnvVarLeaderElectionName is the name of the environment variable
+	// used to specify the name of the election. Replicas of the same
+	// plug-in must use the same name. The default value is the plug-in's
+	// name if X_CSI_PLUGIN_INFO is set, otherwise the program's name.
+	EnvVarLeaderElectionName = "X_CSI_LEADER_ELECTION_NAME"
+
+	// EnvVarLeaderElectionFlockDir is the name of the environment variable
+	// used to specify the directory in which the flock leader election
+	// backend creates its lock file. This backend is used when
+	// X_CSI_SERIAL_VOL_ACCESS_ETCD_ENDPOINTS is not set.
+	EnvVarLeaderElectionFlockDir = "X_CSI_LEADER_ELECTION_FLOCK_DIR"
+
+	// EnvVarLeaderElectionHandoverTimeout is the name of the environment
+	// variable used to specify how long a leader waits for in-flight
+	// Controller RPCs to complete when stepping down. The default
+	// value is 5s.
+	EnvVarLeaderElectionHandoverTimeout = "X_CSI_LEADER_ELECTION_HANDOVER_TIMEOUT"
+
 	// EnvVarSerialVolAccess is the name of the environment variable
 	// used to determine whether or not to enable serial volume access.
 	EnvVarSerialVolAccess = "X_CSI_SERIAL_VOL_ACCESS"
@@ -246,6 +383,11 @@ const (
 	// variable that defines the password used for authentication.
 	EnvVarSerialVolAccessEtcdPassword = "X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD"
 
+	// EnvVarSerialVolAccessEtcdPasswordFile is the name of the environment
+	// variable that defines the path to a file that contains the password
+	// used for authentication.
+	EnvVarSerialVolAccessEtcdPasswordFile = "X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD_FILE"
+
 	// EnvVarSerialVolAccessEtcdRejectOldCluster is the name of the environment
 	// variable that defines when set will refuse to create a client against
 	// an outdated cluster.
@@ -260,6 +402,35 @@ const (
 	// variable that defines whether or not the TLS connection should
 	// verify certificates.
 	EnvVarSerialVolAccessEtcdTLSInsecure = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_INSECURE"
+
+	// EnvVarSerialVolAccessEtcdTLSCA is the name of the environment
+	// variable that defines the path to a PEM-encoded CA bundle used to
+	// verify the server's certificate.
+	EnvVarSerialVolAccessEtcdTLSCA = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CA"
+
+	// EnvVarSerialVolAccessEtcdTLSCert is the name of the environment
+	// variable that defines the path to a PEM-encoded client certificate.
+	EnvVarSerialVolAccessEtcdTLSCert = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CERT"
+
+	// EnvVarSerialVolAccessEtcdTLSKey is the name of the environment
+	// variable that defines the path to the client certificate's
+	// PEM-encoded private key.
+	EnvVarSerialVolAccessEtcdTLSKey = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_KEY"
+
+	// EnvVarSerialVolAccessEtcdTLSServerName is the name of the environment
+	// variable that defines the server name used to verify the server's
+	// certificate.
+	EnvVarSerialVolAccessEtcdTLSServerName = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_SERVER_NAME"
+
+	// EnvVarSerialVolAccessFlockDir is the name of the environment
+	// variable that defines the directory in which the flock lock
+	// provider creates its lock files.
+	EnvVarSerialVolAccessFlockDir = "X_CSI_SERIAL_VOL_ACCESS_FLOCK_DIR"
+
+	// EnvVarSerialVolAccessFlockPollInterval is the name of the environment
+	// variable that defines how often the flock lock provider attempts to
+	// obtain a lock held by another process.
+	EnvVarSerialVolAccessFlockPollInterval = "X_CSI_SERIAL_VOL_ACCESS_FLOCK_POLL_INTERVAL"
 )
 
 func (sp *StoragePlugin) initEnvVars(ctx context.Context) {
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
@@ -19,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"text/template"
 
@@ -27,6 +29,13 @@ import (
 	"google.golang.org/grpc"
 
 	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/middleware/capgate"
+	"github.com/rexray/gocsi/middleware/dryrun"
+	"github.com/rexray/gocsi/middleware/leaderelection"
+	"github.com/rexray/gocsi/middleware/recorder"
+	"github.com/rexray/gocsi/middleware/serialvolume"
+	"github.com/rexray/gocsi/middleware/specvalidator"
+	"github.com/rexray/gocsi/middleware/specvalidator/paramschema"
 	"github.com/rexray/gocsi/utils"
 )
 
@@ -125,6 +134,11 @@ func Run(
 		sp.Stop(ctx)
 		rmSockFile()
 		log.Info("server aborted")
+	}, func(s os.Signal) bool {
+		// SIGHUP refreshes the cached capabilities when capability
+		// gating is enabled.
+		h, ok := sp.(interface{ handlesSIGHUP() bool })
+		return s == syscall.SIGHUP && ok && h.handlesSIGHUP()
 	})
 
 	if err := sp.Serve(ctx, l); err != nil {
@@ -134,7 +148,7 @@ func Run(
 }
 
 // StoragePluginProvider is able to serve a gRPC endpoint that provides
-// the CSI services: Controller, Identity, Node.
+// the CSI services: Controller, GroupController, Identity, Node.
 type StoragePluginProvider interface {
 
 	// Serve accepts incoming connections on the listener lis, creating
@@ -170,6 +184,11 @@ type StoragePlugin struct {
 	// Node is the eponymous CSI service.
 	Node csi.NodeServer
 
+	// GroupController is the eponymous CSI service. It is optional and,
+	// like the Controller service, is not registered when X_CSI_MODE is
+	// set to "node".
+	GroupController csi.GroupControllerServer
+
 	// ServerOpts is a list of gRPC server options used when serving
 	// the SP. This list should not include a gRPC interceptor option
 	// as one is created automatically based on the interceptor configuration
@@ -182,6 +201,39 @@ type StoragePlugin struct {
 	// based on runtime configuration settings.
 	Interceptors []grpc.UnaryServerInterceptor
 
+	// SerialVolumeOpts is a list of options used to configure the
+	// serial volume access middleware when it is enabled with the
+	// environment variable X_CSI_SERIAL_VOL_ACCESS. These options are
+	// applied after the ones derived from the environment, so they may,
+	// for example, provide custom lock key functions with
+	// serialvolume.WithLockKeyFunc.
+	SerialVolumeOpts []serialvolume.Option
+
+	// SpecValidatorRules is a registry of custom validation rules used
+	// by the spec validator when request or response validation is
+	// enabled. Rules may be added from BeforeServe, ex.:
+	//
+	//     sp.SpecValidatorRules.AddRequestRule("CreateVolume", f)
+	//
+	// Custom rules run after the built-in checks and their errors are
+	// reported with the same google.rpc.BadRequest details.
+	SpecValidatorRules specvalidator.Rules
+
+	// ParamSchema is an optional schema for CreateVolume request
+	// parameters. When set and request validation is enabled, requests
+	// with unknown, missing or invalid parameters are rejected and the
+	// typed, defaulted parameters are available to the handler via
+	// paramschema.FromContext. Please note the schema must be set before
+	// Serve is invoked; it may not be set in BeforeServe.
+	ParamSchema *paramschema.Schema
+
+	// DryRunResponder is an optional dryrun.Responder used to synthesize
+	// the responses of the mutating RPCs short-circuited when dry-run
+	// mode is enabled with the environment variable X_CSI_DRY_RUN. If
+	// nil, dryrun.DefaultResponder is used. Please note the responder
+	// must be set before Serve is invoked.
+	DryRunResponder dryrun.Responder
+
 	// BeforeServe is an optional callback that is invoked after the
 	// StoragePlugin has been initialized, just prior to the creation
 	// of the gRPC server. This callback may be used to perform custom
@@ -189,12 +241,33 @@ type StoragePlugin struct {
 	// or prevent the server from starting by returning a non-nil error.
 	BeforeServe func(context.Context, *StoragePlugin, net.Listener) error
 
+	// OnStartedLeading is an optional callback that is invoked in a new
+	// goroutine when leader election is enabled and this process becomes
+	// the leader. The provided context is canceled when leadership is lost.
+	OnStartedLeading func(context.Context)
+
+	// OnStoppedLeading is an optional callback that is invoked when leader
+	// election is enabled and this process stops being the leader, after
+	// in-flight Controller RPCs have completed or the handover timeout
+	// has elapsed.
+	OnStoppedLeading func()
+
 	// EnvVars is a list of default environment variables and values.
 	EnvVars []string
 
-	serveOnce sync.Once
-	stopOnce  sync.Once
-	server    *grpc.Server
+	serveOnce      sync.Once
+	stopOnce       sync.Once
+	server         *grpc.Server
+	leaderElection *leaderelection.LeaderElection
+	capGate        *capgate.CapabilityGate
+	capGateStarted int32
+	dryRun         *dryrun.DryRun
+	recorder       *recorder.Recorder
+	faultInject    *http.Server
+
+	// serialVolLocker is the serial volume lock provider, if it must be
+	// closed to release its locks.
+	serialVolLocker io.Closer
 
 	envVars    map[string]string
 	pluginInfo csi.GetPluginInfoResponse
@@ -275,14 +348,7 @@ func (sp *StoragePlugin) Serve(ctx context.Context, lis net.Listener) error {
 		log.Info("identity service registered")
 
 		// Determine which of the controller/node services to register
-		mode := csictx.Getenv(ctx, EnvVarMode)
-		if strings.EqualFold(mode, "controller") {
-			mode = "controller"
-		} else if strings.EqualFold(mode, "node") {
-			mode = "node"
-		} else {
-			mode = ""
-		}
+		mode := sp.mode(ctx)
 
 		if mode == "" || mode == "controller" {
 			if sp.Controller == nil {
@@ -291,6 +357,11 @@ func (sp *StoragePlugin) Serve(ctx context.Context, lis net.Listener) error {
 			}
 			csi.RegisterControllerServer(sp.server, sp.Controller)
 			log.Info("controller service registered")
+			if sp.GroupController != nil {
+				csi.RegisterGroupControllerServer(
+					sp.server, sp.GroupController)
+				log.Info("group controller service registered")
+			}
 		}
 		if mode == "" || mode == "node" {
 			if sp.Node == nil {
@@ -306,6 +377,19 @@ func (sp *StoragePlugin) Serve(ctx context.Context, lis net.Listener) error {
 			lis.Addr().Network(), lis.Addr().String())
 		log.WithField("endpoint", endpoint).Info("serving")
 
+		// Begin campaigning for leadership.
+		if sp.leaderElection != nil {
+			sp.leaderElection.Start(ctx)
+		}
+
+		// Load the capabilities used to gate RPCs.
+		if sp.capGate != nil {
+			if err = sp.capGate.Start(ctx); err != nil {
+				return
+			}
+			atomic.StoreInt32(&sp.capGateStarted, 1)
+		}
+
 		// Start the gRPC server.
 		err = sp.server.Serve(lis)
 		return
@@ -320,9 +404,27 @@ func (sp *StoragePlugin) Serve(ctx context.Context, lis net.Listener) error {
 // errors.
 func (sp *StoragePlugin) Stop(ctx context.Context) {
 	sp.stopOnce.Do(func() {
+		if sp.leaderElection != nil {
+			sp.leaderElection.Stop()
+		}
+		if sp.capGate != nil {
+			sp.capGate.Stop()
+		}
 		if sp.server != nil {
 			sp.server.Stop()
 		}
+		if sp.serialVolLocker != nil {
+			sp.serialVolLocker.Close()
+		}
+		if sp.dryRun != nil {
+			sp.dryRun.Close()
+		}
+		if sp.faultInject != nil {
+			sp.faultInject.Close()
+		}
+		if sp.recorder != nil {
+			sp.recorder.Close()
+		}
 		log.Info("stopped")
 	})
 }
@@ -332,9 +434,27 @@ func (sp *StoragePlugin) Stop(ctx context.Context) {
 // pending RPCs are finished.
 func (sp *StoragePlugin) GracefulStop(ctx context.Context) {
 	sp.stopOnce.Do(func() {
+		if sp.leaderElection != nil {
+			sp.leaderElection.Stop()
+		}
+		if sp.capGate != nil {
+			sp.capGate.Stop()
+		}
 		if sp.server != nil {
 			sp.server.GracefulStop()
 		}
+		if sp.serialVolLocker != nil {
+			sp.serialVolLocker.Close()
+		}
+		if sp.dryRun != nil {
+			sp.dryRun.Close()
+		}
+		if sp.faultInject != nil {
+			sp.faultInject.Close()
+		}
+		if sp.recorder != nil {
+			sp.recorder.Close()
+		}
 		log.Info("gracefully stopped")
 	})
 }
@@ -468,6 +588,19 @@ func (sp *StoragePlugin) setenv(key, val string) error {
 	return nil
 }
 
+// mode returns the service mode set with X_CSI_MODE: "controller",
+// "node", or an empty string if both services are activated.
+func (sp *StoragePlugin) mode(ctx context.Context) string {
+	mode := csictx.Getenv(ctx, EnvVarMode)
+	if strings.EqualFold(mode, "controller") {
+		return "controller"
+	}
+	if strings.EqualFold(mode, "node") {
+		return "node"
+	}
+	return ""
+}
+
 func (sp *StoragePlugin) getEnvBool(ctx context.Context, key string) bool {
 	v, ok := csictx.LookupEnv(ctx, key)
 	if !ok {
@@ -479,7 +612,15 @@ func (sp *StoragePlugin) getEnvBool(ctx context.Context, key string) bool {
 	return false
 }
 
-func trapSignals(onExit, onAbort func()) {
+// handlesSIGHUP returns a flag indicating whether the capability gate has
+// started and refreshes the plug-in's capabilities on SIGHUP.
+func (sp *StoragePlugin) handlesSIGHUP() bool {
+	return atomic.LoadInt32(&sp.capGateStarted) == 1
+}
+
+// trapSignals invokes onExit or onAbort and exits when an exit signal is
+// received, unless ignore returns true for the signal.
+func trapSignals(onExit, onAbort func(), ignore func(os.Signal) bool) {
 	sigc := make(chan os.Signal, 1)
 	sigs := []os.Signal{
 		syscall.SIGTERM,
@@ -491,7 +632,7 @@ func trapSignals(onExit, onAbort func()) {
 	go func() {
 		for s := range sigc {
 			ok, graceful := isExitSignal(s)
-			if !ok {
+			if !ok || (ignore != nil && ignore(s)) {
 				continue
 			}
 			if !graceful {
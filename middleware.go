@@ -1,6 +1,12 @@
 package gocsi
 
 import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -8,11 +14,24 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+
 	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/middleware/capgate"
+	"github.com/rexray/gocsi/middleware/dryrun"
+	"github.com/rexray/gocsi/middleware/faultinject"
+	"github.com/rexray/gocsi/middleware/leaderelection"
+	lletcd "github.com/rexray/gocsi/middleware/leaderelection/etcd"
+	llflock "github.com/rexray/gocsi/middleware/leaderelection/flock"
+	lltypes "github.com/rexray/gocsi/middleware/leaderelection/types"
+	"github.com/rexray/gocsi/middleware/lifecycle"
 	"github.com/rexray/gocsi/middleware/logging"
+	"github.com/rexray/gocsi/middleware/recorder"
 	"github.com/rexray/gocsi/middleware/requestid"
+	"github.com/rexray/gocsi/middleware/secretguard"
 	"github.com/rexray/gocsi/middleware/serialvolume"
 	"github.com/rexray/gocsi/middleware/serialvolume/etcd"
+	"github.com/rexray/gocsi/middleware/serialvolume/flock"
 	"github.com/rexray/gocsi/middleware/specvalidator"
 	"github.com/rexray/gocsi/utils"
 )
@@ -26,8 +45,12 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 		withReqLogging         = sp.getEnvBool(ctx, EnvVarReqLogging)
 		withRepLogging         = sp.getEnvBool(ctx, EnvVarRepLogging)
 		withDisableLogVolCtx   = sp.getEnvBool(ctx, EnvVarLoggingDisableVolCtx)
+		withSecretGuard        = sp.getEnvBool(ctx, EnvVarSecretGuard)
+		withSecretGuardFail    = sp.getEnvBool(ctx, EnvVarSecretGuardFail)
 		withSerialVol          = sp.getEnvBool(ctx, EnvVarSerialVolAccess)
 		withSpec               = sp.getEnvBool(ctx, EnvVarSpecValidation)
+		withSpecReport         = sp.getEnvBool(ctx, EnvVarSpecReportOnly)
+		withSpecErrCodes       = sp.getEnvBool(ctx, EnvVarSpecErrCodeValidation)
 		withStgTgtPath         = sp.getEnvBool(ctx, EnvVarRequireStagingTargetPath)
 		withVolContext         = sp.getEnvBool(ctx, EnvVarRequireVolContext)
 		withPubContext         = sp.getEnvBool(ctx, EnvVarRequirePubContext)
@@ -38,7 +61,12 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 		withCredsCtrlrUnpubVol = sp.getEnvBool(ctx, EnvVarCredsCtrlrUnpubVol)
 		withCredsNodeStgVol    = sp.getEnvBool(ctx, EnvVarCredsNodeStgVol)
 		withCredsNodePubVol    = sp.getEnvBool(ctx, EnvVarCredsNodePubVol)
+		withCredsNewSnap       = sp.getEnvBool(ctx, EnvVarCredsCreateSnap)
+		withCredsDelSnap       = sp.getEnvBool(ctx, EnvVarCredsDeleteSnap)
+		withCredsListSnap      = sp.getEnvBool(ctx, EnvVarCredsListSnap)
+		withCredsCtrlrExpVol   = sp.getEnvBool(ctx, EnvVarCredsCtrlrExpandVol)
 		withDisableFieldLen    = sp.getEnvBool(ctx, EnvVarDisableFieldLen)
+		withRecording          = csictx.Getenv(ctx, EnvVarRecordFile) != ""
 	)
 
 	// Enable all cred requirements if the general option is enabled.
@@ -49,6 +77,9 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 		withCredsCtrlrUnpubVol = true
 		withCredsNodeStgVol = true
 		withCredsNodePubVol = true
+		withCredsNewSnap = true
+		withCredsDelSnap = true
+		withCredsCtrlrExpVol = true
 	}
 
 	// Initialize request & response validation to the global validaiton value.
@@ -79,14 +110,35 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 		log.WithField("withSpecRep", withSpecRep).Debug("init rep validation")
 	}
 
-	// Configure logging.
-	if withReqLogging || withRepLogging {
-		// Automatically enable request ID injection if logging
-		// is enabled.
+	// Report-only mode enables validation in the same direction.
+	var (
+		withSpecReqReport = withSpecReport
+		withSpecRepReport = withSpecReport
+	)
+	if v, ok := csictx.LookupEnv(ctx, EnvVarSpecReqReportOnly); ok {
+		withSpecReqReport, _ = strconv.ParseBool(v)
+	}
+	if v, ok := csictx.LookupEnv(ctx, EnvVarSpecRepReportOnly); ok {
+		withSpecRepReport, _ = strconv.ParseBool(v)
+	}
+	withSpecReq = withSpecReq || withSpecReqReport
+	withSpecRep = withSpecRep || withSpecRepReport
+	log.WithFields(map[string]interface{}{
+		"withSpecReqReport": withSpecReqReport,
+		"withSpecRepReport": withSpecRepReport,
+	}).Debug("init report-only validation")
+
+	// Automatically enable request ID injection if logging, recording or
+	// report-only validation is enabled.
+	if withReqLogging || withRepLogging || withRecording ||
+		withSpecReqReport || withSpecRepReport {
 		sp.Interceptors = append(sp.Interceptors,
 			requestid.NewServerRequestIDInjector())
 		log.Debug("enabled request ID injector")
+	}
 
+	// Configure logging.
+	if withReqLogging || withRepLogging {
 		var (
 			loggingOpts []logging.Option
 			w           = newLogger(log.Debugf)
@@ -109,7 +161,41 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 			logging.NewServerLogger(loggingOpts...))
 	}
 
-	if withSpecReq || withSpecRep {
+	// The recorder precedes the secret guard so that the recorded
+	// responses and errors are redacted.
+	if withRecording {
+		v := csictx.Getenv(ctx, EnvVarRecordFile)
+		r, err := recorder.Open(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sp.recorder = r
+		sp.Interceptors = append(sp.Interceptors, r.Handle)
+		log.WithField("recordFile", v).Debug("enabled recorder")
+	}
+
+	// The secret guard follows the logger so that logged responses and
+	// errors are redacted.
+	if withSecretGuard || withSecretGuardFail {
+		var guardOpts []secretguard.Option
+		if withSecretGuardFail {
+			guardOpts = append(guardOpts, secretguard.WithFailOnLeak())
+		}
+		sp.Interceptors = append(sp.Interceptors,
+			secretguard.NewServerSecretGuard(guardOpts...))
+		log.WithField("failOnLeak", withSecretGuardFail).Debug(
+			"enabled secret guard")
+	}
+
+	if sp.getEnvBool(ctx, EnvVarLeaderElection) {
+		sp.initLeaderElection(ctx)
+	}
+
+	if sp.getEnvBool(ctx, EnvVarCapabilityGating) {
+		sp.initCapabilityGate(ctx)
+	}
+
+	if withSpecReq || withSpecRep || withSpecErrCodes {
 		var specOpts []specvalidator.Option
 
 		if withSpecReq {
@@ -124,6 +210,24 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 				specvalidator.WithResponseValidation())
 			log.Debug("enabled spec validator opt: response validation")
 		}
+		if withSpecErrCodes {
+			specOpts = append(
+				specOpts,
+				specvalidator.WithErrorCodeValidation())
+			log.Debug("enabled spec validator opt: error code validation")
+		}
+		if withSpecReqReport {
+			specOpts = append(
+				specOpts,
+				specvalidator.WithRequestReportOnly())
+			log.Debug("enabled spec validator opt: request report-only")
+		}
+		if withSpecRepReport {
+			specOpts = append(
+				specOpts,
+				specvalidator.WithResponseReportOnly())
+			log.Debug("enabled spec validator opt: response report-only")
+		}
 		if withCredsNewVol {
 			specOpts = append(specOpts,
 				specvalidator.WithRequiresControllerCreateVolumeSecrets())
@@ -160,6 +264,30 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 			log.Debug("enabled spec validator opt: requires creds: " +
 				"NodePublishVolume")
 		}
+		if withCredsNewSnap {
+			specOpts = append(specOpts,
+				specvalidator.WithRequiresControllerCreateSnapshotSecrets())
+			log.Debug("enabled spec validator opt: requires creds: " +
+				"CreateSnapshot")
+		}
+		if withCredsDelSnap {
+			specOpts = append(specOpts,
+				specvalidator.WithRequiresControllerDeleteSnapshotSecrets())
+			log.Debug("enabled spec validator opt: requires creds: " +
+				"DeleteSnapshot")
+		}
+		if withCredsListSnap {
+			specOpts = append(specOpts,
+				specvalidator.WithRequiresControllerListSnapshotsSecrets())
+			log.Debug("enabled spec validator opt: requires creds: " +
+				"ListSnapshots")
+		}
+		if withCredsCtrlrExpVol {
+			specOpts = append(specOpts,
+				specvalidator.WithRequiresControllerExpandVolumeSecrets())
+			log.Debug("enabled spec validator opt: requires creds: " +
+				"ControllerExpandVolume")
+		}
 
 		if withStgTgtPath {
 			specOpts = append(specOpts,
@@ -182,6 +310,32 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 				specvalidator.WithDisableFieldLenCheck())
 			log.Debug("disabled spec validator opt: field length check")
 		}
+		if withSpecRep && sp.Identity != nil {
+			rep, err := sp.Identity.GetPluginCapabilities(
+				ctx, &csi.GetPluginCapabilitiesRequest{})
+			if err != nil {
+				log.WithError(err).Warn(
+					"spec validator: failed to get plugin capabilities")
+			} else if rep != nil {
+				specOpts = append(specOpts,
+					specvalidator.WithPluginCapabilities(
+						rep.Capabilities...))
+				log.Debug("enabled spec validator opt: plugin capabilities")
+			}
+		}
+		if withSpecReq || withSpecRep {
+			specOpts = append(specOpts, sp.specServiceCapabilities(ctx)...)
+		}
+		if sp.ParamSchema != nil {
+			if err := sp.ParamSchema.Validate(); err != nil {
+				log.Fatal(err)
+			}
+			specOpts = append(specOpts,
+				specvalidator.WithParamSchema(sp.ParamSchema))
+			log.Debug("enabled spec validator opt: param schema")
+		}
+		specOpts = append(specOpts,
+			specvalidator.WithRules(&sp.SpecValidatorRules))
 		sp.Interceptors = append(sp.Interceptors,
 			specvalidator.NewServerSpecValidator(specOpts...))
 	}
@@ -212,16 +366,263 @@ func (sp *StoragePlugin) initInterceptors(ctx context.Context) {
 			if err != nil {
 				log.Fatal(err)
 			}
+			sp.serialVolLocker, _ = p.(io.Closer)
+			opts = append(opts, serialvolume.WithLockProvider(p))
+		} else if csictx.Getenv(ctx, EnvVarSerialVolAccessFlockDir) != "" {
+			// Check for flock
+			p, err := flock.New(ctx, "", 0)
+			if err != nil {
+				log.Fatal(err)
+			}
 			opts = append(opts, serialvolume.WithLockProvider(p))
 		}
 
+		opts = append(opts, sp.SerialVolumeOpts...)
 		sp.Interceptors = append(sp.Interceptors, serialvolume.New(opts...))
 		log.WithFields(fields).Debug("enabled serial volume access")
 	}
 
+	if sp.getEnvBool(ctx, EnvVarLifecycleValidation) ||
+		sp.getEnvBool(ctx, EnvVarLifecycleEnforce) {
+		sp.initLifecycleValidator(ctx)
+	}
+
+	if csictx.Getenv(ctx, EnvVarFaultInjectRules) != "" ||
+		csictx.Getenv(ctx, EnvVarFaultInjectFile) != "" ||
+		csictx.Getenv(ctx, EnvVarFaultInjectAddr) != "" {
+		sp.initFaultInjector(ctx)
+	}
+
+	// The dry-run interceptor is last so that short-circuited calls are
+	// subject to all of the other middleware.
+	if sp.getEnvBool(ctx, EnvVarDryRun) {
+		sp.initDryRun(ctx)
+	}
+
 	return
 }
 
+// specServiceCapabilities returns the spec validator options that provide
+// the capabilities of the controller and node services served in the
+// configured mode.
+func (sp *StoragePlugin) specServiceCapabilities(
+	ctx context.Context) []specvalidator.Option {
+
+	var opts []specvalidator.Option
+	mode := sp.mode(ctx)
+	if (mode == "" || mode == "controller") && sp.Controller != nil {
+		rep, err := sp.Controller.ControllerGetCapabilities(
+			ctx, &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			log.WithError(err).Warn(
+				"spec validator: failed to get controller capabilities")
+		} else {
+			opts = append(opts, specvalidator.WithControllerCapabilities(
+				rep.GetCapabilities()...))
+			log.Debug("enabled spec validator opt: controller capabilities")
+		}
+	}
+	if (mode == "" || mode == "node") && sp.Node != nil {
+		rep, err := sp.Node.NodeGetCapabilities(
+			ctx, &csi.NodeGetCapabilitiesRequest{})
+		if err != nil {
+			log.WithError(err).Warn(
+				"spec validator: failed to get node capabilities")
+		} else {
+			opts = append(opts, specvalidator.WithNodeCapabilities(
+				rep.GetCapabilities()...))
+			log.Debug("enabled spec validator opt: node capabilities")
+		}
+	}
+	return opts
+}
+
+func (sp *StoragePlugin) initLifecycleValidator(ctx context.Context) {
+	var opts []lifecycle.Option
+	if sp.getEnvBool(ctx, EnvVarLifecycleEnforce) {
+		opts = append(opts, lifecycle.WithEnforce())
+	}
+	if v := csictx.Getenv(ctx, EnvVarLifecycleStateFile); v != "" {
+		opts = append(opts, lifecycle.WithStateFile(v))
+	}
+
+	mode := sp.mode(ctx)
+	if (mode == "" || mode == "controller") && sp.Controller != nil {
+		rep, err := sp.Controller.ControllerGetCapabilities(
+			ctx, &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			log.WithError(err).Warn(
+				"lifecycle: failed to get controller capabilities")
+		}
+		opts = append(opts,
+			lifecycle.WithControllerCapabilities(rep.GetCapabilities()...))
+	}
+	if (mode == "" || mode == "node") && sp.Node != nil {
+		rep, err := sp.Node.NodeGetCapabilities(
+			ctx, &csi.NodeGetCapabilitiesRequest{})
+		if err != nil {
+			log.WithError(err).Warn(
+				"lifecycle: failed to get node capabilities")
+		}
+		opts = append(opts,
+			lifecycle.WithNodeCapabilities(rep.GetCapabilities()...))
+	}
+
+	v, err := lifecycle.New(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sp.Interceptors = append(sp.Interceptors, v.Handle)
+	log.Debug("enabled lifecycle validator")
+}
+
+func (sp *StoragePlugin) initCapabilityGate(ctx context.Context) {
+	opts := []capgate.Option{capgate.WithIdentity(sp.Identity)}
+	mode := sp.mode(ctx)
+	if (mode == "" || mode == "controller") && sp.Controller != nil {
+		opts = append(opts, capgate.WithController(sp.Controller))
+	}
+	if (mode == "" || mode == "controller") && sp.GroupController != nil {
+		opts = append(opts, capgate.WithGroupController(sp.GroupController))
+	}
+	if (mode == "" || mode == "node") && sp.Node != nil {
+		opts = append(opts, capgate.WithNode(sp.Node))
+	}
+	sp.capGate = capgate.New(opts...)
+	sp.Interceptors = append(sp.Interceptors, sp.capGate.Handle)
+	log.Debug("enabled capability gating")
+}
+
+func (sp *StoragePlugin) initFaultInjector(ctx context.Context) {
+	var rules []faultinject.Rule
+	if v := csictx.Getenv(ctx, EnvVarFaultInjectFile); v != "" {
+		r, err := faultinject.ReadRulesFile(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, r...)
+	}
+	if v := csictx.Getenv(ctx, EnvVarFaultInjectRules); v != "" {
+		r, err := faultinject.ParseRules([]byte(v))
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, r...)
+	}
+	i, err := faultinject.New(faultinject.WithRules(rules...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sp.Interceptors = append(sp.Interceptors, i.Handle)
+
+	addr := csictx.Getenv(ctx, EnvVarFaultInjectAddr)
+	if addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/faultinject/rules", i)
+		sp.faultInject = &http.Server{Handler: mux}
+		go func() {
+			if err := sp.faultInject.Serve(lis); err != http.ErrServerClosed {
+				log.WithError(err).Error("fault injector admin endpoint failed")
+			}
+		}()
+	}
+	log.WithFields(map[string]interface{}{
+		"rules": len(rules),
+		"addr":  addr,
+	}).Warn("enabled fault injection")
+}
+
+func (sp *StoragePlugin) initDryRun(ctx context.Context) {
+	var opts []dryrun.Option
+	if sp.DryRunResponder != nil {
+		opts = append(opts, dryrun.WithResponder(sp.DryRunResponder))
+	}
+	recordFile := csictx.Getenv(ctx, EnvVarDryRunRecordFile)
+	if recordFile != "" {
+		opts = append(opts, dryrun.WithRecordFile(recordFile))
+	}
+	d, err := dryrun.New(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sp.dryRun = d
+	sp.Interceptors = append(sp.Interceptors, d.Handle)
+	log.WithField("recordFile", recordFile).Warn(
+		"enabled dry run: mutating RPCs will not reach the plug-in")
+}
+
+func (sp *StoragePlugin) initLeaderElection(ctx context.Context) {
+	if sp.mode(ctx) == "node" {
+		log.Warn("leader election disabled in node mode")
+		return
+	}
+
+	name := csictx.Getenv(ctx, EnvVarLeaderElectionName)
+	if name == "" {
+		name = sp.pluginInfo.Name
+	}
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+
+	hostname, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	var (
+		e   lltypes.Elector
+		err error
+	)
+	if csictx.Getenv(ctx, EnvVarSerialVolAccessEtcdEndpoints) != "" {
+		e, err = lletcd.New(ctx, name, id, 0, nil)
+	} else if dir := csictx.Getenv(
+		ctx, EnvVarLeaderElectionFlockDir); dir != "" {
+		e, err = llflock.New(ctx, dir, name, 0)
+	} else {
+		err = fmt.Errorf(
+			"leader election requires %s or %s",
+			EnvVarSerialVolAccessEtcdEndpoints,
+			EnvVarLeaderElectionFlockDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fields := map[string]interface{}{
+		"leaderElection.name": name,
+		"leaderElection.id":   id,
+	}
+	opts := []leaderelection.Option{
+		leaderelection.WithOnStartedLeading(func(ctx context.Context) {
+			if f := sp.OnStartedLeading; f != nil {
+				f(ctx)
+			}
+		}),
+		leaderelection.WithOnStoppedLeading(func() {
+			if f := sp.OnStoppedLeading; f != nil {
+				f()
+			}
+		}),
+	}
+	if sp.mode(ctx) == "" && sp.Node != nil {
+		opts = append(opts, leaderelection.WithNodeService())
+	}
+	if v, _ := csictx.LookupEnv(
+		ctx, EnvVarLeaderElectionHandoverTimeout); v != "" {
+		if t, err := time.ParseDuration(v); err == nil {
+			fields["leaderElection.handoverTimeout"] = t
+			opts = append(opts, leaderelection.WithHandoverTimeout(t))
+		}
+	}
+
+	sp.leaderElection = leaderelection.New(e, opts...)
+	sp.Interceptors = append(sp.Interceptors, sp.leaderElection.Handle)
+	log.WithFields(fields).Debug("enabled leader election")
+}
+
 func (sp *StoragePlugin) injectContext(
 	ctx context.Context,
 	req interface{},
@@ -0,0 +1,377 @@
+package capgate
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
+	xctx "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/utils"
+)
+
+// Option configures the capability gate.
+type Option func(*opts)
+
+type opts struct {
+	identity   csi.IdentityServer
+	controller csi.ControllerServer
+	node       csi.NodeServer
+	group      csi.GroupControllerServer
+}
+
+// WithIdentity is an Option that sets the Identity service queried for
+// the plug-in's capabilities.
+func WithIdentity(s csi.IdentityServer) Option {
+	return func(o *opts) {
+		o.identity = s
+	}
+}
+
+// WithController is an Option that sets the Controller service queried
+// for the controller's capabilities. If no Controller service is set then
+// Controller RPCs are not gated.
+func WithController(s csi.ControllerServer) Option {
+	return func(o *opts) {
+		o.controller = s
+	}
+}
+
+// WithNode is an Option that sets the Node service queried for the
+// node's capabilities. If no Node service is set then Node RPCs are
+// not gated.
+func WithNode(s csi.NodeServer) Option {
+	return func(o *opts) {
+		o.node = s
+	}
+}
+
+// WithGroupController is an Option that sets the GroupController service
+// queried for the group controller's capabilities. If no GroupController
+// service is set then GroupController RPCs are not gated.
+func WithGroupController(s csi.GroupControllerServer) Option {
+	return func(o *opts) {
+		o.group = s
+	}
+}
+
+// CapabilityGate caches the capabilities advertised by a plug-in's
+// Get*Capabilities RPCs and provides a server-side, gRPC interceptor that
+// rejects RPCs whose capability is not advertised with codes.Unimplemented
+// and requests that use unsupported features with codes.InvalidArgument.
+// RPCs are not gated until the capabilities have been loaded with Start or
+// Refresh.
+type CapabilityGate struct {
+	opts opts
+
+	capsL  sync.RWMutex
+	loaded bool
+	plugin map[csi.PluginCapability_Service_Type]bool
+	ctrlr  map[csi.ControllerServiceCapability_RPC_Type]bool
+	node   map[csi.NodeServiceCapability_RPC_Type]bool
+	group  map[csi.GroupControllerServiceCapability_RPC_Type]bool
+
+	sigc chan os.Signal
+	done chan struct{}
+}
+
+// New returns a new capability gate.
+func New(opts ...Option) *CapabilityGate {
+	g := &CapabilityGate{}
+	for _, setOpt := range opts {
+		setOpt(&g.opts)
+	}
+	return g
+}
+
+// Start loads the capabilities and refreshes them each time the process
+// receives SIGHUP, until Stop is called.
+func (g *CapabilityGate) Start(ctx context.Context) error {
+	if err := g.Refresh(ctx); err != nil {
+		return err
+	}
+	sigc := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	g.sigc, g.done = sigc, done
+	signal.Notify(sigc, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigc:
+				if err := g.Refresh(ctx); err != nil {
+					log.WithError(err).Error(
+						"capgate: failed to refresh capabilities")
+					continue
+				}
+				log.Info("capgate: refreshed capabilities")
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops refreshing the capabilities on SIGHUP.
+func (g *CapabilityGate) Stop() {
+	if g.done == nil {
+		return
+	}
+	signal.Stop(g.sigc)
+	close(g.done)
+	g.done = nil
+}
+
+// Refresh queries and caches the plug-in's capabilities. The previously
+// cached capabilities are retained if an error occurs.
+func (g *CapabilityGate) Refresh(ctx context.Context) error {
+	var (
+		plugin map[csi.PluginCapability_Service_Type]bool
+		ctrlr  map[csi.ControllerServiceCapability_RPC_Type]bool
+		node   map[csi.NodeServiceCapability_RPC_Type]bool
+		group  map[csi.GroupControllerServiceCapability_RPC_Type]bool
+	)
+
+	if s := g.opts.identity; s != nil {
+		rep, err := s.GetPluginCapabilities(
+			ctx, &csi.GetPluginCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+		plugin = map[csi.PluginCapability_Service_Type]bool{}
+		for _, c := range rep.GetCapabilities() {
+			if svc := c.GetService(); svc != nil {
+				plugin[svc.Type] = true
+			}
+		}
+	}
+
+	if s := g.opts.controller; s != nil {
+		rep, err := s.ControllerGetCapabilities(
+			ctx, &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+		ctrlr = map[csi.ControllerServiceCapability_RPC_Type]bool{}
+		for _, c := range rep.GetCapabilities() {
+			if rpc := c.GetRpc(); rpc != nil {
+				ctrlr[rpc.Type] = true
+			}
+		}
+	}
+
+	if s := g.opts.node; s != nil {
+		rep, err := s.NodeGetCapabilities(
+			ctx, &csi.NodeGetCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+		node = map[csi.NodeServiceCapability_RPC_Type]bool{}
+		for _, c := range rep.GetCapabilities() {
+			if rpc := c.GetRpc(); rpc != nil {
+				node[rpc.Type] = true
+			}
+		}
+	}
+
+	if s := g.opts.group; s != nil {
+		rep, err := s.GroupControllerGetCapabilities(
+			ctx, &csi.GroupControllerGetCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+		group = map[csi.GroupControllerServiceCapability_RPC_Type]bool{}
+		for _, c := range rep.GetCapabilities() {
+			if rpc := c.GetRpc(); rpc != nil {
+				group[rpc.Type] = true
+			}
+		}
+	}
+
+	g.capsL.Lock()
+	defer g.capsL.Unlock()
+	g.plugin, g.ctrlr, g.node, g.group = plugin, ctrlr, node, group
+	g.loaded = true
+	return nil
+}
+
+// controllerRPCs maps the Controller RPCs to the capabilities they
+// require. RPCs not in the map are always allowed.
+var controllerRPCs = map[string]csi.ControllerServiceCapability_RPC_Type{
+	"CreateVolume":              csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+	"DeleteVolume":              csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+	"ControllerPublishVolume":   csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+	"ControllerUnpublishVolume": csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+	"ListVolumes":               csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+	"GetCapacity":               csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+	"CreateSnapshot":            csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+	"DeleteSnapshot":            csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+	"ListSnapshots":             csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+	"ControllerExpandVolume":    csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+	"ControllerGetVolume":       csi.ControllerServiceCapability_RPC_GET_VOLUME,
+}
+
+// nodeRPCs maps the Node RPCs to the capabilities they require. RPCs not
+// in the map are always allowed.
+var nodeRPCs = map[string]csi.NodeServiceCapability_RPC_Type{
+	"NodeStageVolume":    csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+	"NodeUnstageVolume":  csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+	"NodeGetVolumeStats": csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+	"NodeExpandVolume":   csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+}
+
+// groupControllerRPCs maps the GroupController RPCs to the capabilities
+// they require. RPCs not in the map are always allowed.
+var groupControllerRPCs = map[string]csi.GroupControllerServiceCapability_RPC_Type{
+	"CreateVolumeGroupSnapshot": csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+	"DeleteVolumeGroupSnapshot": csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+	"GetVolumeGroupSnapshot":    csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+}
+
+// Handle is a server-side, gRPC interceptor that rejects RPCs and
+// requests that require capabilities the plug-in does not advertise.
+func (g *CapabilityGate) Handle(
+	ctx xctx.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	_, service, method, err := utils.ParseMethod(info.FullMethod)
+	if err != nil {
+		return handler(ctx, req)
+	}
+
+	g.capsL.RLock()
+	err = g.check(service, method, req)
+	g.capsL.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// check must be called with capsL held.
+func (g *CapabilityGate) check(
+	service, method string, req interface{}) error {
+
+	if !g.loaded {
+		return nil
+	}
+
+	switch service {
+	case "Controller":
+		if g.ctrlr == nil || method == "ControllerGetCapabilities" {
+			return nil
+		}
+		if g.plugin != nil &&
+			!g.plugin[csi.PluginCapability_Service_CONTROLLER_SERVICE] {
+			return status.Errorf(codes.Unimplemented,
+				"unsupported: %s: missing plugin capability %s",
+				method, csi.PluginCapability_Service_CONTROLLER_SERVICE)
+		}
+		if c, ok := controllerRPCs[method]; ok && !g.ctrlr[c] {
+			return status.Errorf(codes.Unimplemented,
+				"unsupported: %s: missing controller capability %s",
+				method, c)
+		}
+		return g.checkControllerRequest(req)
+	case "Node":
+		if g.node == nil {
+			return nil
+		}
+		// NodeGetVolumeStats must also be implemented by plug-ins that
+		// report volume conditions.
+		if method == "NodeGetVolumeStats" &&
+			g.node[csi.NodeServiceCapability_RPC_VOLUME_CONDITION] {
+			return nil
+		}
+		if c, ok := nodeRPCs[method]; ok && !g.node[c] {
+			return status.Errorf(codes.Unimplemented,
+				"unsupported: %s: missing node capability %s",
+				method, c)
+		}
+		return g.checkNodeRequest(req)
+	case "GroupController":
+		if g.group == nil || method == "GroupControllerGetCapabilities" {
+			return nil
+		}
+		if g.plugin != nil &&
+			!g.plugin[csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE] {
+			return status.Errorf(codes.Unimplemented,
+				"unsupported: %s: missing plugin capability %s",
+				method, csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE)
+		}
+		if c, ok := groupControllerRPCs[method]; ok && !g.group[c] {
+			return status.Errorf(codes.Unimplemented,
+				"unsupported: %s: missing group controller capability %s",
+				method, c)
+		}
+	}
+
+	return nil
+}
+
+// checkControllerRequest rejects requests that use features that require
+// controller capabilities the plug-in does not advertise.
+func (g *CapabilityGate) checkControllerRequest(req interface{}) error {
+	switch treq := req.(type) {
+	case *csi.CreateVolumeRequest:
+		switch treq.GetVolumeContentSource().GetType().(type) {
+		case *csi.VolumeContentSource_Volume:
+			return g.requireController(
+				"VolumeContentSource.Volume",
+				csi.ControllerServiceCapability_RPC_CLONE_VOLUME)
+		case *csi.VolumeContentSource_Snapshot:
+			return g.requireController(
+				"VolumeContentSource.Snapshot",
+				csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT)
+		}
+	case *csi.ControllerPublishVolumeRequest:
+		if treq.Readonly {
+			return g.requireController(
+				"Readonly",
+				csi.ControllerServiceCapability_RPC_PUBLISH_READONLY)
+		}
+	}
+	return nil
+}
+
+// checkNodeRequest rejects requests that use features that require node
+// capabilities the plug-in does not advertise.
+func (g *CapabilityGate) checkNodeRequest(req interface{}) error {
+	treq, ok := req.(interface {
+		GetVolumeCapability() *csi.VolumeCapability
+	})
+	if !ok {
+		return nil
+	}
+	switch req.(type) {
+	case *csi.NodeStageVolumeRequest, *csi.NodePublishVolumeRequest:
+		if treq.GetVolumeCapability().GetMount().GetVolumeMountGroup() != "" &&
+			!g.node[csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP] {
+			return status.Errorf(codes.InvalidArgument,
+				"unsupported: %s: missing node capability %s",
+				"VolumeCapability.Mount.VolumeMountGroup",
+				csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP)
+		}
+	}
+	return nil
+}
+
+func (g *CapabilityGate) requireController(
+	field string, c csi.ControllerServiceCapability_RPC_Type) error {
+
+	if g.ctrlr[c] {
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument,
+		"unsupported: %s: missing controller capability %s", field, c)
+}
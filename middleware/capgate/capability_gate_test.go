@@ -0,0 +1,354 @@
+package capgate_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/capgate"
+)
+
+type identity struct {
+	csi.IdentityServer
+	caps []csi.PluginCapability_Service_Type
+}
+
+func (s *identity) GetPluginCapabilities(
+	ctx context.Context,
+	req *csi.GetPluginCapabilitiesRequest) (
+	*csi.GetPluginCapabilitiesResponse, error) {
+
+	rep := &csi.GetPluginCapabilitiesResponse{}
+	for _, t := range s.caps {
+		rep.Capabilities = append(rep.Capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{Type: t},
+			},
+		})
+	}
+	return rep, nil
+}
+
+type controller struct {
+	csi.ControllerServer
+	sync.Mutex
+	caps []csi.ControllerServiceCapability_RPC_Type
+}
+
+func (s *controller) addCap(t csi.ControllerServiceCapability_RPC_Type) {
+	s.Lock()
+	defer s.Unlock()
+	s.caps = append(s.caps, t)
+}
+
+func (s *controller) ControllerGetCapabilities(
+	ctx context.Context,
+	req *csi.ControllerGetCapabilitiesRequest) (
+	*csi.ControllerGetCapabilitiesResponse, error) {
+
+	s.Lock()
+	defer s.Unlock()
+	rep := &csi.ControllerGetCapabilitiesResponse{}
+	for _, t := range s.caps {
+		rep.Capabilities = append(rep.Capabilities,
+			&csi.ControllerServiceCapability{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{Type: t},
+				},
+			})
+	}
+	return rep, nil
+}
+
+type node struct {
+	csi.NodeServer
+	caps []csi.NodeServiceCapability_RPC_Type
+}
+
+func (s *node) NodeGetCapabilities(
+	ctx context.Context,
+	req *csi.NodeGetCapabilitiesRequest) (
+	*csi.NodeGetCapabilitiesResponse, error) {
+
+	rep := &csi.NodeGetCapabilitiesResponse{}
+	for _, t := range s.caps {
+		rep.Capabilities = append(rep.Capabilities,
+			&csi.NodeServiceCapability{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{Type: t},
+				},
+			})
+	}
+	return rep, nil
+}
+
+type groupController struct {
+	csi.GroupControllerServer
+	caps []csi.GroupControllerServiceCapability_RPC_Type
+}
+
+func (s *groupController) GroupControllerGetCapabilities(
+	ctx context.Context,
+	req *csi.GroupControllerGetCapabilitiesRequest) (
+	*csi.GroupControllerGetCapabilitiesResponse, error) {
+
+	rep := &csi.GroupControllerGetCapabilitiesResponse{}
+	for _, t := range s.caps {
+		rep.Capabilities = append(rep.Capabilities,
+			&csi.GroupControllerServiceCapability{
+				Type: &csi.GroupControllerServiceCapability_Rpc{
+					Rpc: &csi.GroupControllerServiceCapability_RPC{Type: t},
+				},
+			})
+	}
+	return rep, nil
+}
+
+func invoke(g *capgate.CapabilityGate, method string, req interface{}) error {
+	_, err := g.Handle(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	return err
+}
+
+func newGate() (*capgate.CapabilityGate, *controller) {
+	c := &controller{
+		caps: []csi.ControllerServiceCapability_RPC_Type{
+			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		},
+	}
+	g := capgate.New(
+		capgate.WithIdentity(&identity{
+			caps: []csi.PluginCapability_Service_Type{
+				csi.PluginCapability_Service_CONTROLLER_SERVICE,
+			},
+		}),
+		capgate.WithController(c),
+		capgate.WithNode(&node{
+			caps: []csi.NodeServiceCapability_RPC_Type{
+				csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+			},
+		}))
+	return g, c
+}
+
+func TestCapabilityGate_RPCs(t *testing.T) {
+	g, _ := newGate()
+
+	// RPCs are not gated until the capabilities are loaded.
+	if err := invoke(g, "/csi.v1.Controller/ListVolumes",
+		&csi.ListVolumesRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method string
+		req    interface{}
+		code   codes.Code
+	}{
+		{"/csi.v1.Controller/CreateVolume",
+			&csi.CreateVolumeRequest{}, codes.OK},
+		{"/csi.v1.Controller/ControllerGetCapabilities",
+			&csi.ControllerGetCapabilitiesRequest{}, codes.OK},
+		{"/csi.v1.Controller/ListVolumes",
+			&csi.ListVolumesRequest{}, codes.Unimplemented},
+		{"/csi.v1.Controller/ControllerPublishVolume",
+			&csi.ControllerPublishVolumeRequest{}, codes.Unimplemented},
+		{"/csi.v1.Controller/CreateSnapshot",
+			&csi.CreateSnapshotRequest{}, codes.Unimplemented},
+		{"/csi.v1.Controller/ControllerGetVolume",
+			&csi.ControllerGetVolumeRequest{}, codes.Unimplemented},
+		{"/csi.v1.Node/NodeStageVolume",
+			&csi.NodeStageVolumeRequest{}, codes.OK},
+		{"/csi.v1.Node/NodePublishVolume",
+			&csi.NodePublishVolumeRequest{}, codes.OK},
+		{"/csi.v1.Node/NodeGetVolumeStats",
+			&csi.NodeGetVolumeStatsRequest{}, codes.Unimplemented},
+		{"/csi.v1.Identity/Probe",
+			&csi.ProbeRequest{}, codes.OK},
+	} {
+		if c := status.Code(invoke(g, tc.method, tc.req)); c != tc.code {
+			t.Errorf("%s: code=%v, expected %v", tc.method, c, tc.code)
+		}
+	}
+}
+
+func TestCapabilityGate_VolumeCondition(t *testing.T) {
+	// NodeGetVolumeStats is allowed for plug-ins that report volume
+	// conditions but not volume stats.
+	g := capgate.New(capgate.WithNode(&node{
+		caps: []csi.NodeServiceCapability_RPC_Type{
+			csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+		},
+	}))
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoke(g, "/csi.v1.Node/NodeGetVolumeStats",
+		&csi.NodeGetVolumeStatsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapabilityGate_GroupController(t *testing.T) {
+	const createGroup = "/csi.v1.GroupController/CreateVolumeGroupSnapshot"
+
+	ids := &identity{
+		caps: []csi.PluginCapability_Service_Type{
+			csi.PluginCapability_Service_CONTROLLER_SERVICE,
+		},
+	}
+	gc := &groupController{
+		caps: []csi.GroupControllerServiceCapability_RPC_Type{
+			csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+		},
+	}
+	g := capgate.New(
+		capgate.WithIdentity(ids),
+		capgate.WithGroupController(gc))
+
+	// The plug-in must advertise the GROUP_CONTROLLER_SERVICE capability.
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := invoke(g, createGroup, &csi.CreateVolumeGroupSnapshotRequest{})
+	if c := status.Code(err); c != codes.Unimplemented {
+		t.Fatalf("code=%v", c)
+	}
+
+	ids.caps = append(ids.caps,
+		csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE)
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoke(g, createGroup,
+		&csi.CreateVolumeGroupSnapshotRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	gc.caps = nil
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err = invoke(g, createGroup, &csi.CreateVolumeGroupSnapshotRequest{})
+	if c := status.Code(err); c != codes.Unimplemented {
+		t.Fatalf("code=%v", c)
+	}
+	if err := invoke(g,
+		"/csi.v1.GroupController/GroupControllerGetCapabilities",
+		&csi.GroupControllerGetCapabilitiesRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapabilityGate_Features(t *testing.T) {
+	g, _ := newGate()
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := invoke(g, "/csi.v1.Controller/CreateVolume",
+		&csi.CreateVolumeRequest{
+			VolumeContentSource: &csi.VolumeContentSource{
+				Type: &csi.VolumeContentSource_Volume{
+					Volume: &csi.VolumeContentSource_VolumeSource{
+						VolumeId: "1",
+					},
+				},
+			},
+		})
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+	exp := "unsupported: VolumeContentSource.Volume: " +
+		"missing controller capability CLONE_VOLUME"
+	if m := status.Convert(err).Message(); m != exp {
+		t.Fatalf("msg=%s", m)
+	}
+}
+
+func TestCapabilityGate_VolumeMountGroup(t *testing.T) {
+	g, _ := newGate()
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := invoke(g, "/csi.v1.Node/NodePublishVolume",
+		&csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						VolumeMountGroup: "1000",
+					},
+				},
+			},
+		})
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+}
+
+func TestCapabilityGate_Refresh(t *testing.T) {
+	g, c := newGate()
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	const listVolumes = "/csi.v1.Controller/ListVolumes"
+	req := &csi.ListVolumesRequest{}
+	if c := status.Code(invoke(g, listVolumes, req)); c != codes.Unimplemented {
+		t.Fatalf("code=%v", c)
+	}
+
+	c.addCap(csi.ControllerServiceCapability_RPC_LIST_VOLUMES)
+	if err := g.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoke(g, listVolumes, req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapabilityGate_SIGHUP(t *testing.T) {
+	g, c := newGate()
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	const getCapacity = "/csi.v1.Controller/GetCapacity"
+	req := &csi.GetCapacityRequest{}
+	c.addCap(csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skip(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for invoke(g, getCapacity, req) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("capabilities not refreshed on SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,193 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/middleware/secretguard"
+	"github.com/rexray/gocsi/utils"
+)
+
+// MutatingMethods is the set of the names of the RPCs that are
+// short-circuited in dry-run mode. All other RPCs reach the plug-in.
+var MutatingMethods = map[string]bool{
+	"CreateVolume":              true,
+	"DeleteVolume":              true,
+	"ControllerPublishVolume":   true,
+	"ControllerUnpublishVolume": true,
+	"ControllerExpandVolume":    true,
+	"ControllerModifyVolume":    true,
+	"CreateSnapshot":            true,
+	"DeleteSnapshot":            true,
+	"CreateVolumeGroupSnapshot": true,
+	"DeleteVolumeGroupSnapshot": true,
+	"NodeStageVolume":           true,
+	"NodeUnstageVolume":         true,
+	"NodePublishVolume":         true,
+	"NodeUnpublishVolume":       true,
+	"NodeExpandVolume":          true,
+}
+
+// Option configures the dry-run interceptor.
+type Option func(*opts)
+
+type opts struct {
+	responder  Responder
+	recordFile string
+}
+
+// WithResponder is an Option that sets the Responder used to synthesize
+// the responses of short-circuited calls. DefaultResponder is used if
+// no responder is set.
+func WithResponder(r Responder) Option {
+	return func(o *opts) {
+		o.responder = r
+	}
+}
+
+// WithRecordFile is an Option that appends a JSON-lines Record of every
+// short-circuited call to the given file.
+func WithRecordFile(path string) Option {
+	return func(o *opts) {
+		o.recordFile = path
+	}
+}
+
+// Record is a short-circuited call as written to the record file. The
+// values of the request's secrets are redacted.
+type Record struct {
+	Time      time.Time       `json:"time"`
+	Method    string          `json:"method"`
+	RequestID uint64          `json:"requestID,omitempty"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// DryRun provides a server-side, gRPC interceptor that short-circuits
+// mutating RPCs. The interceptor should be the last in the chain so
+// that the calls are validated, serialized and logged as usual before
+// a synthesized response is returned in place of the plug-in's.
+type DryRun struct {
+	opts opts
+
+	recordL sync.Mutex
+	record  *os.File
+}
+
+// New returns a new dry-run interceptor. If a record file is configured
+// then it is created or opened for appending.
+func New(opts ...Option) (*DryRun, error) {
+	d := &DryRun{}
+	for _, setOpt := range opts {
+		setOpt(&d.opts)
+	}
+	if d.opts.responder == nil {
+		d.opts.responder = DefaultResponder
+	}
+	if d.opts.recordFile != "" {
+		f, err := os.OpenFile(d.opts.recordFile,
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		d.record = f
+	}
+	return d, nil
+}
+
+// Close closes the record file.
+func (d *DryRun) Close() error {
+	d.recordL.Lock()
+	defer d.recordL.Unlock()
+	if d.record == nil {
+		return nil
+	}
+	err := d.record.Close()
+	d.record = nil
+	return err
+}
+
+// Handle is a server-side, gRPC interceptor that returns a synthesized
+// response for mutating RPCs instead of invoking the handler.
+func (d *DryRun) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	_, _, name, err := utils.ParseMethod(info.FullMethod)
+	if err != nil || !MutatingMethods[name] {
+		return handler(ctx, req)
+	}
+
+	rep, err := d.opts.responder.Respond(ctx, info.FullMethod, req)
+
+	fields := map[string]interface{}{"method": info.FullMethod}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		fields["requestID"] = id
+	}
+	if err != nil {
+		fields["error"] = err
+	}
+	log.WithFields(fields).Info("dry run: call short-circuited")
+
+	d.writeRecord(ctx, info.FullMethod, req, rep, err)
+	return rep, err
+}
+
+func (d *DryRun) writeRecord(
+	ctx context.Context,
+	method string,
+	req, rep interface{},
+	repErr error) {
+
+	d.recordL.Lock()
+	defer d.recordL.Unlock()
+	if d.record == nil {
+		return
+	}
+
+	r := Record{Time: time.Now().UTC(), Method: method}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		r.RequestID = id
+	}
+	if m, ok := req.(proto.Message); ok {
+		r.Request = marshal(secretguard.RedactSecrets(m))
+	}
+	if m, ok := rep.(proto.Message); ok && !utils.IsNilResponse(rep) {
+		r.Response = marshal(m)
+	}
+	if repErr != nil {
+		r.Error = status.Convert(repErr).String()
+	}
+
+	buf, err := json.Marshal(r)
+	if err == nil {
+		_, err = d.record.Write(append(buf, '\n'))
+	}
+	if err != nil {
+		log.WithError(err).Error("dry run: failed to write record")
+	}
+}
+
+var marshaler = &jsonpb.Marshaler{OrigName: true}
+
+func marshal(m proto.Message) json.RawMessage {
+	s, err := marshaler.MarshalToString(m)
+	if err != nil {
+		log.WithError(err).Error("dry run: failed to marshal message")
+		return nil
+	}
+	return json.RawMessage(s)
+}
@@ -0,0 +1,164 @@
+package dryrun_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/dryrun"
+)
+
+// invoke calls the interceptor and returns the response, a flag
+// indicating whether the handler was invoked, and the error.
+func invoke(
+	d *dryrun.DryRun,
+	method string,
+	req interface{}) (interface{}, bool, error) {
+
+	var called bool
+	rep, err := d.Handle(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return &csi.ListVolumesResponse{}, nil
+		})
+	return rep, called, err
+}
+
+func TestDryRun_Mutating(t *testing.T) {
+	d, err := dryrun.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep, called, err := invoke(d, "/csi.v1.Controller/CreateVolume",
+		&csi.CreateVolumeRequest{
+			Name:          "vol",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 1024},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Fatal("handler invoked")
+	}
+	vol := rep.(*csi.CreateVolumeResponse).Volume
+	if !strings.HasPrefix(vol.VolumeId, "dryrun-") ||
+		vol.CapacityBytes != 1024 {
+		t.Fatalf("volume=%v", vol)
+	}
+
+	// The same name results in the same ID.
+	rep, _, _ = invoke(d, "/csi.v1.Controller/CreateVolume",
+		&csi.CreateVolumeRequest{Name: "vol"})
+	if id := rep.(*csi.CreateVolumeResponse).Volume.VolumeId; id != vol.VolumeId {
+		t.Fatalf("id=%s, expected %s", id, vol.VolumeId)
+	}
+}
+
+func TestDryRun_Read(t *testing.T) {
+	d, err := dryrun.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, called, err := invoke(d, "/csi.v1.Controller/ListVolumes",
+		&csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("handler not invoked")
+	}
+}
+
+func TestDryRun_Responder(t *testing.T) {
+	d, err := dryrun.New(dryrun.WithResponder(dryrun.ResponderFunc(
+		func(ctx context.Context, method string, req interface{}) (
+			interface{}, error) {
+
+			if _, ok := req.(*csi.DeleteVolumeRequest); ok {
+				return nil, status.Error(codes.NotFound, "1")
+			}
+			return dryrun.DefaultResponder.Respond(ctx, method, req)
+		})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = invoke(d, "/csi.v1.Controller/DeleteVolume",
+		&csi.DeleteVolumeRequest{VolumeId: "1"})
+	if c := status.Code(err); c != codes.NotFound {
+		t.Fatalf("code=%v", c)
+	}
+	_, _, err = invoke(d, "/csi.v1.Node/NodeUnpublishVolume",
+		&csi.NodeUnpublishVolumeRequest{VolumeId: "1", TargetPath: "/mnt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRun_RecordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dryrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dryrun.jsonl")
+
+	d, err := dryrun.New(dryrun.WithRecordFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoke(d, "/csi.v1.Controller/ListVolumes", &csi.ListVolumesRequest{})
+	invoke(d, "/csi.v1.Controller/DeleteVolume",
+		&csi.DeleteVolumeRequest{
+			VolumeId: "1",
+			Secrets:  map[string]string{"password": "hunter2"},
+		})
+	invoke(d, "/csi.v1.Controller/ControllerModifyVolume",
+		&csi.ControllerModifyVolumeRequest{VolumeId: "1"})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []dryrun.Record
+	for scn := bufio.NewScanner(f); scn.Scan(); {
+		var r dryrun.Record
+		if err := json.Unmarshal(scn.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, r)
+	}
+
+	// Only the mutating calls are recorded.
+	if len(recs) != 2 {
+		t.Fatalf("records=%d", len(recs))
+	}
+	if recs[0].Method != "/csi.v1.Controller/DeleteVolume" {
+		t.Fatalf("method=%s", recs[0].Method)
+	}
+	if s := string(recs[0].Request); strings.Contains(s, "hunter2") ||
+		!strings.Contains(s, "[REDACTED]") {
+		t.Fatalf("request=%s", s)
+	}
+	if string(recs[0].Response) != "{}" || recs[0].Error != "" {
+		t.Fatalf("record=%+v", recs[0])
+	}
+}
@@ -0,0 +1,136 @@
+package dryrun
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Responder synthesizes the response of a short-circuited call.
+type Responder interface {
+	Respond(
+		ctx context.Context,
+		method string,
+		req interface{}) (interface{}, error)
+}
+
+// ResponderFunc is an adapter that allows the use of an ordinary
+// function as a Responder.
+type ResponderFunc func(
+	ctx context.Context,
+	method string,
+	req interface{}) (interface{}, error)
+
+// Respond returns f(ctx, method, req).
+func (f ResponderFunc) Respond(
+	ctx context.Context,
+	method string,
+	req interface{}) (interface{}, error) {
+
+	return f(ctx, method, req)
+}
+
+// DefaultResponder synthesizes spec-valid responses for all of the
+// MutatingMethods. The IDs of created volumes and snapshots are derived
+// from the requested names so that repeated calls return the same IDs.
+// Custom responders may delegate to DefaultResponder for the requests
+// they do not handle.
+var DefaultResponder Responder = ResponderFunc(defaultRespond)
+
+func defaultRespond(
+	ctx context.Context,
+	method string,
+	req interface{}) (interface{}, error) {
+
+	switch treq := req.(type) {
+	case *csi.CreateVolumeRequest:
+		vol := &csi.Volume{
+			VolumeId:      dryRunID(treq.Name),
+			CapacityBytes: treq.GetCapacityRange().GetRequiredBytes(),
+			ContentSource: treq.VolumeContentSource,
+		}
+		if vol.CapacityBytes == 0 {
+			vol.CapacityBytes = treq.GetCapacityRange().GetLimitBytes()
+		}
+		if ar := treq.AccessibilityRequirements; ar != nil {
+			if len(ar.Preferred) > 0 {
+				vol.AccessibleTopology = ar.Preferred[:1]
+			} else if len(ar.Requisite) > 0 {
+				vol.AccessibleTopology = ar.Requisite[:1]
+			}
+		}
+		return &csi.CreateVolumeResponse{Volume: vol}, nil
+	case *csi.DeleteVolumeRequest:
+		return &csi.DeleteVolumeResponse{}, nil
+	case *csi.ControllerPublishVolumeRequest:
+		return &csi.ControllerPublishVolumeResponse{
+			PublishContext: map[string]string{"dryRun": "true"},
+		}, nil
+	case *csi.ControllerUnpublishVolumeRequest:
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	case *csi.ControllerExpandVolumeRequest:
+		return &csi.ControllerExpandVolumeResponse{
+			CapacityBytes: treq.GetCapacityRange().GetRequiredBytes(),
+		}, nil
+	case *csi.ControllerModifyVolumeRequest:
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	case *csi.CreateSnapshotRequest:
+		return &csi.CreateSnapshotResponse{
+			Snapshot: &csi.Snapshot{
+				SnapshotId:     dryRunID(treq.Name),
+				SourceVolumeId: treq.SourceVolumeId,
+				CreationTime:   ptypes.TimestampNow(),
+				ReadyToUse:     true,
+			},
+		}, nil
+	case *csi.DeleteSnapshotRequest:
+		return &csi.DeleteSnapshotResponse{}, nil
+	case *csi.CreateVolumeGroupSnapshotRequest:
+		var (
+			id  = dryRunID(treq.Name)
+			now = ptypes.TimestampNow()
+			g   = &csi.VolumeGroupSnapshot{
+				GroupSnapshotId: id,
+				CreationTime:    now,
+				ReadyToUse:      true,
+			}
+		)
+		for _, volID := range treq.SourceVolumeIds {
+			g.Snapshots = append(g.Snapshots, &csi.Snapshot{
+				SnapshotId:      dryRunID(treq.Name + "/" + volID),
+				SourceVolumeId:  volID,
+				GroupSnapshotId: id,
+				CreationTime:    now,
+				ReadyToUse:      true,
+			})
+		}
+		return &csi.CreateVolumeGroupSnapshotResponse{GroupSnapshot: g}, nil
+	case *csi.DeleteVolumeGroupSnapshotRequest:
+		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+	case *csi.NodeStageVolumeRequest:
+		return &csi.NodeStageVolumeResponse{}, nil
+	case *csi.NodeUnstageVolumeRequest:
+		return &csi.NodeUnstageVolumeResponse{}, nil
+	case *csi.NodePublishVolumeRequest:
+		return &csi.NodePublishVolumeResponse{}, nil
+	case *csi.NodeUnpublishVolumeRequest:
+		return &csi.NodeUnpublishVolumeResponse{}, nil
+	case *csi.NodeExpandVolumeRequest:
+		return &csi.NodeExpandVolumeResponse{
+			CapacityBytes: treq.GetCapacityRange().GetRequiredBytes(),
+		}, nil
+	}
+	return nil, status.Errorf(codes.Unimplemented,
+		"dry run: no response for %s", method)
+}
+
+// dryRunID returns an ID derived from the given name.
+func dryRunID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return "dryrun-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,409 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+)
+
+// InjectedCounts is the number of injected faults, keyed by action. The
+// counts are published with expvar as csi_faults_injected.
+var InjectedCounts = expvar.NewMap("csi_faults_injected")
+
+// Action is what a rule does to the calls it matches.
+type Action string
+
+const (
+	// ActionError fails the call with the rule's code without invoking
+	// the handler.
+	ActionError Action = "error"
+
+	// ActionLatency delays the call by the rule's latency before invoking
+	// the handler.
+	ActionLatency Action = "latency"
+
+	// ActionFailAfter invokes the handler and then fails the call with
+	// the rule's code, so the call's side effects happen but the caller
+	// sees an error.
+	ActionFailAfter Action = "fail-after"
+
+	// ActionHang blocks the call until its deadline is exceeded or it is
+	// canceled, without invoking the handler.
+	ActionHang Action = "hang"
+)
+
+// Duration is a time.Duration that is encoded in JSON as a duration
+// string, ex. "1.5s".
+type Duration time.Duration
+
+// MarshalJSON returns the duration string of d.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule describes the fault injected into the calls it matches. The
+// rules are evaluated in order and the first rule that matches a call,
+// and whose probability is met, is applied.
+type Rule struct {
+	// Name identifies the rule in the log.
+	Name string `json:"name,omitempty"`
+
+	// Method is a regular expression matched against the call's full
+	// gRPC method name, ex. "/csi.v1.Controller/CreateVolume". Every
+	// method matches if empty.
+	Method string `json:"method,omitempty"`
+
+	// VolumeID is a regular expression matched against the request's
+	// volume IDs, including source volume IDs. Every call matches if
+	// empty, and calls without a volume ID do not match otherwise.
+	VolumeID string `json:"volumeID,omitempty"`
+
+	// Probability is the probability, from 0 to 1, that the rule is
+	// applied to a matching call. The rule is always applied if nil.
+	Probability *float64 `json:"probability,omitempty"`
+
+	// Action is what the rule does to the call.
+	Action Action `json:"action"`
+
+	// Code and Message are the gRPC status returned by the error and
+	// fail-after actions. The code may be given as its name, ex.
+	// "UNAVAILABLE", or its value.
+	Code    codes.Code `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+
+	// Latency is the delay added by the latency action.
+	Latency Duration `json:"latency,omitempty"`
+}
+
+// ParseRules parses a JSON array of rules.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("faultinject: invalid rules: %v", err)
+	}
+	return rules, nil
+}
+
+// ReadRulesFile reads a JSON array of rules from the given file.
+func ReadRulesFile(path string) ([]Rule, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(buf)
+}
+
+type rule struct {
+	Rule
+	method *regexp.Regexp
+	volID  *regexp.Regexp
+}
+
+func compileRules(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, len(rules))
+	for j, r := range rules {
+		c := rule{Rule: r}
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", j)
+		}
+		var err error
+		if r.Method != "" {
+			if c.method, err = regexp.Compile(r.Method); err != nil {
+				return nil, fmt.Errorf(
+					"faultinject: rule %s: invalid method: %v", name, err)
+			}
+		}
+		if r.VolumeID != "" {
+			if c.volID, err = regexp.Compile(r.VolumeID); err != nil {
+				return nil, fmt.Errorf(
+					"faultinject: rule %s: invalid volumeID: %v", name, err)
+			}
+		}
+		if p := r.Probability; p != nil && (*p < 0 || *p > 1) {
+			return nil, fmt.Errorf(
+				"faultinject: rule %s: invalid probability: %v", name, *p)
+		}
+		switch r.Action {
+		case ActionError, ActionFailAfter:
+			if r.Code == codes.OK {
+				return nil, fmt.Errorf(
+					"faultinject: rule %s: %s requires a code", name, r.Action)
+			}
+		case ActionLatency:
+			if r.Latency <= 0 {
+				return nil, fmt.Errorf(
+					"faultinject: rule %s: latency must be positive", name)
+			}
+		case ActionHang:
+		default:
+			return nil, fmt.Errorf(
+				"faultinject: rule %s: invalid action: %q", name, r.Action)
+		}
+		compiled[j] = c
+	}
+	return compiled, nil
+}
+
+// Option configures the fault injector.
+type Option func(*opts)
+
+type opts struct {
+	rules []Rule
+	src   rand.Source
+}
+
+// WithRules is an Option that sets the injector's initial rules.
+func WithRules(rules ...Rule) Option {
+	return func(o *opts) {
+		o.rules = append(o.rules, rules...)
+	}
+}
+
+// WithRandSource is an Option that sets the source of the random numbers
+// used to apply the rules' probabilities.
+func WithRandSource(src rand.Source) Option {
+	return func(o *opts) {
+		o.src = src
+	}
+}
+
+// Injector provides a server-side, gRPC interceptor that injects faults
+// into the calls that match its rules. The rules may be changed at
+// runtime with SetRules or the injector's HTTP handler. Every injected
+// fault is logged and counted.
+type Injector struct {
+	opts opts
+
+	rulesL sync.RWMutex
+	rules  []rule
+
+	randL sync.Mutex
+	rand  *rand.Rand
+}
+
+// New returns a new fault injector. An error is returned if the rules
+// are invalid.
+func New(opts ...Option) (*Injector, error) {
+	i := &Injector{}
+	for _, setOpt := range opts {
+		setOpt(&i.opts)
+	}
+	if i.opts.src == nil {
+		i.opts.src = rand.NewSource(time.Now().UnixNano())
+	}
+	i.rand = rand.New(i.opts.src)
+	if err := i.SetRules(i.opts.rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Rules returns the injector's rules.
+func (i *Injector) Rules() []Rule {
+	i.rulesL.RLock()
+	defer i.rulesL.RUnlock()
+	rules := make([]Rule, len(i.rules))
+	for j, r := range i.rules {
+		rules[j] = r.Rule
+	}
+	return rules
+}
+
+// SetRules replaces the injector's rules. The rules are unchanged if
+// any of the new rules is invalid.
+func (i *Injector) SetRules(rules []Rule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	i.rulesL.Lock()
+	defer i.rulesL.Unlock()
+	i.rules = compiled
+	log.WithField("rules", len(compiled)).Info("faultinject: rules set")
+	return nil
+}
+
+// Handle is a server-side, gRPC interceptor that injects a fault if the
+// call matches one of the injector's rules.
+func (i *Injector) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	r, ok := i.match(info.FullMethod, req)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	fields := map[string]interface{}{
+		"method": info.FullMethod,
+		"action": r.Action,
+	}
+	if r.Name != "" {
+		fields["rule"] = r.Name
+	}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		fields["requestID"] = id
+	}
+	switch r.Action {
+	case ActionError, ActionFailAfter:
+		fields["code"] = r.Code
+	case ActionLatency:
+		fields["latency"] = time.Duration(r.Latency)
+	}
+	log.WithFields(fields).Warn("faultinject: fault injected")
+	InjectedCounts.Add(string(r.Action), 1)
+
+	switch r.Action {
+	case ActionError:
+		return nil, status.Error(r.Code, r.message())
+	case ActionLatency:
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(time.Duration(r.Latency)):
+		}
+		return handler(ctx, req)
+	case ActionFailAfter:
+		if _, err := handler(ctx, req); err != nil {
+			return nil, err
+		}
+		return nil, status.Error(r.Code, r.message())
+	case ActionHang:
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return handler(ctx, req)
+}
+
+func (r rule) message() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return "injected fault"
+}
+
+// match returns the first rule that matches the call and whose
+// probability is met.
+func (i *Injector) match(method string, req interface{}) (rule, bool) {
+	i.rulesL.RLock()
+	defer i.rulesL.RUnlock()
+
+	var volIDs []string
+	for _, r := range i.rules {
+		if r.method != nil && !r.method.MatchString(method) {
+			continue
+		}
+		if r.volID != nil {
+			if volIDs == nil {
+				volIDs = volumeIDs(req)
+			}
+			if !matchAny(r.volID, volIDs) {
+				continue
+			}
+		}
+		if p := r.Probability; p != nil && !i.roll(*p) {
+			continue
+		}
+		return r, true
+	}
+	return rule{}, false
+}
+
+func (i *Injector) roll(p float64) bool {
+	i.randL.Lock()
+	defer i.randL.Unlock()
+	return i.rand.Float64() < p
+}
+
+func matchAny(rx *regexp.Regexp, ids []string) bool {
+	for _, id := range ids {
+		if rx.MatchString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeIDs returns the volume IDs of the request. The returned slice
+// is non-nil.
+func volumeIDs(req interface{}) []string {
+	ids := []string{}
+	if r, ok := req.(interface {
+		GetVolumeId() string
+	}); ok && r.GetVolumeId() != "" {
+		ids = append(ids, r.GetVolumeId())
+	}
+	if r, ok := req.(interface {
+		GetSourceVolumeId() string
+	}); ok && r.GetSourceVolumeId() != "" {
+		ids = append(ids, r.GetSourceVolumeId())
+	}
+	if r, ok := req.(interface {
+		GetSourceVolumeIds() []string
+	}); ok {
+		ids = append(ids, r.GetSourceVolumeIds()...)
+	}
+	return ids
+}
+
+// ServeHTTP is the injector's admin endpoint. GET returns the rules as
+// a JSON array, PUT replaces them with the JSON array in the request
+// body, and DELETE removes them.
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules, err := ParseRules(buf)
+		if err == nil {
+			err = i.SetRules(rules)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		i.SetRules(nil)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(i.Rules())
+}
@@ -0,0 +1,211 @@
+package faultinject_test
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/faultinject"
+)
+
+const deleteVolume = "/csi.v1.Controller/DeleteVolume"
+
+// invoke calls the interceptor and returns a flag indicating whether the
+// handler was invoked, and the error.
+func invoke(
+	ctx context.Context,
+	i *faultinject.Injector,
+	method string,
+	req interface{}) (bool, error) {
+
+	var called bool
+	_, err := i.Handle(
+		ctx,
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return &csi.DeleteVolumeResponse{}, nil
+		})
+	return called, err
+}
+
+func newInjector(t *testing.T, rules ...faultinject.Rule) *faultinject.Injector {
+	i, err := faultinject.New(faultinject.WithRules(rules...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestFaultInject_Error(t *testing.T) {
+	i := newInjector(t, faultinject.Rule{
+		Method:   "/DeleteVolume$",
+		VolumeID: "^bad-",
+		Action:   faultinject.ActionError,
+		Code:     codes.Unavailable,
+	})
+	ctx := context.Background()
+
+	called, err := invoke(ctx, i, deleteVolume,
+		&csi.DeleteVolumeRequest{VolumeId: "bad-1"})
+	if called || status.Code(err) != codes.Unavailable {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+
+	// The volume ID does not match.
+	called, err = invoke(ctx, i, deleteVolume,
+		&csi.DeleteVolumeRequest{VolumeId: "good-1"})
+	if !called || err != nil {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+
+	// The method does not match.
+	called, err = invoke(ctx, i, "/csi.v1.Node/NodeUnpublishVolume",
+		&csi.NodeUnpublishVolumeRequest{VolumeId: "bad-1"})
+	if !called || err != nil {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+}
+
+func TestFaultInject_FailAfter(t *testing.T) {
+	i := newInjector(t, faultinject.Rule{
+		Action:  faultinject.ActionFailAfter,
+		Code:    codes.DeadlineExceeded,
+		Message: "timed out",
+	})
+	called, err := invoke(context.Background(), i, deleteVolume,
+		&csi.DeleteVolumeRequest{VolumeId: "1"})
+	if !called || status.Code(err) != codes.DeadlineExceeded ||
+		status.Convert(err).Message() != "timed out" {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+}
+
+func TestFaultInject_LatencyAndHang(t *testing.T) {
+	i := newInjector(t, faultinject.Rule{
+		Method:  "DeleteVolume",
+		Action:  faultinject.ActionLatency,
+		Latency: faultinject.Duration(20 * time.Millisecond),
+	}, faultinject.Rule{
+		Action: faultinject.ActionHang,
+	})
+
+	start := time.Now()
+	called, err := invoke(context.Background(), i, deleteVolume,
+		&csi.DeleteVolumeRequest{VolumeId: "1"})
+	if !called || err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 20*time.Millisecond)
+	defer cancel()
+	called, err = invoke(ctx, i, "/csi.v1.Identity/Probe",
+		&csi.ProbeRequest{})
+	if called || status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("called=%v, err=%v", called, err)
+	}
+}
+
+func TestFaultInject_Probability(t *testing.T) {
+	p := 0.5
+	i, err := faultinject.New(
+		faultinject.WithRandSource(rand.NewSource(1)),
+		faultinject.WithRules(faultinject.Rule{
+			Probability: &p,
+			Action:      faultinject.ActionError,
+			Code:        codes.Aborted,
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var faults int
+	for j := 0; j < 1000; j++ {
+		if _, err := invoke(context.Background(), i, deleteVolume,
+			&csi.DeleteVolumeRequest{VolumeId: "1"}); err != nil {
+			faults++
+		}
+	}
+	if faults < 400 || faults > 600 {
+		t.Fatalf("faults=%d", faults)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := faultinject.ParseRules([]byte(`[
+		{"method": "CreateVolume", "action": "error", "code": "UNAVAILABLE"},
+		{"action": "latency", "latency": "1.5s"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Code != codes.Unavailable ||
+		time.Duration(rules[1].Latency) != 1500*time.Millisecond {
+		t.Fatalf("rules=%+v", rules)
+	}
+
+	for _, r := range []faultinject.Rule{
+		{Action: "explode"},
+		{Action: faultinject.ActionError},
+		{Action: faultinject.ActionLatency},
+		{Method: "(", Action: faultinject.ActionHang},
+	} {
+		if _, err := faultinject.New(faultinject.WithRules(r)); err == nil {
+			t.Fatalf("rule=%+v: expected error", r)
+		}
+	}
+}
+
+func TestFaultInject_Admin(t *testing.T) {
+	i := newInjector(t)
+	srv := httptest.NewServer(i)
+	defer srv.Close()
+
+	put := func(body string) int {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL,
+			strings.NewReader(body))
+		rep, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep.Body.Close()
+		return rep.StatusCode
+	}
+
+	if c := put(`[{"action": "error", "code": 14}]`); c != http.StatusOK {
+		t.Fatalf("status=%d", c)
+	}
+	if _, err := invoke(context.Background(), i, deleteVolume,
+		&csi.DeleteVolumeRequest{VolumeId: "1"}); status.Code(err) !=
+		codes.Unavailable {
+		t.Fatalf("err=%v", err)
+	}
+
+	// Invalid rules do not replace the current rules.
+	if c := put(`[{"action": "error"}]`); c != http.StatusBadRequest {
+		t.Fatalf("status=%d", c)
+	}
+	if len(i.Rules()) != 1 {
+		t.Fatalf("rules=%+v", i.Rules())
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	rep, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.Body.Close()
+	if len(i.Rules()) != 0 {
+		t.Fatalf("rules=%+v", i.Rules())
+	}
+}
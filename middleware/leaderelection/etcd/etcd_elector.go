@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	etcd "go.etcd.io/etcd/client/v3"
+	etcdsync "go.etcd.io/etcd/client/v3/concurrency"
+
+	csictx "github.com/rexray/gocsi/context"
+	lltypes "github.com/rexray/gocsi/middleware/leaderelection/types"
+	csietcd "github.com/rexray/gocsi/middleware/serialvolume/etcd"
+)
+
+// New returns a new etcd leader elector. The election's key prefix is
+// /DOMAIN/leaderElection/NAME, where DOMAIN is the value of the environment
+// variable X_CSI_SERIAL_VOL_ACCESS_ETCD_DOMAIN. The value id identifies
+// this process as the leader. If ttl is zero then the value of the
+// environment variable X_CSI_SERIAL_VOL_ACCESS_ETCD_TTL is used. If config
+// is nil then the client configuration is read from the same
+// X_CSI_SERIAL_VOL_ACCESS_ETCD_* environment variables used by the etcd
+// volume lock provider. The elector owns the etcd client it creates, and
+// closing the elector closes the client.
+func New(
+	ctx context.Context,
+	name, id string,
+	ttl time.Duration,
+	config *etcd.Config) (lltypes.Elector, error) {
+
+	if name == "" {
+		return nil, errors.New("etcd: election name required")
+	}
+
+	pfx := path.Join(
+		"/", csictx.Getenv(ctx, csietcd.EnvVarDomain), "leaderElection", name)
+
+	if ttl == 0 {
+		ttl, _ = time.ParseDuration(csictx.Getenv(ctx, csietcd.EnvVarTTL))
+	}
+
+	if config == nil {
+		cfg, err := csietcd.NewConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		config = &cfg
+	}
+
+	log.WithFields(map[string]interface{}{
+		"leaderElection.etcd.prefix": pfx,
+		"leaderElection.etcd.id":     id,
+		"leaderElection.etcd.ttl":    ttl,
+	}).Info("creating leader election etcd elector")
+
+	client, err := etcd.New(*config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &elector{
+		client: client,
+		pfx:    pfx,
+		id:     id,
+		ttl:    int(ttl.Seconds()),
+	}, nil
+}
+
+type elector struct {
+	client *etcd.Client
+	pfx    string
+	id     string
+	ttl    int
+
+	sync.Mutex
+	sess *etcdsync.Session
+	elec *etcdsync.Election
+}
+
+func (e *elector) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	if e.sess != nil {
+		e.sess.Close()
+		e.sess = nil
+	}
+	return e.client.Close()
+}
+
+// Campaign creates a new session and campaigns for leadership with it.
+// A new session is required for each campaign since leadership is lost
+// when the previous session's lease expires.
+func (e *elector) Campaign(ctx context.Context) error {
+	var opts []etcdsync.SessionOption
+	if e.ttl > 0 {
+		opts = append(opts, etcdsync.WithTTL(e.ttl))
+	}
+	sess, err := etcdsync.NewSession(e.client, opts...)
+	if err != nil {
+		return err
+	}
+	elec := etcdsync.NewElection(sess, e.pfx)
+	if err := elec.Campaign(ctx, e.id); err != nil {
+		sess.Close()
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.sess = sess
+	e.elec = elec
+	return nil
+}
+
+func (e *elector) Done() <-chan struct{} {
+	e.Lock()
+	defer e.Unlock()
+	if e.sess == nil {
+		return nil
+	}
+	return e.sess.Done()
+}
+
+func (e *elector) Resign(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.sess == nil {
+		return nil
+	}
+	err := e.elec.Resign(ctx)
+	e.sess.Close()
+	e.sess = nil
+	e.elec = nil
+	return err
+}
@@ -0,0 +1,99 @@
+package etcd_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	lletcd "github.com/rexray/gocsi/middleware/leaderelection/etcd"
+)
+
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	u, _ := url.Parse(fmt.Sprintf("http://%s", l.Addr()))
+	return *u
+}
+
+func TestElector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocsi-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := embed.NewConfig()
+	cfg.LogLevel = "error"
+	cfg.Dir = dir
+	curl, purl := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{curl}, []url.URL{curl}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{purl}, []url.URL{purl}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	srv, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	<-srv.Server.ReadyNotify()
+
+	ctx := context.Background()
+	config := &etcd.Config{
+		Endpoints:   []string{curl.String()},
+		DialTimeout: time.Second,
+	}
+	e1, err := lletcd.New(ctx, "test", "e1", time.Second*5, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e1.(io.Closer).Close()
+	e2, err := lletcd.New(ctx, "test", "e2", time.Second*5, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e2.(io.Closer).Close()
+
+	if err := e1.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// e2 cannot be elected while e1 is the leader.
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond*200)
+	defer cancel()
+	if err := e2.Campaign(cctx); err == nil {
+		t.Fatal("two leaders elected")
+	}
+
+	// e2 is elected once e1 resigns, and e1's done channel is closed.
+	done := e1.Done()
+	elected := make(chan error)
+	go func() { elected <- e2.Campaign(ctx) }()
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-elected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("e2 not elected")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second * 10):
+		t.Fatal("done not closed after resign")
+	}
+	e2.Resign(ctx)
+}
@@ -0,0 +1,65 @@
+package flock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akutz/gosync"
+)
+
+// errLock is a lock whose lock attempts always fail with an error.
+type errLock struct {
+	gosync.TryMutex
+	attempts int
+	closed   bool
+}
+
+func (l *errLock) TryLockWithError(timeout time.Duration) (bool, error) {
+	l.attempts++
+	return false, errors.New("no locks available")
+}
+
+func (l *errLock) UnlockWithError() error {
+	return nil
+}
+
+func (l *errLock) Close() error {
+	l.closed = true
+	return nil
+}
+
+type errLockProvider struct {
+	lock *errLock
+}
+
+func (p *errLockProvider) GetLockWithID(
+	ctx context.Context, id string) (gosync.TryLocker, error) {
+	return p.lock, nil
+}
+
+func (p *errLockProvider) GetLockWithName(
+	ctx context.Context, name string) (gosync.TryLocker, error) {
+	return p.lock, nil
+}
+
+func TestCampaign_LockError(t *testing.T) {
+	l := &errLock{}
+	e := &elector{p: &errLockProvider{lock: l}, name: "test"}
+
+	// A lock error other than contention ends the campaign instead of
+	// being retried forever.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := e.Campaign(ctx); err == nil ||
+		err.Error() != "no locks available" {
+		t.Fatalf("err=%v", err)
+	}
+	if l.attempts != 1 {
+		t.Fatalf("attempts=%d", l.attempts)
+	}
+	if !l.closed {
+		t.Fatal("lock not closed")
+	}
+}
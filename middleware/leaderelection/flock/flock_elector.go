@@ -0,0 +1,135 @@
+package flock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/akutz/gosync"
+	log "github.com/sirupsen/logrus"
+
+	lltypes "github.com/rexray/gocsi/middleware/leaderelection/types"
+	csiflock "github.com/rexray/gocsi/middleware/serialvolume/flock"
+	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
+)
+
+const (
+	// campaignTimeout is the timeout used for each attempt to obtain the
+	// leadership lock. Campaign retries until its context is done.
+	campaignTimeout = time.Hour
+
+	// campaignPollTimeout is the timeout used for each attempt when the
+	// lock cannot observe the campaign's context, so that Campaign checks
+	// the context between attempts.
+	campaignPollTimeout = time.Second
+)
+
+// New returns a new flock leader elector that holds an advisory lock on a
+// file in the directory dir for as long as it is the leader. Processes on
+// the same host that use the same dir and name take part in the same
+// election. If pollInterval is zero then the value of the environment
+// variable X_CSI_SERIAL_VOL_ACCESS_FLOCK_POLL_INTERVAL is used.
+func New(
+	ctx context.Context,
+	dir, name string,
+	pollInterval time.Duration) (lltypes.Elector, error) {
+
+	if dir == "" {
+		return nil, errors.New("flock: lock directory required")
+	}
+	if name == "" {
+		return nil, errors.New("flock: election name required")
+	}
+
+	p, err := csiflock.New(ctx, dir, pollInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"leaderElection.flock.dir":  dir,
+		"leaderElection.flock.name": name,
+	}).Info("creating leader election flock elector")
+
+	return &elector{p: p, name: name}, nil
+}
+
+type elector struct {
+	p    mwtypes.VolumeLockerProvider
+	name string
+
+	sync.Mutex
+	lock gosync.TryLocker
+	done chan struct{}
+}
+
+func (e *elector) Campaign(ctx context.Context) error {
+	lock, err := e.p.GetLockWithName(ctx, e.name)
+	if err != nil {
+		return err
+	}
+	timeout := campaignPollTimeout
+	if m, ok := lock.(*csiflock.TryMutex); ok {
+		m.TryLockCtx = ctx
+		timeout = campaignTimeout
+	}
+	for {
+		ok, err := tryLock(lock, timeout)
+		if ok {
+			break
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			closeLock(lock)
+			return err
+		}
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.lock = lock
+	e.done = make(chan struct{})
+	return nil
+}
+
+// tryLock attempts to obtain the lock, returning any error other than
+// lock contention if the lock is able to report one.
+func tryLock(lock gosync.TryLocker, timeout time.Duration) (bool, error) {
+	if l, ok := lock.(mwtypes.TryLockerWithError); ok {
+		return l.TryLockWithError(timeout)
+	}
+	return lock.TryLock(timeout), nil
+}
+
+func closeLock(lock gosync.TryLocker) error {
+	if c, ok := lock.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Done returns a channel that is closed only by Resign, since a file
+// lock is held until it is released or the process exits.
+func (e *elector) Done() <-chan struct{} {
+	e.Lock()
+	defer e.Unlock()
+	return e.done
+}
+
+func (e *elector) Resign(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.lock == nil {
+		return nil
+	}
+	e.lock.Unlock()
+	err := closeLock(e.lock)
+	e.lock = nil
+	close(e.done)
+	e.done = nil
+	return err
+}
@@ -0,0 +1,57 @@
+package flock_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	llflock "github.com/rexray/gocsi/middleware/leaderelection/flock"
+)
+
+func TestElector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocsi-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	e1, err := llflock.New(ctx, dir, "test", time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, err := llflock.New(ctx, dir, "test", time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e1.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	done := e1.Done()
+
+	// e2 cannot be elected while e1 is the leader.
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	if err := e2.Campaign(cctx); err == nil {
+		t.Fatal("two leaders elected")
+	}
+
+	// e2 is elected once e1 resigns.
+	elected := make(chan error)
+	go func() { elected <- e2.Campaign(ctx) }()
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("done not closed by resign")
+	}
+	if err := <-elected; err != nil {
+		t.Fatal(err)
+	}
+	e2.Resign(ctx)
+}
@@ -0,0 +1,251 @@
+package leaderelection
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	log "github.com/sirupsen/logrus"
+	xctx "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lltypes "github.com/rexray/gocsi/middleware/leaderelection/types"
+	"github.com/rexray/gocsi/utils"
+)
+
+const (
+	notLeader = "not leader"
+
+	// DefaultHandoverTimeout is the default amount of time a leader
+	// waits for in-flight Controller RPCs to complete when stepping down.
+	DefaultHandoverTimeout = time.Second * 5
+
+	// retryInterval is the time to wait before campaigning again after
+	// a campaign fails.
+	retryInterval = time.Second
+)
+
+// Option configures the leader election.
+type Option func(*opts)
+
+type opts struct {
+	handoverTimeout  time.Duration
+	onStartedLeading func(context.Context)
+	onStoppedLeading func()
+	servesNode       bool
+}
+
+// WithHandoverTimeout is an Option that sets the amount of time a leader
+// waits for in-flight Controller RPCs to complete when stepping down.
+func WithHandoverTimeout(t time.Duration) Option {
+	return func(o *opts) {
+		o.handoverTimeout = t
+	}
+}
+
+// WithOnStartedLeading is an Option that sets a function that is invoked
+// in a new goroutine when leadership is obtained. The provided context is
+// canceled when leadership is lost.
+func WithOnStartedLeading(f func(context.Context)) Option {
+	return func(o *opts) {
+		o.onStartedLeading = f
+	}
+}
+
+// WithOnStoppedLeading is an Option that sets a function that is invoked
+// after leadership is lost and in-flight Controller RPCs have drained.
+func WithOnStoppedLeading(f func()) Option {
+	return func(o *opts) {
+		o.onStoppedLeading = f
+	}
+}
+
+// WithNodeService is an Option that indicates the Node service is served
+// alongside the Controller service. Probe is then always handled by the
+// plug-in, since the Node service is ready whether or not this process is
+// the leader.
+func WithNodeService() Option {
+	return func(o *opts) {
+		o.servesNode = true
+	}
+}
+
+// LeaderElection campaigns for leadership and provides a server-side,
+// gRPC interceptor that only allows the leader to handle Controller RPCs.
+// Non-leaders respond to Controller RPCs with codes.Unavailable and, unless
+// the Node service is also served, to Probe with a response that indicates
+// the plug-in is not ready.
+type LeaderElection struct {
+	opts    opts
+	elector lltypes.Elector
+
+	leader   bool
+	leaderL  sync.RWMutex
+	inflight sync.WaitGroup
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	closed sync.Once
+}
+
+// New returns a new leader election that uses the provided elector. The
+// leader election takes ownership of the elector, and Stop closes it if
+// it implements io.Closer.
+func New(e lltypes.Elector, opts ...Option) *LeaderElection {
+	l := &LeaderElection{elector: e}
+	l.opts.handoverTimeout = DefaultHandoverTimeout
+
+	// Configure the leader election's options.
+	for _, setOpt := range opts {
+		setOpt(&l.opts)
+	}
+
+	return l
+}
+
+// IsLeader returns a flag indicating whether or not this process is the
+// leader.
+func (l *LeaderElection) IsLeader() bool {
+	l.leaderL.RLock()
+	defer l.leaderL.RUnlock()
+	return l.leader
+}
+
+// Start begins campaigning for leadership in a new goroutine.
+func (l *LeaderElection) Start(ctx context.Context) {
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		l.run(ctx)
+	}()
+}
+
+// Stop steps down if this process is the leader, waiting up to the
+// handover timeout for in-flight Controller RPCs to complete, and then
+// resigns so that another process may be elected without waiting for
+// this process's leadership to expire. The elector is then closed.
+func (l *LeaderElection) Stop() {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+	}
+	l.closed.Do(func() {
+		if c, ok := l.elector.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.WithError(err).Warn("leader election close failed")
+			}
+		}
+	})
+}
+
+func (l *LeaderElection) run(ctx context.Context) {
+	for {
+		if err := l.elector.Campaign(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.WithError(err).Error("leader election campaign failed")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+				continue
+			}
+		}
+
+		log.Info("started leading")
+		leadCtx, cancel := context.WithCancel(ctx)
+		l.setLeader(true)
+		if f := l.opts.onStartedLeading; f != nil {
+			go f(leadCtx)
+		}
+
+		select {
+		case <-l.elector.Done():
+			log.Warn("leadership lost")
+		case <-ctx.Done():
+		}
+		cancel()
+
+		l.setLeader(false)
+		l.drain()
+
+		resignCtx, resignCancel := context.WithTimeout(
+			context.Background(), l.opts.handoverTimeout)
+		if err := l.elector.Resign(resignCtx); err != nil {
+			log.WithError(err).Warn("leader election resign failed")
+		}
+		resignCancel()
+
+		log.Info("stopped leading")
+		if f := l.opts.onStoppedLeading; f != nil {
+			f()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (l *LeaderElection) setLeader(v bool) {
+	l.leaderL.Lock()
+	defer l.leaderL.Unlock()
+	l.leader = v
+}
+
+// drain waits up to the handover timeout for in-flight Controller RPCs
+// to complete.
+func (l *LeaderElection) drain() {
+	done := make(chan struct{})
+	go func() {
+		l.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(l.opts.handoverTimeout):
+		log.WithField("timeout", l.opts.handoverTimeout).Warn(
+			"leader handover timed out with in-flight controller RPCs")
+	}
+}
+
+// Handle is a server-side, gRPC interceptor that rejects Controller and
+// GroupController RPCs when this process is not the leader.
+func (l *LeaderElection) Handle(
+	ctx xctx.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	_, service, method, err := utils.ParseMethod(info.FullMethod)
+	if err != nil {
+		return handler(ctx, req)
+	}
+
+	switch service {
+	case "Controller", "GroupController":
+		l.leaderL.RLock()
+		if !l.leader {
+			l.leaderL.RUnlock()
+			return nil, status.Error(codes.Unavailable, notLeader)
+		}
+		l.inflight.Add(1)
+		l.leaderL.RUnlock()
+		defer l.inflight.Done()
+	case "Identity":
+		if method == "Probe" && !l.opts.servesNode && !l.IsLeader() {
+			return &csi.ProbeResponse{
+				Ready: &wrappers.BoolValue{Value: false},
+			}, nil
+		}
+	}
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,248 @@
+package leaderelection_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/leaderelection"
+)
+
+const (
+	createVolume = "/csi.v1.Controller/CreateVolume"
+	probe        = "/csi.v1.Identity/Probe"
+	nodePublish  = "/csi.v1.Node/NodePublishVolume"
+)
+
+// fakeElector grants leadership when a value is sent on grant and
+// loses it when lose is called.
+type fakeElector struct {
+	sync.Mutex
+	grant   chan struct{}
+	done    chan struct{}
+	resigns int
+	closes  int
+}
+
+func newFakeElector() *fakeElector {
+	return &fakeElector{grant: make(chan struct{})}
+}
+
+func (e *fakeElector) Campaign(ctx context.Context) error {
+	select {
+	case <-e.grant:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.Lock()
+	defer e.Unlock()
+	e.done = make(chan struct{})
+	return nil
+}
+
+func (e *fakeElector) Done() <-chan struct{} {
+	e.Lock()
+	defer e.Unlock()
+	return e.done
+}
+
+func (e *fakeElector) Resign(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+	e.resigns++
+	return nil
+}
+
+func (e *fakeElector) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	e.closes++
+	return nil
+}
+
+func (e *fakeElector) lose() {
+	e.Lock()
+	defer e.Unlock()
+	close(e.done)
+}
+
+func invoke(
+	l *leaderelection.LeaderElection,
+	method string,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	return l.Handle(
+		context.Background(),
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		handler)
+}
+
+func ok(ctx context.Context, req interface{}) (interface{}, error) {
+	return &csi.ProbeResponse{}, nil
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if f() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timed out")
+}
+
+func TestLeaderElection(t *testing.T) {
+	var (
+		e       = newFakeElector()
+		started = make(chan context.Context, 2)
+		stopped = make(chan struct{}, 2)
+	)
+
+	l := leaderelection.New(e,
+		leaderelection.WithOnStartedLeading(func(ctx context.Context) {
+			started <- ctx
+		}),
+		leaderelection.WithOnStoppedLeading(func() {
+			stopped <- struct{}{}
+		}))
+	l.Start(context.Background())
+	defer l.Stop()
+
+	// Non-leaders reject Controller RPCs, report not ready, and serve
+	// Node RPCs.
+	_, err := invoke(l, createVolume, ok)
+	if s, _ := status.FromError(err); s.Code() != codes.Unavailable {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+	res, err := invoke(l, probe, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := res.(*csi.ProbeResponse); r.Ready == nil || r.Ready.Value {
+		t.Fatalf("expected not ready: %v", r)
+	}
+	if _, err := invoke(l, nodePublish, ok); err != nil {
+		t.Fatal(err)
+	}
+
+	// Become the leader.
+	e.grant <- struct{}{}
+	leadCtx := <-started
+	waitFor(t, l.IsLeader)
+	if _, err := invoke(l, createVolume, ok); err != nil {
+		t.Fatal(err)
+	}
+	res, _ = invoke(l, probe, ok)
+	if r := res.(*csi.ProbeResponse); r.Ready != nil {
+		t.Fatalf("expected probe handler response: %v", r)
+	}
+
+	// Lose leadership while an RPC is in flight. The stopped callback
+	// must not fire until the RPC completes.
+	inRPC := make(chan struct{})
+	finishRPC := make(chan struct{})
+	go invoke(l, createVolume,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(inRPC)
+			<-finishRPC
+			return nil, nil
+		})
+	<-inRPC
+	e.lose()
+	<-leadCtx.Done()
+	waitFor(t, func() bool { return !l.IsLeader() })
+	select {
+	case <-stopped:
+		t.Fatal("stopped before in-flight RPC completed")
+	case <-time.After(time.Millisecond * 50):
+	}
+	close(finishRPC)
+	<-stopped
+
+	_, err = invoke(l, createVolume, ok)
+	if s, _ := status.FromError(err); s.Code() != codes.Unavailable {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+}
+
+func TestLeaderElection_HandoverTimeout(t *testing.T) {
+	var (
+		e       = newFakeElector()
+		stopped = make(chan struct{}, 1)
+	)
+	l := leaderelection.New(e,
+		leaderelection.WithHandoverTimeout(time.Millisecond*10),
+		leaderelection.WithOnStoppedLeading(func() {
+			stopped <- struct{}{}
+		}))
+	l.Start(context.Background())
+
+	e.grant <- struct{}{}
+	waitFor(t, l.IsLeader)
+
+	inRPC := make(chan struct{})
+	finishRPC := make(chan struct{})
+	defer close(finishRPC)
+	go invoke(l, createVolume,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(inRPC)
+			<-finishRPC
+			return nil, nil
+		})
+	<-inRPC
+
+	// Stop returns once the handover timeout elapses even though the
+	// RPC has not completed, and the elector is asked to resign.
+	l.Stop()
+	<-stopped
+	e.Lock()
+	defer e.Unlock()
+	if e.resigns != 1 {
+		t.Fatalf("resigns=%d", e.resigns)
+	}
+}
+
+func TestLeaderElection_StopClosesElector(t *testing.T) {
+	e := newFakeElector()
+	l := leaderelection.New(e)
+	l.Start(context.Background())
+	l.Stop()
+	l.Stop()
+	e.Lock()
+	defer e.Unlock()
+	if e.closes != 1 {
+		t.Fatalf("closes=%d", e.closes)
+	}
+}
+
+func TestLeaderElection_NodeService(t *testing.T) {
+	e := newFakeElector()
+	l := leaderelection.New(e, leaderelection.WithNodeService())
+	l.Start(context.Background())
+	defer l.Stop()
+
+	// Non-leaders still reject Controller RPCs, but Probe is handled by
+	// the plug-in since the Node service is ready.
+	_, err := invoke(l, createVolume, ok)
+	if s, _ := status.FromError(err); s.Code() != codes.Unavailable {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+	res, err := invoke(l, probe, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := res.(*csi.ProbeResponse); r.Ready != nil {
+		t.Fatalf("expected probe handler response: %v", r)
+	}
+	if _, err := invoke(l, nodePublish, ok); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,17 @@
+package types
+
+import "context"
+
+// Elector campaigns for leadership on behalf of a single process.
+type Elector interface {
+	// Campaign blocks until leadership is obtained, the context is
+	// canceled, or an error occurs.
+	Campaign(ctx context.Context) error
+
+	// Done returns a channel that is closed when leadership obtained
+	// with the last successful call to Campaign is lost.
+	Done() <-chan struct{}
+
+	// Resign gives up leadership so another process may be elected.
+	Resign(ctx context.Context) error
+}
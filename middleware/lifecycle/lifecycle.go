@@ -0,0 +1,402 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+)
+
+// ViolationCounts is the number of lifecycle violations, keyed by RPC.
+// The counts are published with expvar as csi_lifecycle_violations.
+var ViolationCounts = expvar.NewMap("csi_lifecycle_violations")
+
+// Option configures the lifecycle validator.
+type Option func(*opts)
+
+type opts struct {
+	enforce    bool
+	stateFile  string
+	controller bool
+	node       bool
+	ctrlrCaps  map[csi.ControllerServiceCapability_RPC_Type]bool
+	nodeCaps   map[csi.NodeServiceCapability_RPC_Type]bool
+}
+
+// WithEnforce is an Option that rejects out-of-order calls with the gRPC
+// error code FailedPrecondition. Otherwise out-of-order calls are logged
+// and counted, and passed to the next handler.
+func WithEnforce() Option {
+	return func(o *opts) {
+		o.enforce = true
+	}
+}
+
+// WithStateFile is an Option that persists the volumes' states to the
+// given file so they survive a restart.
+func WithStateFile(path string) Option {
+	return func(o *opts) {
+		o.stateFile = path
+	}
+}
+
+// WithControllerCapabilities is an Option that indicates the process
+// serves the Controller service and sets the capabilities it advertises.
+func WithControllerCapabilities(
+	caps ...*csi.ControllerServiceCapability) Option {
+
+	return func(o *opts) {
+		o.controller = true
+		o.ctrlrCaps = map[csi.ControllerServiceCapability_RPC_Type]bool{}
+		for _, c := range caps {
+			if rpc := c.GetRpc(); rpc != nil {
+				o.ctrlrCaps[rpc.Type] = true
+			}
+		}
+	}
+}
+
+// WithNodeCapabilities is an Option that indicates the process serves
+// the Node service and sets the capabilities it advertises.
+func WithNodeCapabilities(caps ...*csi.NodeServiceCapability) Option {
+	return func(o *opts) {
+		o.node = true
+		o.nodeCaps = map[csi.NodeServiceCapability_RPC_Type]bool{}
+		for _, c := range caps {
+			if rpc := c.GetRpc(); rpc != nil {
+				o.nodeCaps[rpc.Type] = true
+			}
+		}
+	}
+}
+
+// volumeState is the lifecycle state of a single volume.
+type volumeState struct {
+	// Published is the set of IDs of the nodes to which the volume is
+	// controller-published.
+	Published map[string]bool `json:"published,omitempty"`
+
+	// Staged is the set of the volume's staging target paths.
+	Staged map[string]bool `json:"staged,omitempty"`
+
+	// Targets maps the volume's target paths to the staging target paths
+	// from which they were published.
+	Targets map[string]string `json:"targets,omitempty"`
+}
+
+func (s *volumeState) empty() bool {
+	return len(s.Published) == 0 && len(s.Staged) == 0 && len(s.Targets) == 0
+}
+
+// Validator tracks the lifecycle of each volume in memory and provides a
+// server-side, gRPC interceptor that flags calls made out of the order
+// defined by the CSI specification: CreateVolume, ControllerPublishVolume,
+// NodeStageVolume, and NodePublishVolume, and the reverse for teardown.
+// Checks that span the Controller and Node services are only made when
+// the process serves both.
+type Validator struct {
+	opts opts
+
+	volsL sync.Mutex
+	vols  map[string]*volumeState
+}
+
+// New returns a new lifecycle validator. If a state file is configured
+// and exists then the volumes' states are loaded from it.
+func New(opts ...Option) (*Validator, error) {
+	v := &Validator{vols: map[string]*volumeState{}}
+	for _, setOpt := range opts {
+		setOpt(&v.opts)
+	}
+	if v.opts.stateFile != "" {
+		buf, err := ioutil.ReadFile(v.opts.stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(buf) > 0 {
+			if err := json.Unmarshal(buf, &v.vols); err != nil {
+				return nil, fmt.Errorf(
+					"lifecycle: invalid state file: %s: %v",
+					v.opts.stateFile, err)
+			}
+		}
+	}
+	return v, nil
+}
+
+func (v *Validator) hasControllerCap(
+	c csi.ControllerServiceCapability_RPC_Type) bool {
+	return v.opts.controller && v.opts.ctrlrCaps[c]
+}
+
+func (v *Validator) hasNodeCap(c csi.NodeServiceCapability_RPC_Type) bool {
+	return v.opts.node && v.opts.nodeCaps[c]
+}
+
+// Handle is a server-side, gRPC interceptor that validates the order of
+// volume lifecycle calls.
+func (v *Validator) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	v.volsL.Lock()
+	method, desc := v.check(req)
+	v.volsL.Unlock()
+
+	if desc != "" {
+		ViolationCounts.Add(method, 1)
+		fields := map[string]interface{}{
+			"method":    info.FullMethod,
+			"violation": desc,
+		}
+		if id, ok := csictx.GetRequestID(ctx); ok {
+			fields["requestID"] = id
+		}
+		log.WithFields(fields).Warn("lifecycle violation")
+		if v.opts.enforce {
+			return nil, status.Error(codes.FailedPrecondition, desc)
+		}
+	}
+
+	rep, err := handler(ctx, req)
+	if err != nil {
+		return rep, err
+	}
+
+	v.volsL.Lock()
+	defer v.volsL.Unlock()
+	if v.update(req, rep) {
+		v.save()
+	}
+	return rep, err
+}
+
+// check returns the name of the RPC and a description of the violation
+// if req is out of order. It must be called with volsL held.
+func (v *Validator) check(req interface{}) (string, string) {
+	switch treq := req.(type) {
+	case *csi.DeleteVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if s == nil {
+			break
+		}
+		if len(s.Published) > 0 {
+			return "DeleteVolume", fmt.Sprintf(
+				"DeleteVolume: volume %s is controller-published to node(s): %s",
+				treq.VolumeId, keys(s.Published))
+		}
+		if len(s.Staged) > 0 {
+			return "DeleteVolume", fmt.Sprintf(
+				"DeleteVolume: volume %s is staged at: %s",
+				treq.VolumeId, keys(s.Staged))
+		}
+	case *csi.ControllerUnpublishVolumeRequest:
+		// The node-side teardown can only be observed if this process
+		// also serves the Node service.
+		s := v.vols[treq.VolumeId]
+		if s == nil || !v.opts.node {
+			break
+		}
+		if len(s.Staged) > 0 {
+			return "ControllerUnpublishVolume", fmt.Sprintf(
+				"ControllerUnpublishVolume: volume %s is staged at: %s",
+				treq.VolumeId, keys(s.Staged))
+		}
+		if len(s.Targets) > 0 {
+			return "ControllerUnpublishVolume", fmt.Sprintf(
+				"ControllerUnpublishVolume: volume %s is published at: %s",
+				treq.VolumeId, targetKeys(s.Targets))
+		}
+	case *csi.NodeStageVolumeRequest:
+		if !v.hasControllerCap(
+			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME) {
+			break
+		}
+		if s := v.vols[treq.VolumeId]; s == nil || len(s.Published) == 0 {
+			return "NodeStageVolume", fmt.Sprintf(
+				"NodeStageVolume: volume %s is not controller-published",
+				treq.VolumeId)
+		}
+	case *csi.NodeUnstageVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if s == nil {
+			break
+		}
+		var targets []string
+		for t, sp := range s.Targets {
+			if sp == treq.StagingTargetPath {
+				targets = append(targets, t)
+			}
+		}
+		if len(targets) > 0 {
+			sort.Strings(targets)
+			return "NodeUnstageVolume", fmt.Sprintf(
+				"NodeUnstageVolume: volume %s is published from %s at: %s",
+				treq.VolumeId, treq.StagingTargetPath,
+				strings.Join(targets, ", "))
+		}
+	case *csi.NodePublishVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if v.hasNodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME) {
+			if s == nil || !s.Staged[treq.StagingTargetPath] {
+				return "NodePublishVolume", fmt.Sprintf(
+					"NodePublishVolume: volume %s is not staged at: %s",
+					treq.VolumeId, treq.StagingTargetPath)
+			}
+			break
+		}
+		if v.hasControllerCap(
+			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME) {
+			if s == nil || len(s.Published) == 0 {
+				return "NodePublishVolume", fmt.Sprintf(
+					"NodePublishVolume: volume %s is not controller-published",
+					treq.VolumeId)
+			}
+		}
+	}
+	return "", ""
+}
+
+func (v *Validator) volume(id string) *volumeState {
+	s := v.vols[id]
+	if s == nil {
+		s = &volumeState{}
+		v.vols[id] = s
+	}
+	return s
+}
+
+// update records the effect of the successful call req and returns a
+// flag indicating whether the state changed. It must be called with
+// volsL held.
+func (v *Validator) update(req, rep interface{}) bool {
+	switch treq := req.(type) {
+	case *csi.DeleteVolumeRequest:
+		if _, ok := v.vols[treq.VolumeId]; ok {
+			delete(v.vols, treq.VolumeId)
+			return true
+		}
+	case *csi.ControllerPublishVolumeRequest:
+		s := v.volume(treq.VolumeId)
+		if s.Published == nil {
+			s.Published = map[string]bool{}
+		}
+		s.Published[treq.NodeId] = true
+		return true
+	case *csi.ControllerUnpublishVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if s == nil {
+			break
+		}
+		// An empty node ID unpublishes the volume from all nodes.
+		if treq.NodeId == "" {
+			s.Published = nil
+		} else {
+			delete(s.Published, treq.NodeId)
+		}
+		v.prune(treq.VolumeId)
+		return true
+	case *csi.NodeStageVolumeRequest:
+		s := v.volume(treq.VolumeId)
+		if s.Staged == nil {
+			s.Staged = map[string]bool{}
+		}
+		s.Staged[treq.StagingTargetPath] = true
+		return true
+	case *csi.NodeUnstageVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if s == nil {
+			break
+		}
+		delete(s.Staged, treq.StagingTargetPath)
+		v.prune(treq.VolumeId)
+		return true
+	case *csi.NodePublishVolumeRequest:
+		s := v.volume(treq.VolumeId)
+		if s.Targets == nil {
+			s.Targets = map[string]string{}
+		}
+		s.Targets[treq.TargetPath] = treq.StagingTargetPath
+		return true
+	case *csi.NodeUnpublishVolumeRequest:
+		s := v.vols[treq.VolumeId]
+		if s == nil {
+			break
+		}
+		delete(s.Targets, treq.TargetPath)
+		v.prune(treq.VolumeId)
+		return true
+	}
+	return false
+}
+
+// prune forgets a volume once it is no longer published or staged.
+func (v *Validator) prune(id string) {
+	if s := v.vols[id]; s != nil && s.empty() {
+		delete(v.vols, id)
+	}
+}
+
+// save writes the volumes' states to the state file, if configured. It
+// must be called with volsL held.
+func (v *Validator) save() {
+	if v.opts.stateFile == "" {
+		return
+	}
+	buf, err := json.Marshal(v.vols)
+	if err != nil {
+		log.WithError(err).Error("lifecycle: failed to encode state")
+		return
+	}
+	tmp, err := ioutil.TempFile(
+		filepath.Dir(v.opts.stateFile), filepath.Base(v.opts.stateFile))
+	if err != nil {
+		log.WithError(err).Error("lifecycle: failed to save state")
+		return
+	}
+	_, err = tmp.Write(buf)
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), v.opts.stateFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.WithError(err).Error("lifecycle: failed to save state")
+	}
+}
+
+func keys(m map[string]bool) string {
+	s := make([]string, 0, len(m))
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
+
+func targetKeys(m map[string]string) string {
+	s := make([]string, 0, len(m))
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,192 @@
+package lifecycle_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/lifecycle"
+)
+
+func controllerCap(
+	t csi.ControllerServiceCapability_RPC_Type) *csi.ControllerServiceCapability {
+
+	return &csi.ControllerServiceCapability{
+		Type: &csi.ControllerServiceCapability_Rpc{
+			Rpc: &csi.ControllerServiceCapability_RPC{Type: t},
+		},
+	}
+}
+
+func nodeCap(t csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+	return &csi.NodeServiceCapability{
+		Type: &csi.NodeServiceCapability_Rpc{
+			Rpc: &csi.NodeServiceCapability_RPC{Type: t},
+		},
+	}
+}
+
+func newValidator(t *testing.T, opts ...lifecycle.Option) *lifecycle.Validator {
+	opts = append(opts,
+		lifecycle.WithEnforce(),
+		lifecycle.WithControllerCapabilities(
+			controllerCap(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME),
+			controllerCap(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME)),
+		lifecycle.WithNodeCapabilities(
+			nodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)))
+	v, err := lifecycle.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func invoke(v *lifecycle.Validator, method string, req interface{}) error {
+	_, err := v.Handle(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	return err
+}
+
+const (
+	ctrlrPublish   = "/csi.v1.Controller/ControllerPublishVolume"
+	ctrlrUnpublish = "/csi.v1.Controller/ControllerUnpublishVolume"
+	deleteVolume   = "/csi.v1.Controller/DeleteVolume"
+	nodeStage      = "/csi.v1.Node/NodeStageVolume"
+	nodeUnstage    = "/csi.v1.Node/NodeUnstageVolume"
+	nodePublish    = "/csi.v1.Node/NodePublishVolume"
+	nodeUnpublish  = "/csi.v1.Node/NodeUnpublishVolume"
+	stagingPath    = "/staging/1"
+	targetPath     = "/target/1"
+)
+
+func expectCode(t *testing.T, err error, exp codes.Code) {
+	t.Helper()
+	if c := status.Code(err); c != exp {
+		t.Fatalf("code=%v, expected %v: %v", c, exp, err)
+	}
+}
+
+func TestLifecycle_Order(t *testing.T) {
+	v := newValidator(t)
+
+	// Nothing may be staged or published before the volume is
+	// controller-published.
+	expectCode(t, invoke(v, nodeStage, &csi.NodeStageVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath,
+	}), codes.FailedPrecondition)
+
+	expectCode(t, invoke(v, ctrlrPublish, &csi.ControllerPublishVolumeRequest{
+		VolumeId: "1", NodeId: "n1",
+	}), codes.OK)
+
+	// NodePublish with a staging target path that was never staged.
+	expectCode(t, invoke(v, nodePublish, &csi.NodePublishVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath, TargetPath: targetPath,
+	}), codes.FailedPrecondition)
+
+	expectCode(t, invoke(v, nodeStage, &csi.NodeStageVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath,
+	}), codes.OK)
+	expectCode(t, invoke(v, nodePublish, &csi.NodePublishVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath, TargetPath: targetPath,
+	}), codes.OK)
+
+	// Teardown out of order.
+	expectCode(t, invoke(v, nodeUnstage, &csi.NodeUnstageVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath,
+	}), codes.FailedPrecondition)
+	expectCode(t, invoke(v, ctrlrUnpublish, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: "1", NodeId: "n1",
+	}), codes.FailedPrecondition)
+	expectCode(t, invoke(v, deleteVolume, &csi.DeleteVolumeRequest{
+		VolumeId: "1",
+	}), codes.FailedPrecondition)
+
+	// Teardown in order.
+	expectCode(t, invoke(v, nodeUnpublish, &csi.NodeUnpublishVolumeRequest{
+		VolumeId: "1", TargetPath: targetPath,
+	}), codes.OK)
+	expectCode(t, invoke(v, nodeUnstage, &csi.NodeUnstageVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath,
+	}), codes.OK)
+	expectCode(t, invoke(v, ctrlrUnpublish, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: "1", NodeId: "n1",
+	}), codes.OK)
+	expectCode(t, invoke(v, deleteVolume, &csi.DeleteVolumeRequest{
+		VolumeId: "1",
+	}), codes.OK)
+}
+
+func TestLifecycle_Capabilities(t *testing.T) {
+	// A node-only plug-in without STAGE_UNSTAGE_VOLUME publishes volumes
+	// directly.
+	v, err := lifecycle.New(
+		lifecycle.WithEnforce(),
+		lifecycle.WithNodeCapabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCode(t, invoke(v, nodePublish, &csi.NodePublishVolumeRequest{
+		VolumeId: "1", TargetPath: targetPath,
+	}), codes.OK)
+}
+
+func TestLifecycle_ReportOnly(t *testing.T) {
+	v, err := lifecycle.New(
+		lifecycle.WithNodeCapabilities(
+			nodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := int64(0)
+	if c, ok := lifecycle.ViolationCounts.Get(
+		"NodePublishVolume").(interface{ Value() int64 }); ok {
+		n = c.Value()
+	}
+
+	expectCode(t, invoke(v, nodePublish, &csi.NodePublishVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath, TargetPath: targetPath,
+	}), codes.OK)
+
+	c, ok := lifecycle.ViolationCounts.Get(
+		"NodePublishVolume").(interface{ Value() int64 })
+	if !ok || c.Value() != n+1 {
+		t.Fatalf("count=%v, expected %d", c, n+1)
+	}
+}
+
+func TestLifecycle_StateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	v := newValidator(t, lifecycle.WithStateFile(path))
+	expectCode(t, invoke(v, ctrlrPublish, &csi.ControllerPublishVolumeRequest{
+		VolumeId: "1", NodeId: "n1",
+	}), codes.OK)
+
+	// The state survives a restart.
+	v = newValidator(t, lifecycle.WithStateFile(path))
+	expectCode(t, invoke(v, deleteVolume, &csi.DeleteVolumeRequest{
+		VolumeId: "1",
+	}), codes.FailedPrecondition)
+	expectCode(t, invoke(v, nodeStage, &csi.NodeStageVolumeRequest{
+		VolumeId: "1", StagingTargetPath: stagingPath,
+	}), codes.OK)
+}
@@ -0,0 +1,276 @@
+// Package recorder provides a server-side, gRPC interceptor that records
+// every call to a versioned, JSON-lines file that may be replayed with
+// the replay package or "csc replay".
+//
+// A recording begins with a Header line that identifies the format and
+// its version, followed by an Entry line for each call. A file that is
+// appended to by more than one process contains a Header line for each.
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/middleware/secretguard"
+	"github.com/rexray/gocsi/utils"
+)
+
+const (
+	// Format identifies a recording.
+	Format = "gocsi.recording"
+
+	// Version is the version of the recording format written by this
+	// package. Recordings with a greater version may not be read.
+	Version = 1
+)
+
+// RedactedMetadata is the set of the keys of the gRPC metadata whose
+// values are redacted from the recording.
+var RedactedMetadata = map[string]bool{
+	"authorization": true,
+}
+
+// Header is the first line of a recording.
+type Header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// Entry is a single recorded call. The values of the request's secrets
+// are redacted.
+type Entry struct {
+	// Time is when the call was received.
+	Time time.Time `json:"time"`
+
+	// Duration is how long the call took.
+	Duration time.Duration `json:"duration"`
+
+	// Method is the call's full gRPC method name, ex.
+	// "/csi.v1.Controller/CreateVolume".
+	Method string `json:"method"`
+
+	// RequestID is the call's request ID, if any.
+	RequestID uint64 `json:"requestID,omitempty"`
+
+	// Metadata is the call's incoming gRPC metadata.
+	Metadata map[string][]string `json:"metadata,omitempty"`
+
+	// Request and Response are the JSON encodings of the call's request
+	// and response messages, using the messages' original field names.
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Code and Message are the gRPC status of the call.
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// Recorder provides a server-side, gRPC interceptor that writes an Entry
+// for every call. The interceptor should be placed early in the chain so
+// that the recorded responses and statuses are those seen by the client.
+type Recorder struct {
+	w io.Writer
+	c io.Closer
+
+	wL sync.Mutex
+}
+
+// New returns a new Recorder that writes the recording to w. The Header
+// is written immediately.
+func New(w io.Writer) (*Recorder, error) {
+	r := &Recorder{w: w}
+	if err := r.writeLine(Header{
+		Format:  Format,
+		Version: Version,
+		Time:    time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Open returns a new Recorder that appends the recording to the file at
+// the given path. The file is created if it does not exist.
+func Open(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.c = f
+	return r, nil
+}
+
+// Close closes the file opened by Open. No more entries are written once
+// the Recorder is closed.
+func (r *Recorder) Close() error {
+	r.wL.Lock()
+	defer r.wL.Unlock()
+	r.w = nil
+	if r.c == nil {
+		return nil
+	}
+	err := r.c.Close()
+	r.c = nil
+	return err
+}
+
+// Handle is a server-side, gRPC interceptor that records the call.
+func (r *Recorder) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	start := time.Now()
+	rep, err := handler(ctx, req)
+
+	e := Entry{
+		Time:     start.UTC(),
+		Duration: time.Since(start),
+		Method:   info.FullMethod,
+	}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		e.RequestID = id
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md) > 0 {
+		e.Metadata = map[string][]string{}
+		for k, v := range md {
+			if RedactedMetadata[strings.ToLower(k)] {
+				v = []string{secretguard.Redacted}
+			}
+			e.Metadata[k] = v
+		}
+	}
+	if m, ok := req.(proto.Message); ok {
+		e.Request = marshal(secretguard.RedactSecrets(m))
+	}
+	if m, ok := rep.(proto.Message); ok && err == nil &&
+		!utils.IsNilResponse(rep) {
+		e.Response = marshal(m)
+	}
+	if err != nil {
+		s := status.Convert(err)
+		e.Code = s.Code()
+		e.Message = s.Message()
+	}
+
+	if werr := r.writeLine(e); werr != nil {
+		log.WithError(werr).Error("recorder: failed to write entry")
+	}
+	return rep, err
+}
+
+func (r *Recorder) writeLine(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.wL.Lock()
+	defer r.wL.Unlock()
+	if r.w == nil {
+		return nil
+	}
+	_, err = r.w.Write(append(buf, '\n'))
+	return err
+}
+
+var marshaler = &jsonpb.Marshaler{OrigName: true}
+
+// Marshal returns the JSON encoding of m as it appears in a recording.
+func Marshal(m proto.Message) (json.RawMessage, error) {
+	s, err := marshaler.MarshalToString(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(s), nil
+}
+
+func marshal(m proto.Message) json.RawMessage {
+	buf, err := Marshal(m)
+	if err != nil {
+		log.WithError(err).Error("recorder: failed to marshal message")
+	}
+	return buf
+}
+
+// Read returns the entries of the recording read from rd. An error is
+// returned if the recording does not begin with a Header or if its
+// version is not supported.
+func Read(rd io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		header  bool
+		scan    = bufio.NewScanner(rd)
+	)
+	scan.Buffer(nil, 16*1024*1024)
+	for n := 1; scan.Scan(); n++ {
+		line := scan.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var h Header
+		if err := json.Unmarshal(line, &h); err != nil {
+			return nil, fmt.Errorf("recorder: line %d: %v", n, err)
+		}
+		if h.Format != "" {
+			if h.Format != Format {
+				return nil, fmt.Errorf(
+					"recorder: line %d: invalid format: %s", n, h.Format)
+			}
+			if h.Version > Version {
+				return nil, fmt.Errorf(
+					"recorder: line %d: unsupported version: %d",
+					n, h.Version)
+			}
+			header = true
+			continue
+		}
+		if !header {
+			return nil, fmt.Errorf("recorder: line %d: missing header", n)
+		}
+
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("recorder: line %d: %v", n, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReadFile returns the entries of the recording in the file at the
+// given path.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
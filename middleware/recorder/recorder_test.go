@@ -0,0 +1,83 @@
+package recorder_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/recorder"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := recorder.New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer token", "x-trace", "1"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/CreateVolume"}
+	r.Handle(ctx,
+		&csi.CreateVolumeRequest{
+			Name:    "vol",
+			Secrets: map[string]string{"password": "hunter2"},
+		},
+		info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{VolumeId: "1"},
+			}, nil
+		})
+	r.Handle(ctx,
+		&csi.CreateVolumeRequest{},
+		info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.InvalidArgument, "name required")
+		})
+
+	if s := buf.String(); strings.Contains(s, "hunter2") ||
+		strings.Contains(s, "Bearer") {
+		t.Fatalf("recording=%s", s)
+	}
+
+	entries, err := recorder.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries=%d", len(entries))
+	}
+	e := entries[0]
+	if e.Method != info.FullMethod || e.Code != codes.OK ||
+		string(e.Response) != `{"volume":{"volume_id":"1"}}` ||
+		e.Metadata["x-trace"][0] != "1" {
+		t.Fatalf("entry=%+v", e)
+	}
+	e = entries[1]
+	if e.Code != codes.InvalidArgument || e.Message != "name required" ||
+		len(e.Response) != 0 {
+		t.Fatalf("entry=%+v", e)
+	}
+}
+
+func TestRead_Version(t *testing.T) {
+	_, err := recorder.Read(strings.NewReader(
+		`{"format":"gocsi.recording","version":99}` + "\n"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Fatalf("err=%v", err)
+	}
+
+	_, err = recorder.Read(strings.NewReader(
+		`{"method":"/csi.v1.Identity/Probe"}` + "\n"))
+	if err == nil || !strings.Contains(err.Error(), "missing header") {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,358 @@
+package secretguard
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/utils"
+)
+
+// Redacted replaces secret values found in responses and errors.
+const Redacted = "[REDACTED]"
+
+// DefaultMinLength is the default length below which secret values are
+// not guarded. Short values such as "true" or "1" are likely to appear
+// in responses by coincidence.
+const DefaultMinLength = 4
+
+// Option configures the secret guard interceptor.
+type Option func(*opts)
+
+type opts struct {
+	failOnLeak bool
+	minLen     int
+}
+
+// WithFailOnLeak is an Option that fails calls whose response or error
+// contains a secret value with the gRPC error code Internal.
+func WithFailOnLeak() Option {
+	return func(o *opts) {
+		o.failOnLeak = true
+	}
+}
+
+// WithMinLength is an Option that sets the length below which secret
+// values are not guarded. DefaultMinLength is used if n is not positive.
+func WithMinLength(n int) Option {
+	return func(o *opts) {
+		o.minLen = n
+	}
+}
+
+type interceptor struct {
+	opts opts
+}
+
+// NewServerSecretGuard returns a new UnaryServerInterceptor that remembers
+// the values of a request's secrets for the duration of the call and
+// redacts them from a copy of the response and the returned error. A
+// warning is logged for each call that leaks a secret value. A call whose
+// response leaks a secret value that cannot be redacted fails with the
+// gRPC error code Internal.
+func NewServerSecretGuard(opts ...Option) grpc.UnaryServerInterceptor {
+	i := &interceptor{}
+	for _, withOpts := range opts {
+		withOpts(&i.opts)
+	}
+	if i.opts.minLen <= 0 {
+		i.opts.minLen = DefaultMinLength
+	}
+	return i.handleServer
+}
+
+type hasSecrets interface {
+	GetSecrets() map[string]string
+}
+
+func (s *interceptor) handleServer(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	treq, ok := req.(hasSecrets)
+	if !ok {
+		return handler(ctx, req)
+	}
+	g := newGuard(treq.GetSecrets(), s.opts.minLen)
+	if g == nil {
+		return handler(ctx, req)
+	}
+
+	rep, err := handler(ctx, req)
+
+	if !utils.IsNilResponse(rep) {
+		// The handler may return a cached or shared message, so a copy
+		// of the response is redacted.
+		if m, ok := rep.(proto.Message); ok {
+			c := proto.Clone(m)
+			g.redact(reflect.ValueOf(c), "")
+			if len(g.leaks) > 0 {
+				rep = c
+			}
+		} else {
+			g.redact(reflect.ValueOf(rep), "")
+		}
+	}
+	if err != nil {
+		err = g.redactError(err)
+	}
+	if len(g.leaks) == 0 {
+		return rep, err
+	}
+
+	fields := map[string]interface{}{
+		"method": info.FullMethod,
+		"fields": g.leaks,
+	}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		fields["requestID"] = id
+	}
+	if g.unredacted {
+		log.WithFields(fields).Error(
+			"secret value found in response; unable to redact")
+		return nil, status.Error(codes.Internal,
+			"secret value found in response")
+	}
+	log.WithFields(fields).Warn("secret value found in response; redacted")
+
+	if s.opts.failOnLeak {
+		return nil, status.Error(codes.Internal,
+			"secret value found in response")
+	}
+	return rep, err
+}
+
+// guard redacts the secret values of a single call.
+type guard struct {
+	secrets []string
+	leaks   []string
+
+	// unredacted is set when a secret value was found in a value that
+	// cannot be set.
+	unredacted bool
+}
+
+func newGuard(secrets map[string]string, minLen int) *guard {
+	g := &guard{}
+	seen := map[string]bool{}
+	for _, v := range secrets {
+		if len(v) >= minLen && !seen[v] {
+			seen[v] = true
+			g.secrets = append(g.secrets, v)
+		}
+	}
+	if len(g.secrets) == 0 {
+		return nil
+	}
+
+	// Replace the longest values first in case one contains another.
+	sort.Slice(g.secrets, func(i, j int) bool {
+		return len(g.secrets[i]) > len(g.secrets[j])
+	})
+	return g
+}
+
+// redactString returns s with the secret values replaced and a flag
+// indicating whether any were found.
+func (g *guard) redactString(s string) (string, bool) {
+	found := false
+	for _, v := range g.secrets {
+		if strings.Contains(s, v) {
+			s = strings.Replace(s, v, Redacted, -1)
+			found = true
+		}
+	}
+	return s, found
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// redact replaces the secret values in the strings reachable from v and
+// records the paths of the fields that contained them.
+func (g *guard) redact(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			g.redact(v.Elem(), path)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		// The value held by an interface cannot be set, so a copy is
+		// redacted and stored in the interface in its place.
+		e := v.Elem()
+		c := reflect.New(e.Type()).Elem()
+		c.Set(e)
+		n := len(g.leaks)
+		g.redact(c, path)
+		if len(g.leaks) == n {
+			return
+		}
+		if v.CanSet() {
+			v.Set(c)
+		} else {
+			g.unredacted = true
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || strings.HasPrefix(f.Name, "XXX_") {
+				continue
+			}
+			// A oneof's wrapper names its member, so the oneof's own
+			// name is omitted from the path.
+			if f.Tag.Get("protobuf_oneof") != "" {
+				g.redact(v.Field(i), path)
+				continue
+			}
+			g.redact(v.Field(i), joinPath(path, f.Name))
+		}
+	case reflect.String:
+		if r, ok := g.redactString(v.String()); ok {
+			if v.CanSet() {
+				v.SetString(r)
+			} else {
+				g.unredacted = true
+			}
+			g.leaks = append(g.leaks, path)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			g.redact(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			g.redactMapEntry(v, k, path)
+		}
+	}
+}
+
+func (g *guard) redactMapEntry(m, k reflect.Value, path string) {
+	mv := m.MapIndex(k)
+	key := k
+	if k.Kind() == reflect.String {
+		if r, ok := g.redactString(k.String()); ok {
+			key = reflect.ValueOf(r).Convert(k.Type())
+			g.leaks = append(g.leaks, fmt.Sprintf("%s[%s]", path, r))
+			m.SetMapIndex(k, reflect.Value{})
+			m.SetMapIndex(key, mv)
+		}
+	}
+	entryPath := fmt.Sprintf("%s[%s]", path, key)
+	if mv.Kind() == reflect.String {
+		if r, ok := g.redactString(mv.String()); ok {
+			m.SetMapIndex(key, reflect.ValueOf(r).Convert(mv.Type()))
+			g.leaks = append(g.leaks, entryPath)
+		}
+		return
+	}
+	g.redact(mv, entryPath)
+}
+
+// redactError returns err with the secret values replaced in its
+// message and, if it is a gRPC status error, its details.
+func (g *guard) redactError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		// Plain errors are returned to the client with the code Unknown.
+		if r, found := g.redactString(err.Error()); found {
+			g.leaks = append(g.leaks, "error")
+			return status.Error(codes.Unknown, r)
+		}
+		return err
+	}
+
+	p := st.Proto()
+	n := len(g.leaks)
+
+	if r, found := g.redactString(p.Message); found {
+		p.Message = r
+		g.leaks = append(g.leaks, "status.message")
+	}
+
+	details := make([]*any.Any, 0, len(p.Details))
+	for i, a := range p.Details {
+		path := fmt.Sprintf("status.details[%d]", i)
+		var x ptypes.DynamicAny
+		if err := ptypes.UnmarshalAny(a, &x); err != nil {
+			// A detail of an unknown type cannot be redacted, so it is
+			// dropped if it contains a secret value.
+			if g.containsSecret(a.Value) {
+				g.leaks = append(g.leaks, path)
+				continue
+			}
+			details = append(details, a)
+			continue
+		}
+		m := len(g.leaks)
+		g.redact(reflect.ValueOf(x.Message), path)
+		if len(g.leaks) == m {
+			details = append(details, a)
+			continue
+		}
+		if ra, err := ptypes.MarshalAny(x.Message); err == nil {
+			details = append(details, ra)
+		}
+	}
+	p.Details = details
+
+	if len(g.leaks) == n {
+		return err
+	}
+	return status.ErrorProto(p)
+}
+
+func (g *guard) containsSecret(b []byte) bool {
+	for _, v := range g.secrets {
+		if bytes.Contains(b, []byte(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecrets returns a copy of the request m whose Secrets field has
+// its values replaced with Redacted. If m has no secrets then m is
+// returned.
+func RedactSecrets(m proto.Message) proto.Message {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return m
+	}
+	f := rv.Elem().FieldByName("Secrets")
+	if !f.IsValid() || f.Kind() != reflect.Map || f.Len() == 0 {
+		return m
+	}
+	secrets := map[string]string{}
+	for _, k := range f.MapKeys() {
+		secrets[k.String()] = Redacted
+	}
+	c := proto.Clone(m)
+	reflect.ValueOf(c).Elem().FieldByName("Secrets").Set(
+		reflect.ValueOf(secrets))
+	return c
+}
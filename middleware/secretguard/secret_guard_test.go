@@ -0,0 +1,182 @@
+package secretguard_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/secretguard"
+)
+
+const (
+	password = "s3cr3t-passw0rd"
+	publish  = "/csi.v1.Controller/ControllerPublishVolume"
+)
+
+func newRequest() *csi.ControllerPublishVolumeRequest {
+	return &csi.ControllerPublishVolumeRequest{
+		VolumeId: "1",
+		NodeId:   "2",
+		Secrets:  map[string]string{"password": password, "flag": "1"},
+	}
+}
+
+func invoke(
+	i grpc.UnaryServerInterceptor,
+	req interface{},
+	rep interface{},
+	err error) (interface{}, error) {
+
+	return i(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: publish},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return rep, err
+		})
+}
+
+func TestSecretGuard_Response(t *testing.T) {
+	i := secretguard.NewServerSecretGuard()
+
+	rep := &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{
+			"device": "/dev/xvda",
+			"auth":   "user:" + password,
+			password: "key",
+			"flag":   "1",
+		},
+	}
+	res, err := invoke(i, newRequest(), rep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := res.(*csi.ControllerPublishVolumeResponse).PublishContext
+	for k, v := range pc {
+		if strings.Contains(k, password) || strings.Contains(v, password) {
+			t.Fatalf("secret not redacted: %s=%s", k, v)
+		}
+	}
+	if pc["auth"] != "user:"+secretguard.Redacted {
+		t.Errorf("auth=%s", pc["auth"])
+	}
+	if pc[secretguard.Redacted] != "key" {
+		t.Errorf("publishContext=%v", pc)
+	}
+
+	// Values shorter than the minimum length are not guarded.
+	if pc["flag"] != "1" || pc["device"] != "/dev/xvda" {
+		t.Errorf("publishContext=%v", pc)
+	}
+
+	// The handler's response is not modified.
+	if res == rep {
+		t.Fatal("response not copied")
+	}
+	if rep.PublishContext["auth"] != "user:"+password ||
+		rep.PublishContext[password] != "key" ||
+		len(rep.PublishContext) != 4 {
+		t.Errorf("original publishContext=%v", rep.PublishContext)
+	}
+}
+
+// ifaceResponse is a response with a value held by an interface.
+type ifaceResponse struct {
+	Value interface{}
+}
+
+func TestSecretGuard_Interface(t *testing.T) {
+	i := secretguard.NewServerSecretGuard()
+
+	res, err := invoke(i, newRequest(),
+		&ifaceResponse{Value: "user:" + password}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := res.(*ifaceResponse).Value; v != "user:"+secretguard.Redacted {
+		t.Fatalf("value=%v", v)
+	}
+
+	// A secret value that cannot be redacted fails the call.
+	res, err = invoke(i, newRequest(),
+		&ifaceResponse{Value: map[string]interface{}{"auth": password}}, nil)
+	if c := status.Code(err); c != codes.Internal {
+		t.Fatalf("code=%v", c)
+	}
+	if res != nil {
+		t.Fatalf("res=%v", res)
+	}
+}
+
+func TestSecretGuard_Error(t *testing.T) {
+	i := secretguard.NewServerSecretGuard()
+
+	_, err := invoke(i, newRequest(), nil, status.Errorf(
+		codes.PermissionDenied, "login failed: password=%s", password))
+	if c := status.Code(err); c != codes.PermissionDenied {
+		t.Fatalf("code=%v", c)
+	}
+	if m := status.Convert(err).Message(); m !=
+		"login failed: password="+secretguard.Redacted {
+		t.Fatalf("msg=%s", m)
+	}
+
+	_, err = invoke(i, newRequest(), nil, errors.New("bad "+password))
+	if c := status.Code(err); c != codes.Unknown {
+		t.Fatalf("code=%v", c)
+	}
+	if strings.Contains(err.Error(), password) {
+		t.Fatalf("secret not redacted: %v", err)
+	}
+}
+
+func TestSecretGuard_ErrorDetails(t *testing.T) {
+	i := secretguard.NewServerSecretGuard()
+
+	st, err := status.New(codes.Internal, "invalid response").WithDetails(
+		&csi.ControllerPublishVolumeResponse{
+			PublishContext: map[string]string{"auth": password},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = invoke(i, newRequest(), nil, st.Err())
+	details := status.Convert(err).Details()
+	if len(details) != 1 {
+		t.Fatalf("details=%v", details)
+	}
+	rep, ok := details[0].(*csi.ControllerPublishVolumeResponse)
+	if !ok {
+		t.Fatalf("details[0]=%T", details[0])
+	}
+	if v := rep.PublishContext["auth"]; v != secretguard.Redacted {
+		t.Fatalf("auth=%s", v)
+	}
+}
+
+func TestSecretGuard_FailOnLeak(t *testing.T) {
+	i := secretguard.NewServerSecretGuard(secretguard.WithFailOnLeak())
+
+	rep := &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{"auth": password},
+	}
+	res, err := invoke(i, newRequest(), rep, nil)
+	if c := status.Code(err); c != codes.Internal {
+		t.Fatalf("code=%v", c)
+	}
+	if res != nil {
+		t.Fatalf("res=%v", res)
+	}
+
+	// Calls that do not leak a secret are unaffected.
+	rep.PublishContext["auth"] = "token"
+	if _, err := invoke(i, newRequest(), rep, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package etcd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// embeddedEtcd is an etcd server started in-process for the tests when
+// no external endpoint is configured.
+type embeddedEtcd struct {
+	etcd     *embed.Etcd
+	dir      string
+	endpoint string
+}
+
+// startEmbeddedEtcd starts a single-member etcd server on free loopback
+// ports. The function cfgFunc, if non-nil, may modify the server's
+// configuration before it is started.
+func startEmbeddedEtcd(
+	cfgFunc func(cfg *embed.Config, scheme string) string) (
+	*embeddedEtcd, error) {
+
+	dir, err := ioutil.TempDir("", "gocsi-etcd")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := embed.NewConfig()
+	cfg.LogLevel = "error"
+	cfg.Dir = dir
+
+	scheme := "http"
+	if cfgFunc != nil {
+		scheme = cfgFunc(cfg, scheme)
+	}
+
+	cport, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	pport, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	curl, _ := url.Parse(fmt.Sprintf("%s://127.0.0.1:%d", scheme, cport))
+	purl, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", pport))
+	cfg.ListenClientUrls = []url.URL{*curl}
+	cfg.AdvertiseClientUrls = []url.URL{*curl}
+	cfg.ListenPeerUrls = []url.URL{*purl}
+	cfg.AdvertisePeerUrls = []url.URL{*purl}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(time.Second * 30):
+		e.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("embedded etcd failed to start")
+	}
+
+	return &embeddedEtcd{etcd: e, dir: dir, endpoint: curl.String()}, nil
+}
+
+func (e *embeddedEtcd) Close() {
+	e.etcd.Close()
+	os.RemoveAll(e.dir)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
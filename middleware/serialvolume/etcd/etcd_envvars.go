@@ -60,6 +60,12 @@ const (
 	// variable that defines the password used for authentication.
 	EnvVarPassword = "X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD"
 
+	// EnvVarPasswordFile is the name of the environment
+	// variable that defines the path to a file that contains the password
+	// used for authentication. Trailing whitespace is removed from the
+	// file's contents. This variable may not be used with EnvVarPassword.
+	EnvVarPasswordFile = "X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD_FILE"
+
 	// EnvVarRejectOldCluster is the name of the environment
 	// variable that defines when set will refuse to create a client against
 	// an outdated cluster.
@@ -74,4 +80,25 @@ const (
 	// variable that defines whether or not the TLS connection should
 	// verify certificates.
 	EnvVarTLSInsecure = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_INSECURE"
+
+	// EnvVarTLSCA is the name of the environment
+	// variable that defines the path to a PEM-encoded CA bundle used to
+	// verify the server's certificate. Setting this variable enables TLS.
+	EnvVarTLSCA = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CA"
+
+	// EnvVarTLSCert is the name of the environment
+	// variable that defines the path to a PEM-encoded client certificate.
+	// Setting this variable enables TLS and requires EnvVarTLSKey.
+	EnvVarTLSCert = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CERT"
+
+	// EnvVarTLSKey is the name of the environment
+	// variable that defines the path to the PEM-encoded private key for
+	// the client certificate. Setting this variable enables TLS and
+	// requires EnvVarTLSCert.
+	EnvVarTLSKey = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_KEY"
+
+	// EnvVarTLSServerName is the name of the environment
+	// variable that defines the server name used to verify the server's
+	// certificate. Setting this variable enables TLS.
+	EnvVarTLSServerName = "X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_SERVER_NAME"
 )
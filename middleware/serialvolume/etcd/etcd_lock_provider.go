@@ -3,15 +3,19 @@ package etcd
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	etcd "github.com/coreos/etcd/clientv3"
-	etcdsync "github.com/coreos/etcd/clientv3/concurrency"
-	log "github.com/sirupsen/logrus"
 	"github.com/akutz/gosync"
+	log "github.com/sirupsen/logrus"
+	etcd "go.etcd.io/etcd/client/v3"
+	etcdsync "go.etcd.io/etcd/client/v3/concurrency"
 
 	csictx "github.com/rexray/gocsi/context"
 	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
@@ -58,9 +62,18 @@ func New(
 		client: client,
 		domain: domain,
 		ttl:    int(ttl.Seconds()),
+		locals: map[string]*localLock{},
 	}, nil
 }
 
+// NewConfig returns an etcd client configuration initialized from the
+// X_CSI_SERIAL_VOL_ACCESS_ETCD_* environment variables. Other packages
+// that need an etcd client, such as the leader election middleware, may
+// use this function to share the lock provider's connection settings.
+func NewConfig(ctx context.Context) (etcd.Config, error) {
+	return initConfig(ctx, map[string]interface{}{})
+}
+
 func initConfig(
 	ctx context.Context,
 	fields map[string]interface{}) (etcd.Config, error) {
@@ -134,6 +147,19 @@ func initConfig(
 		config.Password = v
 		fields["serialvol.etcd.Password"] = "********"
 	}
+	if v := csictx.Getenv(ctx, EnvVarPasswordFile); v != "" {
+		if config.Password != "" {
+			return config, fmt.Errorf(
+				"%s and %s are mutually exclusive",
+				EnvVarPassword, EnvVarPasswordFile)
+		}
+		buf, err := ioutil.ReadFile(v)
+		if err != nil {
+			return config, err
+		}
+		config.Password = strings.TrimRight(string(buf), " \t\r\n")
+		fields["serialvol.etcd.PasswordFile"] = v
+	}
 
 	if v, ok := csictx.LookupEnv(ctx, EnvVarRejectOldCluster); ok {
 		b, err := strconv.ParseBool(v)
@@ -144,23 +170,89 @@ func initConfig(
 		fields["serialvol.etcd.RejectOldCluster"] = b
 	}
 
+	tlsConfig, err := initTLSConfig(ctx, fields)
+	if err != nil {
+		return config, err
+	}
+	config.TLS = tlsConfig
+
+	return config, nil
+}
+
+// initTLSConfig returns the TLS configuration defined by the environment.
+// A nil value is returned if TLS is not enabled. TLS is enabled explicitly
+// with EnvVarTLS or implicitly by setting any of EnvVarTLSCA,
+// EnvVarTLSCert, EnvVarTLSKey, or EnvVarTLSServerName.
+func initTLSConfig(
+	ctx context.Context,
+	fields map[string]interface{}) (*tls.Config, error) {
+
+	var (
+		enabled    bool
+		caFile     = csictx.Getenv(ctx, EnvVarTLSCA)
+		certFile   = csictx.Getenv(ctx, EnvVarTLSCert)
+		keyFile    = csictx.Getenv(ctx, EnvVarTLSKey)
+		serverName = csictx.Getenv(ctx, EnvVarTLSServerName)
+	)
+
 	if v, ok := csictx.LookupEnv(ctx, EnvVarTLS); ok {
 		b, err := strconv.ParseBool(v)
 		if err != nil {
-			return config, err
+			return nil, err
+		}
+		enabled = b
+	}
+	if !enabled {
+		enabled = caFile != "" ||
+			certFile != "" ||
+			keyFile != "" ||
+			serverName != ""
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	fields["serialvol.etcd.tls"] = true
+
+	if v, ok := csictx.LookupEnv(ctx, EnvVarTLSInsecure); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		config.InsecureSkipVerify = b
+		fields["serialvol.etcd.tls.insecure"] = b
+	}
+
+	if caFile != "" {
+		buf, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
 		}
-		if b {
-			config.TLS = &tls.Config{}
-			fields["serialvol.etcd.tls"] = b
-			if v, ok := csictx.LookupEnv(ctx, EnvVarTLSInsecure); ok {
-				b, err := strconv.ParseBool(v)
-				if err != nil {
-					return config, err
-				}
-				config.TLS.InsecureSkipVerify = b
-				fields["serialvol.etcd.tls.insecure"] = b
-			}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
 		}
+		fields["serialvol.etcd.tls.ca"] = caFile
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf(
+				"%s and %s must be set together", EnvVarTLSCert, EnvVarTLSKey)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		fields["serialvol.etcd.tls.cert"] = certFile
+		fields["serialvol.etcd.tls.key"] = keyFile
+	}
+
+	if serverName != "" {
+		config.ServerName = serverName
+		fields["serialvol.etcd.tls.serverName"] = serverName
 	}
 
 	return config, nil
@@ -170,9 +262,29 @@ type provider struct {
 	client *etcd.Client
 	domain string
 	ttl    int
+
+	// sess is the concurrency session shared by all of the provider's
+	// locks. It is created on demand and re-created once its lease
+	// expires or is revoked.
+	sess  *etcdsync.Session
+	sessL sync.Mutex
+
+	// locals serializes the holders of the same key within this process.
+	// Mutexes created with the same session and prefix share one etcd key,
+	// so etcd alone cannot exclude them from one another.
+	locals  map[string]*localLock
+	localsL sync.Mutex
 }
 
 func (p *provider) Close() error {
+	p.sessL.Lock()
+	defer p.sessL.Unlock()
+	if p.sess != nil {
+		if err := p.sess.Close(); err != nil {
+			log.Errorf("EtcdVolumeLockProvider: close session err: %v", err)
+		}
+		p.sess = nil
+	}
 	return p.client.Close()
 }
 
@@ -193,28 +305,92 @@ func (p *provider) getLock(
 
 	log.Debugf("EtcdVolumeLockProvider: getLock: pfx=%v", pfx)
 
-	opts := []etcdsync.SessionOption{etcdsync.WithContext(ctx)}
+	p.localsL.Lock()
+	defer p.localsL.Unlock()
+	l := p.locals[pfx]
+	if l == nil {
+		l = &localLock{ch: make(chan struct{}, 1)}
+		p.locals[pfx] = l
+	}
+	l.refs++
+
+	return &TryMutex{ctx: ctx, p: p, pfx: pfx, local: l}, nil
+}
+
+// release drops a reference to the local lock for pfx.
+func (p *provider) release(pfx string) {
+	p.localsL.Lock()
+	defer p.localsL.Unlock()
+	if l := p.locals[pfx]; l != nil {
+		if l.refs--; l.refs <= 0 {
+			delete(p.locals, pfx)
+		}
+	}
+}
+
+// session returns the provider's concurrency session, creating a new
+// one if there is no session or the current session's lease is gone.
+func (p *provider) session() (*etcdsync.Session, error) {
+	p.sessL.Lock()
+	defer p.sessL.Unlock()
+
+	if p.sess != nil {
+		select {
+		case <-p.sess.Done():
+			log.Warn("EtcdVolumeLockProvider: session expired")
+			p.sess = nil
+		default:
+			return p.sess, nil
+		}
+	}
+
+	var opts []etcdsync.SessionOption
 	if p.ttl > 0 {
 		opts = append(opts, etcdsync.WithTTL(p.ttl))
 	}
-
 	sess, err := etcdsync.NewSession(p.client, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &TryMutex{
-		ctx: ctx, sess: sess, mtx: etcdsync.NewMutex(sess, pfx)}, nil
+	log.WithField("lease", sess.Lease()).Debug(
+		"EtcdVolumeLockProvider: created session")
+	p.sess = sess
+	return sess, nil
+}
+
+// localLock is a mutex that may be acquired with a context.
+type localLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func (l *localLock) lock(ctx context.Context) error {
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *localLock) unlock() {
+	<-l.ch
 }
 
 // TryMutex is a mutual exclusion lock backed by etcd that implements the
 // TryLocker interface.
-// The zero value for a TryMutex is an unlocked mutex.
 //
-// A TryMutex may be copied after first use.
+// All of the TryMutex objects created by a provider share a single etcd
+// concurrency session, so obtaining a lock does not require a new lease.
 type TryMutex struct {
-	ctx  context.Context
-	sess *etcdsync.Session
-	mtx  *etcdsync.Mutex
+	ctx   context.Context
+	p     *provider
+	pfx   string
+	local *localLock
+
+	key    string
+	locked bool
+	closed bool
 
 	// LockCtx, when non-nil, is the context used with Lock.
 	LockCtx context.Context
@@ -227,73 +403,168 @@ type TryMutex struct {
 }
 
 // Lock locks m. If the lock is already in use, the calling goroutine blocks
-// until the mutex is available.
+// until the mutex is available. Lock cannot report failures other than
+// lock contention, so errors are logged. Use TryLockWithError to detect
+// them.
 func (m *TryMutex) Lock() {
-	//log.Debug("TryMutex: lock")
 	ctx := m.LockCtx
 	if ctx == nil {
 		ctx = m.ctx
 	}
-	if err := m.mtx.Lock(ctx); err != nil {
-		log.Debugf("TryMutex: lock err: %v", err)
-		if err != context.Canceled && err != context.DeadlineExceeded {
-			log.Panicf("TryMutex: lock panic: %v", err)
+	if err := m.lock(ctx); err != nil {
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			log.Debugf("TryMutex: lock err: %v", err)
+			return
 		}
+		log.Errorf("TryMutex: lock err: %v", err)
 	}
 }
 
-// Unlock unlocks m. It is a run-time error if m is not locked on entry to
-// Unlock.
-//
-// A locked TryMutex is not associated with a particular goroutine. It is
-// allowed for one goroutine to lock a Mutex and then arrange for another
-// goroutine to unlock it.
+// Unlock unlocks m. Errors are logged. Use UnlockWithError to detect them.
 func (m *TryMutex) Unlock() {
-	//log.Debug("TryMutex: unlock")
+	if err := m.UnlockWithError(); err != nil {
+		log.Errorf("TryMutex: unlock err: %v", err)
+	}
+}
+
+// UnlockWithError unlocks m and returns any error that occurred while
+// removing the lock's key from etcd. The lock is released locally even
+// if an error is returned; the key is removed by etcd once the provider's
+// session expires.
+func (m *TryMutex) UnlockWithError() error {
+	if !m.locked {
+		return nil
+	}
 	ctx := m.UnlockCtx
 	if ctx == nil {
 		ctx = m.ctx
 	}
-	if err := m.mtx.Unlock(ctx); err != nil {
-		log.Debugf("TryMutex: unlock err: %v", err)
-		if err != context.Canceled && err != context.DeadlineExceeded {
-			log.Panicf("TryMutex: unlock panic: %v", err)
-		}
-	}
+	_, err := m.p.client.Delete(ctx, m.key)
+	m.key = ""
+	m.locked = false
+	m.local.unlock()
+	return err
 }
 
-// Close closes and cleans up the underlying concurrency session.
+// Close unlocks m if it is locked and releases the resources used by m.
+// The provider's shared session remains open.
 func (m *TryMutex) Close() error {
-	//log.Debug("TryMutex: close")
-	if err := m.sess.Close(); err != nil {
-		log.Errorf("TryMutex: close err: %v", err)
-		return err
+	if m.closed {
+		return nil
 	}
-	return nil
+	m.closed = true
+	err := m.UnlockWithError()
+	m.p.release(m.pfx)
+	return err
 }
 
 // TryLock attempts to lock m. If no lock can be obtained in the specified
-// duration then a false value is returned.
+// duration then a false value is returned. A duration that is not greater
+// than zero results in a single attempt. Errors are logged and also result
+// in a false value. Use TryLockWithError to detect them.
 func (m *TryMutex) TryLock(timeout time.Duration) bool {
+	ok, err := m.TryLockWithError(timeout)
+	if err != nil {
+		log.Errorf("TryMutex: TryLock err: %v", err)
+	}
+	return ok
+}
+
+// TryLockWithError attempts to lock m. If no lock can be obtained in the
+// specified duration then a false value is returned. A non-nil error is
+// returned if etcd could not be reached or returned an error.
+func (m *TryMutex) TryLockWithError(timeout time.Duration) (bool, error) {
 
 	ctx := m.TryLockCtx
 	if ctx == nil {
 		ctx = m.ctx
 	}
 
-	// Create a timeout context only if the timeout is greater than zero.
-	if timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
-		defer cancel()
+	if timeout <= 0 {
+		return m.tryLockOnce(ctx)
 	}
 
-	if err := m.mtx.Lock(ctx); err != nil {
-		log.Debugf("TryMutex: TryLock err: %v", err)
-		if err != context.Canceled && err != context.DeadlineExceeded {
-			log.Panicf("TryMutex: TryLock panic: %v", err)
-		}
-		return false
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := m.lock(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false, nil
 	}
-	return true
+	return false, err
+}
+
+// lock blocks until m is locked or an error occurs.
+func (m *TryMutex) lock(ctx context.Context) error {
+	if err := m.local.lock(ctx); err != nil {
+		return err
+	}
+
+	sess, err := m.p.session()
+	if err != nil {
+		m.local.unlock()
+		return err
+	}
+
+	mtx := etcdsync.NewMutex(sess, m.pfx)
+	if err := mtx.Lock(ctx); err != nil {
+		m.local.unlock()
+		return err
+	}
+
+	m.key = mtx.Key()
+	m.locked = true
+	return nil
+}
+
+// tryLockOnce makes a single attempt to lock m. It mirrors the first step
+// of etcdsync.Mutex.Lock, removing the waiter key rather than waiting when
+// the lock is owned by another session.
+func (m *TryMutex) tryLockOnce(ctx context.Context) (bool, error) {
+	select {
+	case m.local.ch <- struct{}{}:
+	default:
+		return false, nil
+	}
+
+	sess, err := m.p.session()
+	if err != nil {
+		m.local.unlock()
+		return false, err
+	}
+
+	var (
+		pfx      = m.pfx + "/"
+		key      = fmt.Sprintf("%s%x", pfx, sess.Lease())
+		cmp      = etcd.Compare(etcd.CreateRevision(key), "=", 0)
+		put      = etcd.OpPut(key, "", etcd.WithLease(sess.Lease()))
+		get      = etcd.OpGet(key)
+		getOwner = etcd.OpGet(pfx, etcd.WithFirstCreate()...)
+	)
+
+	resp, err := m.p.client.Txn(ctx).
+		If(cmp).Then(put, getOwner).Else(get, getOwner).Commit()
+	if err != nil {
+		m.local.unlock()
+		return false, err
+	}
+
+	rev := resp.Header.Revision
+	if !resp.Succeeded {
+		rev = resp.Responses[0].GetResponseRange().Kvs[0].CreateRevision
+	}
+	owner := resp.Responses[1].GetResponseRange().Kvs
+	if len(owner) == 0 || owner[0].CreateRevision == rev {
+		m.key = key
+		m.locked = true
+		return true, nil
+	}
+
+	// The lock is owned by another session, so remove the waiter key.
+	_, err = m.p.client.Delete(ctx, key)
+	m.local.unlock()
+	return false, err
 }
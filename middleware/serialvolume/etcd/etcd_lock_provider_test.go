@@ -19,9 +19,17 @@ var p mwtypes.VolumeLockerProvider
 
 func TestMain(m *testing.M) {
 	log.SetLevel(log.InfoLevel)
+
+	// Start an embedded etcd server if no endpoint is configured.
+	var e *embeddedEtcd
 	if os.Getenv(csietcd.EnvVarEndpoints) == "" {
-		os.Exit(0)
+		var err error
+		if e, err = startEmbeddedEtcd(nil); err != nil {
+			log.Fatalln(err)
+		}
+		os.Setenv(csietcd.EnvVarEndpoints, e.endpoint)
 	}
+
 	os.Setenv(csietcd.EnvVarDialTimeout, "1s")
 	var err error
 	p, err = csietcd.New(context.TODO(), "/gocsi/etcd", 0, nil)
@@ -30,6 +38,9 @@ func TestMain(m *testing.M) {
 	}
 	exitCode := m.Run()
 	p.(io.Closer).Close()
+	if e != nil {
+		e.Close()
+	}
 	os.Exit(exitCode)
 }
 
@@ -166,3 +177,100 @@ func ExampleTryMutex_TryLock_timeout() {
 
 	// Output: lock not obtained
 }
+
+func TestTryMutex_TryLockOnce(t *testing.T) {
+	ctx := context.Background()
+
+	m1, err := p.GetLockWithID(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m1.(io.Closer).Close()
+
+	m2, err := p.GetLockWithID(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.(io.Closer).Close()
+
+	if ok, err := m1.(mwtypes.TryLockerWithError).TryLockWithError(0); !ok {
+		t.Fatalf("lock not obtained: %v", err)
+	}
+
+	// m2 shares m1's session, so only the local lock prevents m2 from
+	// treating m1's key as its own.
+	if ok, err := m2.(mwtypes.TryLockerWithError).TryLockWithError(0); ok {
+		t.Fatal("lock obtained twice")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	m1.Unlock()
+	if !m2.TryLock(0) {
+		t.Fatal("lock not obtained after unlock")
+	}
+	m2.Unlock()
+}
+
+func TestTryMutex_CloseUnlocks(t *testing.T) {
+	ctx := context.Background()
+
+	m1, err := p.GetLockWithName(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m1.TryLock(time.Second) {
+		t.Fatal("lock not obtained")
+	}
+	if err := m1.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := p.GetLockWithName(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.(io.Closer).Close()
+	if !m2.TryLock(0) {
+		t.Fatal("lock not released by Close")
+	}
+	m2.Unlock()
+}
+
+func BenchmarkTryMutex_TryLock(b *testing.B) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		m, err := p.GetLockWithID(ctx, "BenchmarkTryMutex_TryLock")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !m.TryLock(time.Second) {
+			b.Fatal("lock not obtained")
+		}
+		m.Unlock()
+		m.(io.Closer).Close()
+	}
+}
+
+func BenchmarkTryMutex_TryLockParallel(b *testing.B) {
+	ctx := context.Background()
+	var n int64
+	var nL sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		nL.Lock()
+		id := fmt.Sprintf("BenchmarkTryMutex_TryLockParallel/%d", n)
+		n++
+		nL.Unlock()
+		for pb.Next() {
+			m, err := p.GetLockWithID(ctx, id)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !m.TryLock(time.Second) {
+				b.Fatal("lock not obtained")
+			}
+			m.Unlock()
+			m.(io.Closer).Close()
+		}
+	})
+}
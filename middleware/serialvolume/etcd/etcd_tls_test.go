@@ -0,0 +1,197 @@
+package etcd_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+
+	csictx "github.com/rexray/gocsi/context"
+	csietcd "github.com/rexray/gocsi/middleware/serialvolume/etcd"
+	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
+)
+
+// testPKI is a CA and a set of certificates issued by it, written to
+// PEM files in a temporary directory.
+type testPKI struct {
+	dir    string
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "gocsi-etcd-pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testPKI{dir: dir}
+	p.caKey, p.caCert = p.issue(t, "ca", nil, true)
+	return p
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+// issue creates a key and certificate and writes them to NAME.key and
+// NAME.crt. The certificate is self-signed when isCA is true.
+func (p *testPKI) issue(
+	t *testing.T,
+	name string,
+	ips []net.IP,
+	isCA bool) (*ecdsa.PrivateKey, *x509.Certificate) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature |
+			x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		IPAddresses: ips,
+		DNSNames:    []string{name},
+	}
+	parent, signer := tmpl, key
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = p.caCert, p.caKey
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, p.path(name+".crt"), "CERTIFICATE", der)
+	writePEM(t, p.path(name+".key"), "EC PRIVATE KEY", keyDER)
+	return key, cert
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	buf := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_TLSClientCert(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	pki.issue(t, "server", []net.IP{net.ParseIP("127.0.0.1")}, false)
+	pki.issue(t, "client", nil, false)
+
+	e, err := startEmbeddedEtcd(
+		func(cfg *embed.Config, scheme string) string {
+			cfg.ClientTLSInfo.CertFile = pki.path("server.crt")
+			cfg.ClientTLSInfo.KeyFile = pki.path("server.key")
+			cfg.ClientTLSInfo.TrustedCAFile = pki.path("ca.crt")
+			cfg.ClientTLSInfo.ClientCertAuth = true
+			return "https"
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	ctx := csictx.WithEnviron(context.Background(), []string{
+		csietcd.EnvVarEndpoints + "=" + e.endpoint,
+		csietcd.EnvVarDialTimeout + "=1s",
+		csietcd.EnvVarTLSCA + "=" + pki.path("ca.crt"),
+		csietcd.EnvVarTLSCert + "=" + pki.path("client.crt"),
+		csietcd.EnvVarTLSKey + "=" + pki.path("client.key"),
+		csietcd.EnvVarTLSServerName + "=server",
+	})
+
+	p, err := csietcd.New(ctx, "/gocsi/etcd/tls", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.(io.Closer).Close()
+
+	m, err := p.GetLockWithID(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.(io.Closer).Close()
+	ok, err := m.(mwtypes.TryLockerWithError).TryLockWithError(time.Second * 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("lock not obtained")
+	}
+	m.Unlock()
+}
+
+func TestNew_TLSInvalidConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	pki.issue(t, "client", nil, false)
+
+	pwFile := pki.path("password")
+	if err := ioutil.WriteFile(pwFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, env := range map[string][]string{
+		"CertWithoutKey": {
+			csietcd.EnvVarTLSCert + "=" + pki.path("client.crt"),
+		},
+		"KeyWithoutCert": {
+			csietcd.EnvVarTLSKey + "=" + pki.path("client.key"),
+		},
+		"InvalidCA": {
+			csietcd.EnvVarTLSCA + "=" + pki.path("client.key"),
+		},
+		"MissingCA": {
+			csietcd.EnvVarTLSCA + "=" + pki.path("missing.crt"),
+		},
+		"PasswordAndPasswordFile": {
+			csietcd.EnvVarPassword + "=secret",
+			csietcd.EnvVarPasswordFile + "=" + pwFile,
+		},
+		"MissingPasswordFile": {
+			csietcd.EnvVarPasswordFile + "=" + pki.path("missing"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := csictx.WithEnviron(context.Background(), env)
+			if _, err := csietcd.New(ctx, "", 0, nil); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
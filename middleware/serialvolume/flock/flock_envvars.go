@@ -0,0 +1,12 @@
+package flock
+
+const (
+	// EnvVarDir is the name of the environment variable that defines
+	// the directory in which the lock provider creates its lock files.
+	EnvVarDir = "X_CSI_SERIAL_VOL_ACCESS_FLOCK_DIR"
+
+	// EnvVarPollInterval is the name of the environment variable that
+	// defines how often a TryLock call attempts to obtain a lock that is
+	// held by another process. The default value is 100ms.
+	EnvVarPollInterval = "X_CSI_SERIAL_VOL_ACCESS_FLOCK_POLL_INTERVAL"
+)
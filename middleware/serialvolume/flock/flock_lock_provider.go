@@ -0,0 +1,228 @@
+package flock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akutz/gosync"
+	log "github.com/sirupsen/logrus"
+
+	csictx "github.com/rexray/gocsi/context"
+	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
+)
+
+const (
+	// defaultPollInterval is the interval at which TryLock attempts to
+	// obtain a lock held by another file descriptor.
+	defaultPollInterval = time.Millisecond * 100
+
+	// maxFileNameLen is the maximum length of an encoded lock file name.
+	// Longer names are replaced with the hex-encoded SHA256 sum of the
+	// volume ID or name.
+	maxFileNameLen = 255
+)
+
+// New returns a new flock volume lock provider. The lock files are
+// created in the directory dir. If dir is empty then the value of the
+// environment variable X_CSI_SERIAL_VOL_ACCESS_FLOCK_DIR is used. If
+// pollInterval is zero then the value of the environment variable
+// X_CSI_SERIAL_VOL_ACCESS_FLOCK_POLL_INTERVAL is used, falling back to
+// 100ms. An error is returned on platforms without file locking support.
+func New(
+	ctx context.Context,
+	dir string,
+	pollInterval time.Duration) (mwtypes.VolumeLockerProvider, error) {
+
+	if err := checkSupported(); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+
+	if dir == "" {
+		dir = csictx.Getenv(ctx, EnvVarDir)
+	}
+	if dir == "" {
+		return nil, errors.New("flock: lock directory required")
+	}
+	fields["serialvol.flock.dir"] = dir
+
+	if pollInterval == 0 {
+		if v := csictx.Getenv(ctx, EnvVarPollInterval); v != "" {
+			var err error
+			if pollInterval, err = time.ParseDuration(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	fields["serialvol.flock.pollInterval"] = pollInterval
+
+	p := &provider{
+		byID:         filepath.Join(dir, "volumesByID"),
+		byName:       filepath.Join(dir, "volumesByName"),
+		pollInterval: pollInterval,
+	}
+	for _, d := range []string{p.byID, p.byName} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithFields(fields).Info("creating serial vol flock lock provider")
+	return p, nil
+}
+
+type provider struct {
+	byID         string
+	byName       string
+	pollInterval time.Duration
+}
+
+func (p *provider) GetLockWithID(
+	ctx context.Context, id string) (gosync.TryLocker, error) {
+
+	return p.getLock(ctx, p.byID, id)
+}
+
+func (p *provider) GetLockWithName(
+	ctx context.Context, name string) (gosync.TryLocker, error) {
+
+	return p.getLock(ctx, p.byName, name)
+}
+
+func (p *provider) getLock(
+	ctx context.Context, dir, key string) (gosync.TryLocker, error) {
+
+	name, err := fileName(key)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name)
+
+	log.Debugf("FlockVolumeLockProvider: getLock: path=%v", path)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &TryMutex{ctx: ctx, f: f, pollInterval: p.pollInterval}, nil
+}
+
+// fileName encodes a volume ID or name into a string that is safe to use
+// as a file name.
+func fileName(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("flock: empty lock key")
+	}
+	name := base64.RawURLEncoding.EncodeToString([]byte(key))
+	if len(name) > maxFileNameLen {
+		sum := sha256.Sum256([]byte(key))
+		name = hex.EncodeToString(sum[:])
+	}
+	return name, nil
+}
+
+// TryMutex is a mutual exclusion lock backed by an advisory file lock
+// that implements the TryLocker interface. Each TryMutex owns its own
+// file descriptor, so two TryMutex objects for the same volume exclude
+// one another whether they are in the same process or not.
+//
+// A TryMutex should be closed when it is no longer needed.
+type TryMutex struct {
+	ctx          context.Context
+	f            *os.File
+	pollInterval time.Duration
+
+	// TryLockCtx, when non-nil, is the context used with TryLock.
+	TryLockCtx context.Context
+}
+
+// Lock locks m. If the lock is already in use, the calling goroutine blocks
+// until the mutex is available. Lock cannot report failures other than
+// lock contention, so errors are logged. Use TryLockWithError to detect
+// them.
+func (m *TryMutex) Lock() {
+	if err := lockFile(m.f, true); err != nil {
+		log.Errorf("TryMutex: lock err: %v", err)
+	}
+}
+
+// Unlock unlocks m. Errors are logged. Use UnlockWithError to detect them.
+func (m *TryMutex) Unlock() {
+	if err := m.UnlockWithError(); err != nil {
+		log.Errorf("TryMutex: unlock err: %v", err)
+	}
+}
+
+// UnlockWithError unlocks m and returns any error that occurred while
+// releasing the file lock.
+func (m *TryMutex) UnlockWithError() error {
+	return unlockFile(m.f)
+}
+
+// Close closes the underlying lock file, releasing any lock held by m.
+func (m *TryMutex) Close() error {
+	if err := m.f.Close(); err != nil {
+		log.Errorf("TryMutex: close err: %v", err)
+		return err
+	}
+	return nil
+}
+
+// TryLock attempts to lock m. If no lock can be obtained in the specified
+// duration then a false value is returned. A zero duration results in a
+// single attempt. Errors other than lock contention are logged and result
+// in a false value. Use TryLockWithError to detect them.
+func (m *TryMutex) TryLock(timeout time.Duration) bool {
+	ok, err := m.TryLockWithError(timeout)
+	if err != nil {
+		log.Errorf("TryMutex: TryLock err: %v", err)
+	}
+	return ok
+}
+
+// TryLockWithError attempts to lock m. If no lock can be obtained in the
+// specified duration then a false value is returned. A non-nil error is
+// returned if the file lock could not be obtained for a reason other than
+// lock contention.
+func (m *TryMutex) TryLockWithError(timeout time.Duration) (bool, error) {
+
+	ctx := m.TryLockCtx
+	if ctx == nil {
+		ctx = m.ctx
+	}
+
+	// Create a timeout context only if the timeout is greater than zero.
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for {
+		err := lockFile(m.f, false)
+		if err == nil {
+			return true, nil
+		}
+		if err != errWouldBlock {
+			return false, err
+		}
+		if timeout <= 0 {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package flock_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	csiflock "github.com/rexray/gocsi/middleware/serialvolume/flock"
+	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
+)
+
+var p mwtypes.VolumeLockerProvider
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	dir, err := ioutil.TempDir("", "gocsi-flock")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	p, err = csiflock.New(context.TODO(), dir, time.Millisecond*10)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	exitCode := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(exitCode)
+}
+
+func TestTryMutex_Lock(t *testing.T) {
+
+	var (
+		i     int
+		id    = t.Name()
+		wait  sync.WaitGroup
+		ready = make(chan struct{}, 5)
+	)
+
+	wait.Add(5)
+	defer wait.Wait()
+
+	ctx := context.Background()
+
+	m, err := p.GetLockWithID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+
+	defer m.(io.Closer).Close()
+	defer m.Unlock()
+
+	// Start five goroutines that all attempt to lock m and increment i.
+	for j := 0; j < 5; j++ {
+		go func() {
+			defer wait.Done()
+
+			m, err := p.GetLockWithID(ctx, id)
+			if err != nil {
+				t.Error(err)
+				ready <- struct{}{}
+				return
+			}
+			defer m.(io.Closer).Close()
+
+			ready <- struct{}{}
+			if m.TryLock(time.Second * 5) {
+				i++
+				m.Unlock()
+			}
+		}()
+	}
+
+	for j := 0; j < 5; j++ {
+		<-ready
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	if i > 0 {
+		t.Errorf("i=%d > 0", i)
+	}
+}
+
+func TestTryMutex_TryLockContext(t *testing.T) {
+	ctx := context.Background()
+
+	m1, err := p.GetLockWithName(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m1.(io.Closer).Close()
+	if !m1.TryLock(0) {
+		t.Fatal("lock failed")
+	}
+	defer m1.Unlock()
+
+	m2, err := p.GetLockWithName(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.(io.Closer).Close()
+
+	// A canceled context should cause TryLock to return before the
+	// timeout elapses.
+	tryCtx, cancel := context.WithCancel(ctx)
+	m2.(*csiflock.TryMutex).TryLockCtx = tryCtx
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+	start := time.Now()
+	if m2.TryLock(time.Second * 10) {
+		t.Fatal("lock should have failed")
+	}
+	if d := time.Since(start); d > time.Second*5 {
+		t.Fatalf("TryLock ignored canceled context: %v", d)
+	}
+}
+
+func TestTryMutex_TryLockWithError(t *testing.T) {
+	ctx := context.Background()
+
+	m1, err := p.GetLockWithID(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m1.(io.Closer).Close()
+	if ok, err := m1.(mwtypes.TryLockerWithError).TryLockWithError(0); !ok {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	m2, err := p.GetLockWithID(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock contention is not an error.
+	if ok, err := m2.(mwtypes.TryLockerWithError).TryLockWithError(0); ok {
+		t.Fatal("lock should have failed")
+	} else if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A failure to flock the lock file is returned to the caller.
+	m2.(io.Closer).Close()
+	if ok, err := m2.(mwtypes.TryLockerWithError).TryLockWithError(0); ok {
+		t.Fatal("lock should have failed")
+	} else if err == nil {
+		t.Fatal("expected error")
+	}
+	if err := m2.(mwtypes.TryLockerWithError).UnlockWithError(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := m1.(mwtypes.TryLockerWithError).UnlockWithError(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetLockWithID_LongAndUnsafe(t *testing.T) {
+	ctx := context.Background()
+	for _, id := range []string{
+		"../../etc/passwd",
+		"vol/with/slashes",
+		strings.Repeat("x", 1024),
+	} {
+		m, err := p.GetLockWithID(ctx, id)
+		if err != nil {
+			t.Fatalf("id=%.32s: %v", id, err)
+		}
+		if !m.TryLock(0) {
+			t.Fatalf("id=%.32s: lock failed", id)
+		}
+		m.Unlock()
+		m.(io.Closer).Close()
+	}
+	if _, err := p.GetLockWithID(ctx, ""); err == nil {
+		t.Fatal("expected error for empty id")
+	}
+}
+
+func ExampleTryMutex_TryLock() {
+
+	const lockName = "ExampleTryMutex_TryLock"
+
+	// The context used when creating new locks.
+	ctx := context.Background()
+
+	// Assign a TryMutex to m1 and then lock m1.
+	m1, err := p.GetLockWithName(ctx, lockName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer m1.(io.Closer).Close()
+	m1.Lock()
+
+	// Start a goroutine that sleeps for one second and then
+	// unlocks m1. This makes it possible for the TryLock
+	// call below to lock m2.
+	go func() {
+		time.Sleep(time.Duration(1) * time.Second)
+		m1.Unlock()
+	}()
+
+	// Try for three seconds to lock m2.
+	m2, err := p.GetLockWithName(ctx, lockName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer m2.(io.Closer).Close()
+	if m2.TryLock(time.Duration(3) * time.Second) {
+		fmt.Println("lock obtained")
+	}
+	m2.Unlock()
+
+	// Output: lock obtained
+}
+
+func ExampleTryMutex_TryLock_timeout() {
+
+	const lockName = "ExampleTryMutex_TryLock_timeout"
+
+	// The context used when creating new locks.
+	ctx := context.Background()
+
+	// Assign a TryMutex to m1 and then lock m1.
+	m1, err := p.GetLockWithName(ctx, lockName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer m1.(io.Closer).Close()
+	defer m1.Unlock()
+	m1.Lock()
+
+	// Try for 100ms to lock m2.
+	m2, err := p.GetLockWithName(ctx, lockName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer m2.(io.Closer).Close()
+	if !m2.TryLock(time.Duration(100) * time.Millisecond) {
+		fmt.Println("lock not obtained")
+	}
+
+	// Output: lock not obtained
+}
@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package flock
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	errWouldBlock  = errors.New("flock: would block")
+	errUnsupported = errors.New("flock: unsupported on windows")
+)
+
+func checkSupported() error {
+	return errUnsupported
+}
+
+func lockFile(f *os.File, block bool) error {
+	return errUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return errUnsupported
+}
@@ -0,0 +1,58 @@
+package serialvolume
+
+import (
+	"context"
+	"sort"
+)
+
+// LockKeyType indicates whether a lock key is a volume ID or name.
+type LockKeyType int
+
+const (
+	// LockKeyTypeID indicates a lock key is obtained with GetLockWithID.
+	LockKeyTypeID LockKeyType = iota
+
+	// LockKeyTypeName indicates a lock key is obtained with
+	// GetLockWithName.
+	LockKeyTypeName
+)
+
+// LockKey identifies a lock obtained from a volume lock provider.
+type LockKey struct {
+	Type  LockKeyType
+	Value string
+}
+
+// LockKeyFunc returns the keys of the locks that must be held while
+// handling the given request. Returning an empty slice disables serial
+// access for the request. Returning an error fails the request with
+// that error.
+//
+// The interceptor sorts and de-duplicates the keys before acquiring the
+// locks, so the order of the returned keys does not matter.
+type LockKeyFunc func(ctx context.Context, req interface{}) ([]LockKey, error)
+
+// sortLockKeys sorts the keys by type and then value and removes
+// duplicate and empty keys. Acquiring locks in a well-defined order
+// prevents two requests with overlapping keys from deadlocking.
+func sortLockKeys(keys []LockKey) []LockKey {
+	sorted := make([]LockKey, 0, len(keys))
+	for _, k := range keys {
+		if k.Value != "" {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	uniq := sorted[:0]
+	for j, k := range sorted {
+		if j == 0 || k != sorted[j-1] {
+			uniq = append(uniq, k)
+		}
+	}
+	return uniq
+}
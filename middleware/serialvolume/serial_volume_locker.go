@@ -3,16 +3,19 @@ package serialvolume
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/akutz/gosync"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
 	xctx "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	mwtypes "github.com/rexray/gocsi/middleware/serialvolume/types"
+	"github.com/rexray/gocsi/utils"
 )
 
 const pending = "pending"
@@ -21,8 +24,9 @@ const pending = "pending"
 type Option func(*opts)
 
 type opts struct {
-	timeout time.Duration
-	locker  mwtypes.VolumeLockerProvider
+	timeout  time.Duration
+	locker   mwtypes.VolumeLockerProvider
+	keyFuncs map[string]LockKeyFunc
 }
 
 // WithTimeout is an Option that sets the timeout used by the interceptor.
@@ -40,6 +44,17 @@ func WithLockProvider(p mwtypes.VolumeLockerProvider) Option {
 	}
 }
 
+// WithLockKeyFunc is an Option that sets the function used to obtain the
+// lock keys for the RPC with the given method name, ex. "CreateVolume".
+// The function replaces the default key function for the method, if any,
+// and may be used to serialize access for RPCs that are not serialized
+// by default. A nil function disables serial access for the method.
+func WithLockKeyFunc(method string, f LockKeyFunc) Option {
+	return func(o *opts) {
+		o.keyFuncs[method] = f
+	}
+}
+
 // New returns a new server-side, gRPC interceptor
 // that provides serial access to volume resources across the following
 // RPCs:
@@ -50,9 +65,30 @@ func WithLockProvider(p mwtypes.VolumeLockerProvider) Option {
 //  * ControllerUnpublishVolume
 //  * NodePublishVolume
 //  * NodeUnpublishVolume
+//  * CreateVolumeGroupSnapshot
+//  * DeleteVolumeGroupSnapshot
+//
+// A CreateVolumeGroupSnapshot request holds the locks of all of its
+// source volumes. A DeleteVolumeGroupSnapshot request holds the lock of
+// the group snapshot ID as well as the locks of the group's source
+// volumes when they are known, i.e. when the group snapshot was returned
+// by a CreateVolumeGroupSnapshot or GetVolumeGroupSnapshot RPC handled
+// by the same interceptor.
+//
+// The keys used to lock each RPC may be changed with WithLockKeyFunc.
 func New(opts ...Option) grpc.UnaryServerInterceptor {
 
-	i := &interceptor{}
+	i := &interceptor{groups: map[string][]string{}}
+	i.opts.keyFuncs = map[string]LockKeyFunc{
+		"CreateVolume":              createVolumeKeys,
+		"DeleteVolume":              volumeIDKeys,
+		"ControllerPublishVolume":   volumeIDKeys,
+		"ControllerUnpublishVolume": volumeIDKeys,
+		"NodePublishVolume":         volumeIDKeys,
+		"NodeUnpublishVolume":       volumeIDKeys,
+		"CreateVolumeGroupSnapshot": sourceVolumeIDKeys,
+		"DeleteVolumeGroupSnapshot": i.groupSnapshotKeys,
+	}
 
 	// Configure the interceptor's options.
 	for _, setOpt := range opts {
@@ -73,6 +109,11 @@ func New(opts ...Option) grpc.UnaryServerInterceptor {
 
 type interceptor struct {
 	opts opts
+
+	// groups maps the IDs of the group snapshots seen by the interceptor
+	// to the IDs of their source volumes.
+	groupsMu sync.Mutex
+	groups   map[string][]string
 }
 
 func (i *interceptor) handle(
@@ -81,146 +122,189 @@ func (i *interceptor) handle(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
 
-	switch treq := req.(type) {
-	case *csi.ControllerPublishVolumeRequest:
-		return i.controllerPublishVolume(ctx, treq, info, handler)
-	case *csi.ControllerUnpublishVolumeRequest:
-		return i.controllerUnpublishVolume(ctx, treq, info, handler)
-	case *csi.CreateVolumeRequest:
-		return i.createVolume(ctx, treq, info, handler)
-	case *csi.DeleteVolumeRequest:
-		return i.deleteVolume(ctx, treq, info, handler)
-	case *csi.NodePublishVolumeRequest:
-		return i.nodePublishVolume(ctx, treq, info, handler)
-	case *csi.NodeUnpublishVolumeRequest:
-		return i.nodeUnpublishVolume(ctx, treq, info, handler)
-	}
-
-	return handler(ctx, req)
-}
-
-func (i *interceptor) controllerPublishVolume(
-	ctx context.Context,
-	req *csi.ControllerPublishVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
-
-	lock, err := i.opts.locker.GetLockWithID(ctx, req.VolumeId)
+	_, _, method, err := utils.ParseMethod(info.FullMethod)
 	if err != nil {
-		return nil, err
-	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
+		return handler(ctx, req)
 	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
+	keyFunc := i.opts.keyFuncs[method]
+	if keyFunc == nil {
+		return handler(ctx, req)
 	}
-	defer lock.Unlock()
-
-	return handler(ctx, req)
-}
 
-func (i *interceptor) controllerUnpublishVolume(
-	ctx context.Context,
-	req *csi.ControllerUnpublishVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
-
-	lock, err := i.opts.locker.GetLockWithID(ctx, req.VolumeId)
+	keys, err := keyFunc(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
-	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
+
+	locks, err := i.lock(ctx, sortLockKeys(keys))
+	defer func() {
+		for j := len(locks) - 1; j >= 0; j-- {
+			if closer, ok := locks[j].(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}()
+	if err != nil {
+		return nil, err
 	}
-	defer lock.Unlock()
+	defer unlock(locks)
 
-	return handler(ctx, req)
+	rep, err := handler(ctx, req)
+	if err == nil {
+		i.trackGroupSnapshot(req, rep)
+	}
+	return rep, err
 }
 
-func (i *interceptor) createVolume(
-	ctx context.Context,
-	req *csi.CreateVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
-
-	lock, err := i.opts.locker.GetLockWithName(ctx, req.Name)
-	if err != nil {
-		return nil, err
+// trackGroupSnapshot records or forgets the source volumes of the group
+// snapshot in a successful group snapshot response.
+func (i *interceptor) trackGroupSnapshot(req, rep interface{}) {
+	var g *csi.VolumeGroupSnapshot
+	switch r := rep.(type) {
+	case *csi.CreateVolumeGroupSnapshotResponse:
+		g = r.GetGroupSnapshot()
+	case *csi.GetVolumeGroupSnapshotResponse:
+		g = r.GetGroupSnapshot()
+	case *csi.DeleteVolumeGroupSnapshotResponse:
+		if r, ok := req.(*csi.DeleteVolumeGroupSnapshotRequest); ok {
+			i.groupsMu.Lock()
+			delete(i.groups, r.GroupSnapshotId)
+			i.groupsMu.Unlock()
+		}
+		return
 	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
+	if g.GetGroupSnapshotId() == "" {
+		return
 	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
+	ids := make([]string, 0, len(g.Snapshots))
+	for _, s := range g.Snapshots {
+		if id := s.GetSourceVolumeId(); id != "" {
+			ids = append(ids, id)
+		}
 	}
-	defer lock.Unlock()
-
-	return handler(ctx, req)
+	i.groupsMu.Lock()
+	i.groups[g.GroupSnapshotId] = ids
+	i.groupsMu.Unlock()
 }
 
-func (i *interceptor) deleteVolume(
+// lock obtains the locks for the given keys in order. The returned slice
+// contains every lock that was obtained from the lock provider. If an
+// error is returned then none of the locks are held on return.
+func (i *interceptor) lock(
 	ctx context.Context,
-	req *csi.DeleteVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
-
-	lock, err := i.opts.locker.GetLockWithID(ctx, req.VolumeId)
-	if err != nil {
-		return nil, err
+	keys []LockKey) ([]gosync.TryLocker, error) {
+
+	var (
+		locks    []gosync.TryLocker
+		timeout  = i.opts.timeout
+		deadline = time.Now().Add(timeout)
+	)
+
+	for n, k := range keys {
+		var (
+			lock gosync.TryLocker
+			err  error
+		)
+		switch k.Type {
+		case LockKeyTypeName:
+			lock, err = i.opts.locker.GetLockWithName(ctx, k.Value)
+		default:
+			lock, err = i.opts.locker.GetLockWithID(ctx, k.Value)
+		}
+		if err != nil {
+			unlock(locks[:n])
+			return locks, err
+		}
+		locks = append(locks, lock)
+
+		// Each lock is given whatever time remains of the overall
+		// timeout. A zero timeout results in a single attempt per lock.
+		t := timeout
+		if timeout > 0 {
+			if t = time.Until(deadline); t <= 0 {
+				unlock(locks[:n])
+				return locks, status.Error(codes.Aborted, pending)
+			}
+		}
+		ok, err := tryLock(lock, t)
+		if err != nil {
+			unlock(locks[:n])
+			return locks, status.Error(codes.Unavailable, err.Error())
+		}
+		if !ok {
+			unlock(locks[:n])
+			return locks, status.Error(codes.Aborted, pending)
+		}
 	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
+
+	return locks, nil
+}
+
+func tryLock(lock gosync.TryLocker, timeout time.Duration) (bool, error) {
+	if l, ok := lock.(mwtypes.TryLockerWithError); ok {
+		return l.TryLockWithError(timeout)
 	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
+	return lock.TryLock(timeout), nil
+}
+
+func unlock(locks []gosync.TryLocker) {
+	for j := len(locks) - 1; j >= 0; j-- {
+		if l, ok := locks[j].(mwtypes.TryLockerWithError); ok {
+			if err := l.UnlockWithError(); err != nil {
+				log.Errorf("serialvolume: unlock failed: %v", err)
+			}
+			continue
+		}
+		locks[j].Unlock()
 	}
-	defer lock.Unlock()
+}
 
-	return handler(ctx, req)
+func createVolumeKeys(
+	ctx context.Context, req interface{}) ([]LockKey, error) {
+
+	if r, ok := req.(*csi.CreateVolumeRequest); ok {
+		return []LockKey{{Type: LockKeyTypeName, Value: r.Name}}, nil
+	}
+	return nil, nil
 }
 
-func (i *interceptor) nodePublishVolume(
-	ctx context.Context,
-	req *csi.NodePublishVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
+func volumeIDKeys(
+	ctx context.Context, req interface{}) ([]LockKey, error) {
 
-	lock, err := i.opts.locker.GetLockWithID(ctx, req.VolumeId)
-	if err != nil {
-		return nil, err
+	if r, ok := req.(interface {
+		GetVolumeId() string
+	}); ok {
+		return []LockKey{{Type: LockKeyTypeID, Value: r.GetVolumeId()}}, nil
 	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
+	return nil, nil
+}
+
+func sourceVolumeIDKeys(
+	ctx context.Context, req interface{}) ([]LockKey, error) {
+
+	r, ok := req.(*csi.CreateVolumeGroupSnapshotRequest)
+	if !ok {
+		return nil, nil
 	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
+	keys := make([]LockKey, len(r.SourceVolumeIds))
+	for j, id := range r.SourceVolumeIds {
+		keys[j] = LockKey{Type: LockKeyTypeID, Value: id}
 	}
-	defer lock.Unlock()
-
-	return handler(ctx, req)
+	return keys, nil
 }
 
-func (i *interceptor) nodeUnpublishVolume(
-	ctx context.Context,
-	req *csi.NodeUnpublishVolumeRequest,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (res interface{}, resErr error) {
+func (i *interceptor) groupSnapshotKeys(
+	ctx context.Context, req interface{}) ([]LockKey, error) {
 
-	lock, err := i.opts.locker.GetLockWithID(ctx, req.VolumeId)
-	if err != nil {
-		return nil, err
+	r, ok := req.(*csi.DeleteVolumeGroupSnapshotRequest)
+	if !ok {
+		return nil, nil
 	}
-	if closer, ok := lock.(io.Closer); ok {
-		defer closer.Close()
+	keys := []LockKey{{Type: LockKeyTypeID, Value: r.GroupSnapshotId}}
+	i.groupsMu.Lock()
+	for _, id := range i.groups[r.GroupSnapshotId] {
+		keys = append(keys, LockKey{Type: LockKeyTypeID, Value: id})
 	}
-	if !lock.TryLock(i.opts.timeout) {
-		return nil, status.Error(codes.Aborted, pending)
-	}
-	defer lock.Unlock()
-
-	return handler(ctx, req)
+	i.groupsMu.Unlock()
+	return keys, nil
 }
@@ -0,0 +1,356 @@
+package serialvolume_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akutz/gosync"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/serialvolume"
+)
+
+const (
+	createVolume  = "/csi.v1.Controller/CreateVolume"
+	deleteVolume  = "/csi.v1.Controller/DeleteVolume"
+	ctrlPublish   = "/csi.v1.Controller/ControllerPublishVolume"
+	listVolumes   = "/csi.v1.Controller/ListVolumes"
+	createGroup   = "/csi.v1.GroupController/CreateVolumeGroupSnapshot"
+	deleteGroup   = "/csi.v1.GroupController/DeleteVolumeGroupSnapshot"
+	pendingErrMsg = "pending"
+)
+
+// recordingProvider is an in-memory lock provider that records the order
+// in which locks are requested.
+type recordingProvider struct {
+	sync.Mutex
+	locks map[string]gosync.TryLocker
+	order []string
+}
+
+func newRecordingProvider() *recordingProvider {
+	return &recordingProvider{locks: map[string]gosync.TryLocker{}}
+}
+
+func (p *recordingProvider) get(key string) gosync.TryLocker {
+	p.Lock()
+	defer p.Unlock()
+	p.order = append(p.order, key)
+	l := p.locks[key]
+	if l == nil {
+		l = &gosync.TryMutex{}
+		p.locks[key] = l
+	}
+	return l
+}
+
+func (p *recordingProvider) GetLockWithID(
+	ctx context.Context, id string) (gosync.TryLocker, error) {
+	return p.get("id:" + id), nil
+}
+
+func (p *recordingProvider) GetLockWithName(
+	ctx context.Context, name string) (gosync.TryLocker, error) {
+	return p.get("name:" + name), nil
+}
+
+func invoke(
+	i grpc.UnaryServerInterceptor,
+	method string,
+	req interface{},
+	handler grpc.UnaryHandler) error {
+
+	_, err := i(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		handler)
+	return err
+}
+
+func noop(ctx context.Context, req interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func assertPending(t *testing.T, err error) {
+	t.Helper()
+	if s, ok := status.FromError(err); !ok ||
+		s.Code() != codes.Aborted || s.Message() != pendingErrMsg {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+}
+
+func TestDefaultKeys(t *testing.T) {
+	p := newRecordingProvider()
+	i := serialvolume.New(serialvolume.WithLockProvider(p))
+
+	// While DeleteVolume holds the volume ID lock a second DeleteVolume
+	// for the same volume is rejected.
+	err := invoke(i, deleteVolume, &csi.DeleteVolumeRequest{VolumeId: "1"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assertPending(t, invoke(i, deleteVolume,
+				&csi.DeleteVolumeRequest{VolumeId: "1"}, noop))
+			return nil, invoke(i, createVolume,
+				&csi.CreateVolumeRequest{Name: "1"}, noop)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RPCs without a key function are not serialized.
+	if err := invoke(i, listVolumes,
+		&csi.ListVolumesRequest{}, noop); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.order) != 3 {
+		t.Fatalf("unexpected lock requests: %v", p.order)
+	}
+}
+
+func TestGroupSnapshotKeys(t *testing.T) {
+	p := newRecordingProvider()
+	i := serialvolume.New(serialvolume.WithLockProvider(p))
+
+	// A group snapshot holds the locks of all of its source volumes.
+	err := invoke(i, createGroup,
+		&csi.CreateVolumeGroupSnapshotRequest{
+			Name:            "group",
+			SourceVolumeIds: []string{"2", "1", "2"},
+		},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assertPending(t, invoke(i, deleteVolume,
+				&csi.DeleteVolumeRequest{VolumeId: "1"}, noop))
+			assertPending(t, invoke(i, deleteVolume,
+				&csi.DeleteVolumeRequest{VolumeId: "2"}, noop))
+			return nil, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{"id:1", "id:2", "id:1", "id:2"}
+	if len(p.order) != len(exp) {
+		t.Fatalf("unexpected lock requests: %v", p.order)
+	}
+	for j := range exp {
+		if p.order[j] != exp[j] {
+			t.Fatalf("unexpected lock order: %v", p.order)
+		}
+	}
+}
+
+func TestDeleteGroupSnapshotKeys(t *testing.T) {
+	p := newRecordingProvider()
+	i := serialvolume.New(serialvolume.WithLockProvider(p))
+	del := &csi.DeleteVolumeGroupSnapshotRequest{GroupSnapshotId: "g"}
+
+	// An unknown group snapshot is locked by its ID alone.
+	err := invoke(i, deleteGroup, del,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assertPending(t, invoke(i, deleteGroup, del, noop))
+			return nil, errors.New("failed")
+		})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Once the group snapshot has been created its source volumes are
+	// locked as well.
+	_, err = i(context.Background(),
+		&csi.CreateVolumeGroupSnapshotRequest{
+			Name:            "group",
+			SourceVolumeIds: []string{"1", "2"},
+		},
+		&grpc.UnaryServerInfo{FullMethod: createGroup},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &csi.CreateVolumeGroupSnapshotResponse{
+				GroupSnapshot: &csi.VolumeGroupSnapshot{
+					GroupSnapshotId: "g",
+					Snapshots: []*csi.Snapshot{
+						{SnapshotId: "s1", SourceVolumeId: "1"},
+						{SnapshotId: "s2", SourceVolumeId: "2"},
+					},
+				},
+			}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.order = nil
+	err = invoke(i, deleteGroup, del,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assertPending(t, invoke(i, deleteVolume,
+				&csi.DeleteVolumeRequest{VolumeId: "2"}, noop))
+			return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"id:1", "id:2", "id:g", "id:2"}
+	if len(p.order) != len(exp) {
+		t.Fatalf("unexpected lock requests: %v", p.order)
+	}
+	for j := range exp {
+		if p.order[j] != exp[j] {
+			t.Fatalf("unexpected lock order: %v", p.order)
+		}
+	}
+
+	// A deleted group snapshot is forgotten.
+	p.order = nil
+	if err := invoke(i, deleteGroup, del, noop); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.order) != 1 || p.order[0] != "id:g" {
+		t.Fatalf("unexpected lock requests: %v", p.order)
+	}
+}
+
+func TestWithLockKeyFunc(t *testing.T) {
+	p := newRecordingProvider()
+	i := serialvolume.New(
+		serialvolume.WithLockProvider(p),
+		serialvolume.WithLockKeyFunc(
+			"CreateVolume",
+			func(ctx context.Context, req interface{}) (
+				[]serialvolume.LockKey, error) {
+
+				r := req.(*csi.CreateVolumeRequest)
+				keys := []serialvolume.LockKey{
+					{Type: serialvolume.LockKeyTypeName, Value: r.Name},
+					{Type: serialvolume.LockKeyTypeID, Value: r.Name},
+				}
+				if s := r.GetVolumeContentSource().GetSnapshot(); s != nil {
+					keys = append(keys, serialvolume.LockKey{
+						Type:  serialvolume.LockKeyTypeID,
+						Value: s.SnapshotId,
+					})
+				}
+				return keys, nil
+			}),
+		serialvolume.WithLockKeyFunc(
+			"ControllerPublishVolume",
+			func(ctx context.Context, req interface{}) (
+				[]serialvolume.LockKey, error) {
+
+				r := req.(*csi.ControllerPublishVolumeRequest)
+				return []serialvolume.LockKey{{
+					Type:  serialvolume.LockKeyTypeID,
+					Value: r.VolumeId + "@" + r.NodeId,
+				}}, nil
+			}))
+
+	createReq := &csi.CreateVolumeRequest{
+		Name: "vol",
+		VolumeContentSource: &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{
+					SnapshotId: "snap",
+				},
+			},
+		},
+	}
+
+	// A DeleteVolume for the volume ID "vol" conflicts with CreateVolume.
+	err := invoke(i, createVolume, createReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assertPending(t, invoke(i, deleteVolume,
+				&csi.DeleteVolumeRequest{VolumeId: "vol"}, noop))
+			return nil, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are acquired sorted by type and then value.
+	exp := []string{"id:snap", "id:vol", "name:vol", "id:vol"}
+	if len(p.order) != len(exp) {
+		t.Fatalf("unexpected lock requests: %v", p.order)
+	}
+	for j := range exp {
+		if p.order[j] != exp[j] {
+			t.Fatalf("unexpected lock order: %v", p.order)
+		}
+	}
+
+	// Publishing the same volume to different nodes is not serialized.
+	err = invoke(i, ctrlPublish,
+		&csi.ControllerPublishVolumeRequest{VolumeId: "vol", NodeId: "a"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, invoke(i, ctrlPublish,
+				&csi.ControllerPublishVolumeRequest{
+					VolumeId: "vol", NodeId: "b"}, noop)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPartialLockReleased(t *testing.T) {
+	p := newRecordingProvider()
+	i := serialvolume.New(
+		serialvolume.WithLockProvider(p),
+		serialvolume.WithTimeout(time.Millisecond*10),
+		serialvolume.WithLockKeyFunc(
+			"DeleteVolume",
+			func(ctx context.Context, req interface{}) (
+				[]serialvolume.LockKey, error) {
+
+				return []serialvolume.LockKey{
+					{Type: serialvolume.LockKeyTypeID, Value: "a"},
+					{Type: serialvolume.LockKeyTypeID, Value: "b"},
+				}, nil
+			}))
+
+	// Hold "b" so that DeleteVolume obtains "a" but fails on "b".
+	b, _ := p.GetLockWithID(context.Background(), "b")
+	b.Lock()
+	assertPending(t, invoke(i, deleteVolume, &csi.DeleteVolumeRequest{}, noop))
+	b.Unlock()
+
+	a, _ := p.GetLockWithID(context.Background(), "a")
+	if !a.TryLock(0) {
+		t.Fatal("lock a was not released")
+	}
+	a.Unlock()
+}
+
+// errLock is a lock whose operations always fail.
+type errLock struct {
+	gosync.TryMutex
+}
+
+func (l *errLock) TryLockWithError(time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (l *errLock) UnlockWithError() error {
+	return nil
+}
+
+type errProvider struct{}
+
+func (p errProvider) GetLockWithID(
+	ctx context.Context, id string) (gosync.TryLocker, error) {
+	return &errLock{}, nil
+}
+
+func (p errProvider) GetLockWithName(
+	ctx context.Context, name string) (gosync.TryLocker, error) {
+	return &errLock{}, nil
+}
+
+func TestLockError(t *testing.T) {
+	i := serialvolume.New(serialvolume.WithLockProvider(errProvider{}))
+	err := invoke(i, deleteVolume, &csi.DeleteVolumeRequest{VolumeId: "1"}, noop)
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.Unavailable {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"time"
 
 	"github.com/akutz/gosync"
 )
@@ -19,3 +20,20 @@ type VolumeLockerProvider interface {
 	// and returned.
 	GetLockWithName(ctx context.Context, name string) (gosync.TryLocker, error)
 }
+
+// TryLockerWithError is a gosync.TryLocker whose lock operations may fail
+// for reasons other than contention, such as a lost connection to a remote
+// lock service. The serial volume interceptor prefers these functions when
+// a lock implements them so that such failures are reported to the client
+// instead of being treated as a pending operation.
+type TryLockerWithError interface {
+	gosync.TryLocker
+
+	// TryLockWithError attempts to obtain the lock within the specified
+	// duration. A false value with a nil error indicates the lock is held
+	// by someone else.
+	TryLockWithError(timeout time.Duration) (bool, error)
+
+	// UnlockWithError releases the lock.
+	UnlockWithError() error
+}
@@ -0,0 +1,118 @@
+package specvalidator
+
+import (
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func hasControllerCapability(
+	caps []*csi.ControllerServiceCapability,
+	t csi.ControllerServiceCapability_RPC_Type) bool {
+
+	for _, c := range caps {
+		if rpc := c.GetRpc(); rpc != nil && rpc.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNodeCapability(
+	caps []*csi.NodeServiceCapability,
+	t csi.NodeServiceCapability_RPC_Type) bool {
+
+	for _, c := range caps {
+		if rpc := c.GetRpc(); rpc != nil && rpc.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isSingleNodeMultiWriterMode returns a flag indicating whether the mode
+// is one of the access modes that require the SINGLE_NODE_MULTI_WRITER
+// capability.
+func isSingleNodeMultiWriterMode(m csi.VolumeCapability_AccessMode_Mode) bool {
+	return m == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER ||
+		m == csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER
+}
+
+// validateControllerAccessMode records a violation if volCap's access mode
+// requires the SINGLE_NODE_MULTI_WRITER controller capability and the
+// plug-in's controller capabilities are known not to include it.
+func (s *interceptor) validateControllerAccessMode(
+	volCap *csi.VolumeCapability,
+	v *violations) {
+
+	if !s.opts.hasCtrlrCaps || hasControllerCapability(s.opts.ctrlrCaps,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER) {
+		return
+	}
+	validateAccessMode(volCap, "volume_capability", "VolumeCapability",
+		"controller", v)
+}
+
+// validateControllerAccessModes is validateControllerAccessMode for each
+// of volCaps.
+func (s *interceptor) validateControllerAccessModes(
+	volCaps []*csi.VolumeCapability,
+	v *violations) {
+
+	if !s.opts.hasCtrlrCaps || hasControllerCapability(s.opts.ctrlrCaps,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER) {
+		return
+	}
+	for i, volCap := range volCaps {
+		validateAccessMode(volCap,
+			fmt.Sprintf("volume_capabilities[%d]", i),
+			fmt.Sprintf("VolumeCapabilities[%d]", i),
+			"controller", v)
+	}
+}
+
+// validateNodeAccessMode records a violation if volCap's access mode
+// requires the SINGLE_NODE_MULTI_WRITER node capability and the plug-in's
+// node capabilities are known not to include it.
+func (s *interceptor) validateNodeAccessMode(
+	volCap *csi.VolumeCapability,
+	v *violations) {
+
+	if !s.opts.hasNodeCaps || hasNodeCapability(s.opts.nodeCaps,
+		csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER) {
+		return
+	}
+	validateAccessMode(volCap, "volume_capability", "VolumeCapability",
+		"node", v)
+}
+
+func validateAccessMode(
+	volCap *csi.VolumeCapability,
+	field, name, service string,
+	v *violations) {
+
+	if m := volCap.GetAccessMode().GetMode(); isSingleNodeMultiWriterMode(m) {
+		v.addf(field+".access_mode.mode",
+			"unsupported: %s.AccessMode.Mode=%s: "+
+				"missing %s capability SINGLE_NODE_MULTI_WRITER",
+			name, m, service)
+	}
+}
+
+// validateVolumeMountGroup records a violation if volCap specifies a
+// volume mount group and the plug-in's node capabilities are known not to
+// include VOLUME_MOUNT_GROUP.
+func (s *interceptor) validateVolumeMountGroup(
+	volCap *csi.VolumeCapability,
+	v *violations) {
+
+	if !s.opts.hasNodeCaps || hasNodeCapability(s.opts.nodeCaps,
+		csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP) {
+		return
+	}
+	if volCap.GetMount().GetVolumeMountGroup() != "" {
+		v.add("volume_capability.mount.volume_mount_group",
+			"unsupported: VolumeCapability.Mount.VolumeMountGroup: "+
+				"missing node capability VOLUME_MOUNT_GROUP")
+	}
+}
@@ -0,0 +1,341 @@
+package specvalidator_test
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+func controllerCaps(
+	types ...csi.ControllerServiceCapability_RPC_Type) []*csi.ControllerServiceCapability {
+
+	var caps []*csi.ControllerServiceCapability
+	for _, t := range types {
+		caps = append(caps, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{Type: t},
+			},
+		})
+	}
+	return caps
+}
+
+func fieldsOf(err error) []string {
+	var fields []string
+	for _, fv := range specvalidator.FieldViolations(err) {
+		fields = append(fields, fv.Field)
+	}
+	return fields
+}
+
+func TestControllerGetVolumeResponse(t *testing.T) {
+	const controllerGetVolume = "/csi.v1.Controller/ControllerGetVolume"
+
+	var (
+		req = &csi.ControllerGetVolumeRequest{VolumeId: "1"}
+		rep = &csi.ControllerGetVolumeResponse{
+			Volume: &csi.Volume{VolumeId: "1"},
+			Status: &csi.ControllerGetVolumeResponse_VolumeStatus{},
+		}
+	)
+
+	// The condition is optional without the VOLUME_CONDITION capability.
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+	if err := invokeWithResponse(
+		i, controllerGetVolume, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithControllerCapabilities(controllerCaps(
+			csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION)...))
+	err := invokeWithResponse(i, controllerGetVolume, req, rep)
+	if f := fieldsOf(err); len(f) != 1 || f[0] != "status.volume_condition" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	rep.Status.VolumeCondition = &csi.VolumeCondition{Abnormal: true}
+	rep.Status.PublishedNodeIds = []string{"n1", ""}
+	err = invokeWithResponse(i, controllerGetVolume, req, rep)
+	if f := fieldsOf(err); len(f) != 2 ||
+		f[0] != "status.published_node_ids[1]" ||
+		f[1] != "status.volume_condition.message" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	rep.Status.VolumeCondition.Message = "degraded"
+	rep.Status.PublishedNodeIds = []string{"n1"}
+	if err := invokeWithResponse(
+		i, controllerGetVolume, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	err = invokeWithResponse(i, controllerGetVolume, req,
+		&csi.ControllerGetVolumeResponse{})
+	if f := fieldsOf(err); len(f) != 2 ||
+		f[0] != "volume" || f[1] != "status" {
+		t.Fatalf("violations=%v", f)
+	}
+}
+
+func TestListVolumesResponse_Status(t *testing.T) {
+	const listVolumes = "/csi.v1.Controller/ListVolumes"
+
+	var (
+		req = &csi.ListVolumesRequest{}
+		rep = &csi.ListVolumesResponse{
+			Entries: []*csi.ListVolumesResponse_Entry{
+				{Volume: &csi.Volume{VolumeId: "1"}},
+			},
+		}
+	)
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+	if err := invokeWithResponse(i, listVolumes, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithControllerCapabilities(controllerCaps(
+			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION)...))
+	err := invokeWithResponse(i, listVolumes, req, rep)
+	if f := fieldsOf(err); len(f) != 1 || f[0] != "entries[0].status" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	rep.Entries[0].Status = &csi.ListVolumesResponse_VolumeStatus{}
+	err = invokeWithResponse(i, listVolumes, req, rep)
+	if f := fieldsOf(err); len(f) != 1 ||
+		f[0] != "entries[0].status.volume_condition" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	rep.Entries[0].Status.VolumeCondition = &csi.VolumeCondition{
+		Message: "healthy",
+	}
+	if err := invokeWithResponse(i, listVolumes, req, rep); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodeGetVolumeStatsResponse_Condition(t *testing.T) {
+	const nodeGetVolumeStats = "/csi.v1.Node/NodeGetVolumeStats"
+
+	var (
+		req = &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "1",
+			VolumePath: "/mnt/1",
+		}
+		rep  = &csi.NodeGetVolumeStatsResponse{}
+		caps = []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
+		}
+	)
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+	if err := invokeWithResponse(
+		i, nodeGetVolumeStats, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithNodeCapabilities(caps...))
+	err := invokeWithResponse(i, nodeGetVolumeStats, req, rep)
+	if f := fieldsOf(err); len(f) != 1 || f[0] != "volume_condition" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	rep.VolumeCondition = &csi.VolumeCondition{Message: "healthy"}
+	if err := invokeWithResponse(
+		i, nodeGetVolumeStats, req, rep); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControllerGetCapabilitiesResponse_PublishedNodes(t *testing.T) {
+	const controllerGetCapabilities = "/csi.v1.Controller/ControllerGetCapabilities"
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+	req := &csi.ControllerGetCapabilitiesRequest{}
+
+	err := invokeWithResponse(i, controllerGetCapabilities, req,
+		&csi.ControllerGetCapabilitiesResponse{
+			Capabilities: controllerCaps(
+				csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+				csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES),
+		})
+	if f := fieldsOf(err); len(f) != 1 || f[0] != "capabilities" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	if err := invokeWithResponse(i, controllerGetCapabilities, req,
+		&csi.ControllerGetCapabilitiesResponse{
+			Capabilities: controllerCaps(
+				csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+				csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+				csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES),
+		}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSingleNodeAccessModes_Controller(t *testing.T) {
+	req := newCreateVolumeRequest(nil, gib4)
+	req.VolumeCapabilities[0].AccessMode.Mode =
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER
+
+	// The mode is allowed if the capabilities are unknown.
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+	if _, err := invoke(i, createVolume, req); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithControllerCapabilities(controllerCaps(
+			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME)...))
+	_, err := invoke(i, createVolume, req)
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+	if f := fieldsOf(err); len(f) != 1 ||
+		f[0] != "volume_capabilities[0].access_mode.mode" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithControllerCapabilities(controllerCaps(
+			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+			csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER)...))
+	if _, err := invoke(i, createVolume, req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSingleNodeAccessModes_Node(t *testing.T) {
+	const nodePublishVolume = "/csi.v1.Node/NodePublishVolume"
+
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:   "1",
+		TargetPath: "/mnt/1",
+		VolumeCapability: &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+			},
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+		},
+	}
+	nodeCaps := func(
+		types ...csi.NodeServiceCapability_RPC_Type) specvalidator.Option {
+
+		var caps []*csi.NodeServiceCapability
+		for _, t := range types {
+			caps = append(caps, &csi.NodeServiceCapability{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{Type: t},
+				},
+			})
+		}
+		return specvalidator.WithNodeCapabilities(caps...)
+	}
+
+	// The node capabilities are known, but do not include the
+	// SINGLE_NODE_MULTI_WRITER capability.
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(), nodeCaps())
+	_, err := invoke(i, nodePublishVolume, req)
+	if f := fieldsOf(err); len(f) != 1 ||
+		f[0] != "volume_capability.access_mode.mode" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	// SINGLE_NODE_WRITER is always allowed.
+	req.VolumeCapability.AccessMode.Mode =
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	if _, err := invoke(i, nodePublishVolume, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.VolumeCapability.AccessMode.Mode =
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		nodeCaps(csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER))
+	if _, err := invoke(i, nodePublishVolume, req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVolumeMountGroup(t *testing.T) {
+	const nodeStageVolume = "/csi.v1.Node/NodeStageVolume"
+
+	req := &csi.NodeStageVolumeRequest{
+		VolumeId:          "1",
+		StagingTargetPath: "/mnt/1",
+		VolumeCapability: &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{
+					FsType:           "nfs",
+					VolumeMountGroup: "1000",
+				},
+			},
+		},
+	}
+
+	// The mount group is not validated if the node capabilities are
+	// not known.
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+	if _, err := invoke(i, nodeStageVolume, req); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithNodeCapabilities())
+	_, err := invoke(i, nodeStageVolume, req)
+	if f := fieldsOf(err); len(f) != 1 ||
+		f[0] != "volume_capability.mount.volume_mount_group" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithNodeCapabilities(&csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+				},
+			},
+		}))
+	if _, err := invoke(i, nodeStageVolume, req); err != nil {
+		t.Fatal(err)
+	}
+}
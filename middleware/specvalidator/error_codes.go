@@ -0,0 +1,165 @@
+package specvalidator
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/utils"
+)
+
+// WithErrorCodeValidation is a Option that enables validation of the
+// gRPC status codes of the errors returned by RPCs against the codes the
+// CSI specification permits for each RPC. In response report-only mode
+// unexpected codes are logged and counted and the error is returned
+// unchanged. Otherwise an error with an unexpected code, or an error that
+// is not a gRPC status error, is replaced by an error with a code of
+// Internal that describes the violation.
+func WithErrorCodeValidation() Option {
+	return func(o *opts) {
+		o.errCodeValidation = true
+	}
+}
+
+// commonErrorCodes are the codes any RPC may return. They are the codes
+// from the spec's general error table along with the codes gRPC returns
+// when a call is cancelled, times out, or cannot reach the server.
+var commonErrorCodes = []codes.Code{
+	codes.InvalidArgument,
+	codes.PermissionDenied,
+	codes.Aborted,
+	codes.Unimplemented,
+	codes.Unauthenticated,
+	codes.Canceled,
+	codes.DeadlineExceeded,
+	codes.Unavailable,
+}
+
+// allowedErrorCodes are the codes each RPC may return in addition to
+// commonErrorCodes, as listed in the RPC's error table in the spec.
+var allowedErrorCodes = map[string][]codes.Code{
+	// Identity Service
+	"GetPluginInfo":         nil,
+	"GetPluginCapabilities": nil,
+	"Probe":                 {codes.FailedPrecondition},
+
+	// Controller Service
+	"CreateVolume": {
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.ResourceExhausted,
+		codes.OutOfRange,
+	},
+	"DeleteVolume": {codes.FailedPrecondition},
+	"ControllerPublishVolume": {
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.FailedPrecondition,
+		codes.ResourceExhausted,
+	},
+	"ControllerUnpublishVolume":  {codes.NotFound},
+	"ValidateVolumeCapabilities": {codes.NotFound},
+	"ListVolumes":                nil,
+	"ControllerGetVolume":        {codes.NotFound},
+	"GetCapacity":                nil,
+	"ControllerGetCapabilities":  nil,
+	"CreateSnapshot": {
+		codes.AlreadyExists,
+		codes.ResourceExhausted,
+	},
+	"DeleteSnapshot": {codes.FailedPrecondition},
+	"ListSnapshots":  nil,
+	"ControllerExpandVolume": {
+		codes.NotFound,
+		codes.FailedPrecondition,
+		codes.OutOfRange,
+	},
+
+	// Node Service
+	"NodeStageVolume": {
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.FailedPrecondition,
+	},
+	"NodeUnstageVolume": {codes.NotFound, codes.FailedPrecondition},
+	"NodePublishVolume": {
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.FailedPrecondition,
+	},
+	"NodeUnpublishVolume": {codes.NotFound},
+	"NodeGetVolumeStats":  {codes.NotFound},
+	"NodeExpandVolume": {
+		codes.NotFound,
+		codes.FailedPrecondition,
+		codes.OutOfRange,
+	},
+	"NodeGetCapabilities": nil,
+	"NodeGetInfo":         nil,
+
+	// GroupController Service
+	"GroupControllerGetCapabilities": nil,
+	"CreateVolumeGroupSnapshot": {
+		codes.AlreadyExists,
+		codes.FailedPrecondition,
+		codes.ResourceExhausted,
+	},
+	"DeleteVolumeGroupSnapshot": {codes.FailedPrecondition},
+	"GetVolumeGroupSnapshot":    {codes.NotFound},
+}
+
+func isAllowedErrorCode(c codes.Code, allowed []codes.Code) bool {
+	for _, a := range commonErrorCodes {
+		if c == a {
+			return true
+		}
+	}
+	for _, a := range allowed {
+		if c == a {
+			return true
+		}
+	}
+	return false
+}
+
+// validateError returns the error to return to the caller in place of
+// the error err returned by the RPC.
+func (s *interceptor) validateError(
+	ctx context.Context,
+	method string,
+	err error) error {
+
+	_, _, name, perr := utils.ParseMethod(method)
+	if perr != nil {
+		return err
+	}
+	allowed, ok := allowedErrorCodes[name]
+	if !ok {
+		return err
+	}
+
+	v := &violations{code: codes.Internal}
+
+	switch st, isStatus := status.FromError(err); {
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		// gRPC converts these to Canceled and DeadlineExceeded.
+	case !isStatus:
+		// A plain error is returned to the client as Unknown. It is only
+		// flagged in strict mode.
+		if !s.opts.repReportOnly {
+			v.addf("", "not a gRPC status error: %v", err)
+		}
+	case !isAllowedErrorCode(st.Code(), allowed):
+		v.addf("", "unexpected error code %s: %s", st.Code(), st.Message())
+	}
+
+	verr := v.err()
+	if verr == nil {
+		return err
+	}
+	if s.opts.repReportOnly {
+		report(ctx, method, directionResponse, verr)
+		return err
+	}
+	return verr
+}
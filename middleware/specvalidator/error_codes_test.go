@@ -0,0 +1,103 @@
+package specvalidator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+func invokeWithError(
+	i grpc.UnaryServerInterceptor,
+	method string,
+	req interface{},
+	err error) error {
+
+	_, err = i(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+	return err
+}
+
+func TestErrorCodes_Strict(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithErrorCodeValidation())
+	req := newCreateVolumeRequest(nil, gib4)
+
+	for _, tc := range []struct {
+		method string
+		err    error
+		code   codes.Code
+	}{
+		{createVolume, status.Error(codes.AlreadyExists, "exists"),
+			codes.AlreadyExists},
+		{createVolume, status.Error(codes.Aborted, "pending"),
+			codes.Aborted},
+		{createVolume, status.Error(codes.Unknown, "oops"),
+			codes.Internal},
+		{createVolume, errors.New("oops"),
+			codes.Internal},
+		{"/csi.v1.Node/NodeUnstageVolume",
+			status.Error(codes.NotFound, "missing"), codes.NotFound},
+		{"/csi.v1.Node/NodeUnstageVolume",
+			status.Error(codes.FailedPrecondition, "in use"),
+			codes.FailedPrecondition},
+		{"/csi.v1.Node/NodeUnstageVolume",
+			status.Error(codes.AlreadyExists, "exists"), codes.Internal},
+		{"/csi.v1.Controller/ControllerExpandVolume",
+			status.Error(codes.NotFound, "missing"), codes.NotFound},
+		{"/csi.v1.Node/NodeExpandVolume",
+			status.Error(codes.NotFound, "missing"), codes.NotFound},
+		{"/csi.v1.Controller/DeleteVolume",
+			status.Error(codes.FailedPrecondition, "in use"),
+			codes.FailedPrecondition},
+		{"/csi.v1.Controller/DeleteVolume",
+			status.Error(codes.NotFound, "missing"), codes.Internal},
+	} {
+		err := invokeWithError(i, tc.method, req, tc.err)
+		if c := status.Code(err); c != tc.code {
+			t.Errorf("%s: %v: code=%v, expected %v",
+				tc.method, tc.err, c, tc.code)
+		}
+	}
+
+	err := invokeWithError(i, createVolume, req,
+		status.Error(codes.Unknown, "oops"))
+	if m := status.Convert(err).Message(); m !=
+		"unexpected error code Unknown: oops" {
+		t.Fatalf("msg=%s", m)
+	}
+}
+
+func TestErrorCodes_ReportOnly(t *testing.T) {
+	const key = "CreateVolume response: unexpected error code Internal"
+	n := violationCount(key)
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithErrorCodeValidation(),
+		specvalidator.WithResponseReportOnly())
+	req := newCreateVolumeRequest(nil, gib4)
+
+	exp := status.Error(codes.Internal, "oops")
+	if err := invokeWithError(i, createVolume, req, exp); err != exp {
+		t.Fatalf("err=%v", err)
+	}
+	if c := violationCount(key); c != n+1 {
+		t.Fatalf("count=%d, expected %d", c, n+1)
+	}
+
+	// Plain errors are only flagged in strict mode.
+	exp = errors.New("oops")
+	if err := invokeWithError(i, createVolume, req, exp); err != exp {
+		t.Fatalf("err=%v", err)
+	}
+}
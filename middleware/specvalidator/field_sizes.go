@@ -0,0 +1,317 @@
+package specvalidator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	maxFieldString = 128
+	maxFieldMap    = 4096
+)
+
+type fieldKind int
+
+const (
+	fieldString fieldKind = iota
+	fieldStrings
+	fieldMap
+	fieldMessage
+	fieldMessages
+	fieldOneof
+)
+
+// fieldPlan describes a struct field whose size is validated.
+type fieldPlan struct {
+	index int
+	kind  fieldKind
+	name  string
+	field string
+
+	// elem is the plan for the message or repeated message field's type.
+	elem *msgPlan
+}
+
+// msgPlan is the list of a message type's fields whose sizes are
+// validated. Plans are built once per type and cached.
+type msgPlan struct {
+	fields []fieldPlan
+}
+
+var (
+	msgPlans  sync.Map
+	msgPlansL sync.Mutex
+)
+
+// planFor returns the cached plan for the struct type t, building and
+// caching it and the plans of any nested message types if necessary.
+func planFor(t reflect.Type) *msgPlan {
+	if p, ok := msgPlans.Load(t); ok {
+		return p.(*msgPlan)
+	}
+
+	msgPlansL.Lock()
+	defer msgPlansL.Unlock()
+
+	// Plans are only published once they and the plans they refer to are
+	// complete, since a type may refer to itself.
+	building := map[reflect.Type]*msgPlan{}
+	p := buildPlan(t, building)
+	for bt, bp := range building {
+		msgPlans.Store(bt, bp)
+	}
+	return p
+}
+
+func buildPlan(t reflect.Type, building map[reflect.Type]*msgPlan) *msgPlan {
+	if p, ok := msgPlans.Load(t); ok {
+		return p.(*msgPlan)
+	}
+	if p, ok := building[t]; ok {
+		return p
+	}
+
+	p := &msgPlan{}
+	building[t] = p
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || strings.HasPrefix(sf.Name, "XXX_") {
+			continue
+		}
+		fp := fieldPlan{index: i, name: sf.Name, field: protoFieldName(sf)}
+		switch ft := sf.Type; ft.Kind() {
+		case reflect.String:
+			if isUnboundedString(t, sf.Name) {
+				continue
+			}
+			fp.kind = fieldString
+		case reflect.Map:
+			fp.kind = fieldMap
+		case reflect.Ptr:
+			if ft.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			fp.kind = fieldMessage
+			fp.elem = buildPlan(ft.Elem(), building)
+		case reflect.Slice:
+			switch et := ft.Elem(); {
+			case et.Kind() == reflect.String:
+				if isUnboundedString(t, sf.Name) {
+					continue
+				}
+				fp.kind = fieldStrings
+			case et.Kind() == reflect.Ptr &&
+				et.Elem().Kind() == reflect.Struct:
+				fp.kind = fieldMessages
+				fp.elem = buildPlan(et.Elem(), building)
+			default:
+				continue
+			}
+		case reflect.Interface:
+			if sf.Tag.Get("protobuf_oneof") == "" {
+				continue
+			}
+			fp.kind = fieldOneof
+		default:
+			continue
+		}
+		p.fields = append(p.fields, fp)
+	}
+
+	return p
+}
+
+type unboundedField struct {
+	t    reflect.Type
+	name string
+}
+
+// unboundedFields are the string fields whose spec text overrides the
+// general string size limit.
+var unboundedFields = map[unboundedField]bool{
+	{reflect.TypeOf(csi.NodeStageVolumeRequest{}), "StagingTargetPath"}:    true,
+	{reflect.TypeOf(csi.NodeUnstageVolumeRequest{}), "StagingTargetPath"}:  true,
+	{reflect.TypeOf(csi.NodePublishVolumeRequest{}), "StagingTargetPath"}:  true,
+	{reflect.TypeOf(csi.NodePublishVolumeRequest{}), "TargetPath"}:         true,
+	{reflect.TypeOf(csi.NodeUnpublishVolumeRequest{}), "TargetPath"}:       true,
+	{reflect.TypeOf(csi.NodeGetVolumeStatsRequest{}), "VolumePath"}:        true,
+	{reflect.TypeOf(csi.NodeGetVolumeStatsRequest{}), "StagingTargetPath"}: true,
+	{reflect.TypeOf(csi.NodeExpandVolumeRequest{}), "VolumePath"}:          true,
+	{reflect.TypeOf(csi.NodeExpandVolumeRequest{}), "StagingTargetPath"}:   true,
+	{reflect.TypeOf(csi.VolumeCapability_MountVolume{}), "MountFlags"}:     true,
+	{reflect.TypeOf(csi.VolumeCondition{}), "Message"}:                     true,
+}
+
+// isUnboundedString returns a flag indicating whether the string or
+// repeated string field of the struct type t with the given Go name is
+// exempt from the string size limit.
+func isUnboundedString(t reflect.Type, name string) bool {
+	return unboundedFields[unboundedField{t, name}]
+}
+
+// fieldPath is a field's path from the message being validated. It is
+// only rendered when a violation is recorded.
+type fieldPath struct {
+	parent *fieldPath
+	name   string
+	field  string
+	index  int
+}
+
+func (p *fieldPath) write(b *strings.Builder, proto bool) {
+	if p.parent != nil {
+		p.parent.write(b, proto)
+		b.WriteByte('.')
+	}
+	if proto {
+		b.WriteString(p.field)
+	} else {
+		b.WriteString(p.name)
+	}
+	if p.index >= 0 {
+		fmt.Fprintf(b, "[%d]", p.index)
+	}
+}
+
+// names returns the path's Go field names, ex. Volume.VolumeContext.
+func (p *fieldPath) names() string {
+	var b strings.Builder
+	p.write(&b, false)
+	return b.String()
+}
+
+// fields returns the path's protobuf field names, ex. volume.volume_context.
+func (p *fieldPath) fields() string {
+	var b strings.Builder
+	p.write(&b, true)
+	return b.String()
+}
+
+// validateFieldSizes records the string and map fields of msg, and of the
+// messages nested in msg, that exceed the spec's size limits.
+func validateFieldSizes(msg interface{}, v *violations) {
+	rv := reflect.ValueOf(msg)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return
+	}
+	if rv = rv.Elem(); rv.Kind() != reflect.Struct {
+		return
+	}
+	planFor(rv.Type()).validate(rv, nil, v)
+}
+
+func (p *msgPlan) validate(rv reflect.Value, parent *fieldPath, v *violations) {
+	for i := range p.fields {
+		fp := &p.fields[i]
+		f := rv.Field(fp.index)
+		switch fp.kind {
+		case fieldString:
+			if l := f.Len(); l > maxFieldString {
+				path := &fieldPath{parent, fp.name, fp.field, -1}
+				v.addf(path.fields(),
+					"exceeds size limit: %s: max=%d, size=%d",
+					path.names(), maxFieldString, l)
+			}
+		case fieldStrings:
+			for j := 0; j < f.Len(); j++ {
+				if l := f.Index(j).Len(); l > maxFieldString {
+					path := &fieldPath{parent, fp.name, fp.field, j}
+					v.addf(path.fields(),
+						"exceeds size limit: %s: max=%d, size=%d",
+						path.names(), maxFieldString, l)
+				}
+			}
+		case fieldMap:
+			if f.Len() > 0 {
+				validateMapSize(f, &fieldPath{parent, fp.name, fp.field, -1}, v)
+			}
+		case fieldMessage:
+			if !f.IsNil() {
+				fp.elem.validate(
+					f.Elem(), &fieldPath{parent, fp.name, fp.field, -1}, v)
+			}
+		case fieldMessages:
+			for j := 0; j < f.Len(); j++ {
+				if e := f.Index(j); !e.IsNil() {
+					fp.elem.validate(
+						e.Elem(), &fieldPath{parent, fp.name, fp.field, j}, v)
+				}
+			}
+		case fieldOneof:
+			// A oneof's value is a pointer to a wrapper struct whose only
+			// field is the oneof's member, so the wrapper's fields belong
+			// to the message that contains the oneof.
+			if f.IsNil() {
+				continue
+			}
+			w := f.Elem()
+			if w.Kind() != reflect.Ptr || w.IsNil() {
+				continue
+			}
+			if w = w.Elem(); w.Kind() == reflect.Struct {
+				planFor(w.Type()).validate(w, parent, v)
+			}
+		}
+	}
+}
+
+func validateMapSize(f reflect.Value, path *fieldPath, v *violations) {
+	var (
+		size int
+		over bool
+	)
+	for iter := f.MapRange(); iter.Next(); {
+		if k := iter.Key(); k.Kind() == reflect.String {
+			size = size + k.Len()
+			over = over || k.Len() > maxFieldString
+		}
+		if mv := iter.Value(); mv.Kind() == reflect.String {
+			size = size + mv.Len()
+			over = over || mv.Len() > maxFieldString
+		}
+	}
+
+	if !over && size <= maxFieldMap {
+		return
+	}
+	name, field := path.names(), path.fields()
+
+	if over {
+		// Sort the keys so the violations are reported in a
+		// predictable order.
+		keys := f.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, k := range keys {
+			if k.Kind() == reflect.String {
+				if kl := k.Len(); kl > maxFieldString {
+					v.addf(
+						fmt.Sprintf("%s[%s]", field, k.String()),
+						"exceeds size limit: %s[%s]: max=%d, size=%d",
+						name, k.String(), maxFieldString, kl)
+				}
+			}
+			if mv := f.MapIndex(k); mv.Kind() == reflect.String {
+				if vl := mv.Len(); vl > maxFieldString {
+					v.addf(
+						fmt.Sprintf("%s[%s]", field, k.String()),
+						"exceeds size limit: %s[%s]=: max=%d, size=%d",
+						name, k.String(), maxFieldString, vl)
+				}
+			}
+		}
+	}
+
+	if size > maxFieldMap {
+		v.addf(field,
+			"exceeds size limit: %s: max=%d, size=%d",
+			name, maxFieldMap, size)
+	}
+}
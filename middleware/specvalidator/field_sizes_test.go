@@ -0,0 +1,270 @@
+package specvalidator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+)
+
+func fieldSizeViolations(msg interface{}) []string {
+	v := &violations{code: codes.InvalidArgument}
+	validateFieldSizes(msg, v)
+	var s []string
+	for _, fv := range v.items {
+		s = append(s, fv.Field+": "+fv.Description)
+	}
+	return s
+}
+
+func TestValidateFieldSizes_Nested(t *testing.T) {
+	long := strings.Repeat("a", maxFieldString+1)
+
+	for _, tc := range []struct {
+		msg interface{}
+		exp []string
+	}{
+		{
+			&csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId:      "1",
+					VolumeContext: map[string]string{"k": long},
+				},
+			},
+			[]string{
+				"volume.volume_context[k]: exceeds size limit: " +
+					"Volume.VolumeContext[k]=: max=128, size=129",
+			},
+		},
+		{
+			&csi.ListVolumesResponse{
+				Entries: []*csi.ListVolumesResponse_Entry{
+					{Volume: &csi.Volume{VolumeId: "1"}},
+					{Volume: &csi.Volume{VolumeId: long}},
+				},
+			},
+			[]string{
+				"entries[1].volume.volume_id: exceeds size limit: " +
+					"Entries[1].Volume.VolumeId: max=128, size=129",
+			},
+		},
+		{
+			&csi.CreateVolumeRequest{
+				Name: "vol",
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{
+						Snapshot: &csi.VolumeContentSource_SnapshotSource{
+							SnapshotId: long,
+						},
+					},
+				},
+			},
+			[]string{
+				"volume_content_source.snapshot.snapshot_id: " +
+					"exceeds size limit: " +
+					"VolumeContentSource.Snapshot.SnapshotId: " +
+					"max=128, size=129",
+			},
+		},
+		{
+			&csi.CreateVolumeRequest{
+				Name: "vol",
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessType: &csi.VolumeCapability_Mount{
+							Mount: &csi.VolumeCapability_MountVolume{
+								FsType:     long,
+								MountFlags: []string{"ro", long},
+							},
+						},
+					},
+				},
+				AccessibilityRequirements: &csi.TopologyRequirement{
+					Requisite: []*csi.Topology{
+						{Segments: map[string]string{long: "z1"}},
+					},
+				},
+			},
+			[]string{
+				"volume_capabilities[0].mount.fs_type: " +
+					"exceeds size limit: " +
+					"VolumeCapabilities[0].Mount.FsType: " +
+					"max=128, size=129",
+				fmt.Sprintf(
+					"accessibility_requirements.requisite[0].segments[%[1]s]: "+
+						"exceeds size limit: "+
+						"AccessibilityRequirements.Requisite[0].Segments[%[1]s]: "+
+						"max=128, size=129", long),
+			},
+		},
+		{
+			&csi.ControllerGetVolumeResponse{
+				Volume: &csi.Volume{VolumeId: "1"},
+				Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+					PublishedNodeIds: []string{"n1", long},
+					VolumeCondition: &csi.VolumeCondition{
+						Abnormal: true,
+						Message:  long,
+					},
+				},
+			},
+			[]string{
+				"status.published_node_ids[1]: exceeds size limit: " +
+					"Status.PublishedNodeIds[1]: max=128, size=129",
+			},
+		},
+		{
+			&csi.ListVolumesRequest{StartingToken: long},
+			[]string{
+				"starting_token: exceeds size limit: " +
+					"StartingToken: max=128, size=129",
+			},
+		},
+		{
+			&csi.ListSnapshotsResponse{NextToken: long},
+			[]string{
+				"next_token: exceeds size limit: " +
+					"NextToken: max=128, size=129",
+			},
+		},
+		{
+			&csi.NodePublishVolumeRequest{
+				VolumeId:          "1",
+				StagingTargetPath: long,
+				TargetPath:        long,
+			},
+			nil,
+		},
+		{
+			&csi.NodeGetVolumeStatsRequest{
+				VolumeId:          long,
+				VolumePath:        long,
+				StagingTargetPath: long,
+			},
+			[]string{
+				"volume_id: exceeds size limit: " +
+					"VolumeId: max=128, size=129",
+			},
+		},
+	} {
+		act := fieldSizeViolations(tc.msg)
+		if !reflect.DeepEqual(act, tc.exp) {
+			t.Errorf("%T: violations=%q, expected %q", tc.msg, act, tc.exp)
+		}
+	}
+}
+
+// validateFieldSizesFlat is the previous implementation, which only
+// validated top-level fields. It is retained for the benchmarks.
+func validateFieldSizesFlat(msg interface{}, v *violations) {
+	rv := reflect.ValueOf(msg).Elem()
+	tv := rv.Type()
+	nf := tv.NumField()
+	for i := 0; i < nf; i++ {
+		f := rv.Field(i)
+		name := tv.Field(i).Name
+		field := protoFieldName(tv.Field(i))
+		switch f.Kind() {
+		case reflect.String:
+			if l := f.Len(); l > maxFieldString {
+				v.addf(field,
+					"exceeds size limit: %s: max=%d, size=%d",
+					name, maxFieldString, l)
+			}
+		case reflect.Map:
+			if f.Len() == 0 {
+				continue
+			}
+			keys := f.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+			size := 0
+			for _, k := range keys {
+				if k.Kind() == reflect.String {
+					size = size + k.Len()
+				}
+				if mv := f.MapIndex(k); mv.Kind() == reflect.String {
+					size = size + mv.Len()
+				}
+			}
+			if size > maxFieldMap {
+				v.addf(field,
+					"exceeds size limit: %s: max=%d, size=%d",
+					name, maxFieldMap, size)
+			}
+		}
+	}
+}
+
+func newFlatRequest() *csi.NodeUnpublishVolumeRequest {
+	return &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   "vol-1234567890",
+		TargetPath: "/var/lib/kubelet/pods/1234/volumes/vol-1234567890",
+	}
+}
+
+func newFlatRequestWithSecrets() *csi.DeleteVolumeRequest {
+	return &csi.DeleteVolumeRequest{
+		VolumeId: "vol-1234567890",
+		Secrets: map[string]string{
+			"username": "admin",
+			"password": "secret",
+			"token":    "0123456789abcdef",
+		},
+	}
+}
+
+func benchmarkFieldSizes(
+	b *testing.B,
+	msg interface{},
+	f func(interface{}, *violations)) {
+
+	v := &violations{code: codes.InvalidArgument}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f(msg, v)
+	}
+	if len(v.items) > 0 {
+		b.Fatal(v.items)
+	}
+}
+
+func BenchmarkFieldSizes_Flat(b *testing.B) {
+	benchmarkFieldSizes(b, newFlatRequest(), validateFieldSizes)
+}
+
+func BenchmarkFieldSizes_FlatPrevious(b *testing.B) {
+	benchmarkFieldSizes(b, newFlatRequest(), validateFieldSizesFlat)
+}
+
+func BenchmarkFieldSizes_FlatMap(b *testing.B) {
+	benchmarkFieldSizes(b, newFlatRequestWithSecrets(), validateFieldSizes)
+}
+
+func BenchmarkFieldSizes_FlatMapPrevious(b *testing.B) {
+	benchmarkFieldSizes(
+		b, newFlatRequestWithSecrets(), validateFieldSizesFlat)
+}
+
+func BenchmarkFieldSizes_Nested(b *testing.B) {
+	msg := &csi.ListVolumesResponse{}
+	for i := 0; i < 10; i++ {
+		msg.Entries = append(msg.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      fmt.Sprintf("vol-%d", i),
+				CapacityBytes: 1 << 30,
+				VolumeContext: map[string]string{"pool": "p1"},
+				AccessibleTopology: []*csi.Topology{
+					{Segments: map[string]string{"zone": "z1"}},
+				},
+			},
+		})
+	}
+	benchmarkFieldSizes(b, msg, validateFieldSizes)
+}
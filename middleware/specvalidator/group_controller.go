@@ -0,0 +1,159 @@
+package specvalidator
+
+import (
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+)
+
+func (s *interceptor) validateCreateVolumeGroupSnapshotRequest(
+	ctx context.Context,
+	req csi.CreateVolumeGroupSnapshotRequest,
+	v *violations) {
+
+	if req.Name == "" {
+		v.add("name", "required: Name")
+	}
+	if len(req.SourceVolumeIds) == 0 {
+		v.add("source_volume_ids", "required: SourceVolumeIds")
+	}
+	validateIDs(req.SourceVolumeIds,
+		"source_volume_ids", "SourceVolumeIds", v)
+}
+
+func (s *interceptor) validateDeleteVolumeGroupSnapshotRequest(
+	ctx context.Context,
+	req csi.DeleteVolumeGroupSnapshotRequest,
+	v *violations) {
+
+	if req.GroupSnapshotId == "" {
+		v.add("group_snapshot_id", "required: GroupSnapshotID")
+	}
+	if len(req.SnapshotIds) == 0 {
+		v.add("snapshot_ids", "required: SnapshotIds")
+	}
+	validateIDs(req.SnapshotIds, "snapshot_ids", "SnapshotIds", v)
+}
+
+func (s *interceptor) validateGetVolumeGroupSnapshotRequest(
+	ctx context.Context,
+	req csi.GetVolumeGroupSnapshotRequest,
+	v *violations) {
+
+	if req.GroupSnapshotId == "" {
+		v.add("group_snapshot_id", "required: GroupSnapshotID")
+	}
+	if len(req.SnapshotIds) == 0 {
+		v.add("snapshot_ids", "required: SnapshotIds")
+	}
+	validateIDs(req.SnapshotIds, "snapshot_ids", "SnapshotIds", v)
+}
+
+func (s *interceptor) validateGroupControllerGetCapabilitiesResponse(
+	ctx context.Context,
+	rep csi.GroupControllerGetCapabilitiesResponse,
+	v *violations) {
+
+	if rep.Capabilities != nil && len(rep.Capabilities) == 0 {
+		v.add("capabilities", "non-nil, empty: Capabilities")
+	}
+}
+
+func (s *interceptor) validateCreateVolumeGroupSnapshotResponse(
+	ctx context.Context,
+	req interface{},
+	rep csi.CreateVolumeGroupSnapshotResponse,
+	v *violations) {
+
+	validateGroupSnapshot(rep.GroupSnapshot, v)
+
+	// Each snapshot must be of one of the requested source volumes.
+	treq, ok := req.(*csi.CreateVolumeGroupSnapshotRequest)
+	if !ok || rep.GroupSnapshot == nil {
+		return
+	}
+	sources := map[string]bool{}
+	for _, id := range treq.SourceVolumeIds {
+		sources[id] = true
+	}
+	for i, snap := range rep.GroupSnapshot.Snapshots {
+		if snap == nil || snap.SourceVolumeId == "" ||
+			sources[snap.SourceVolumeId] {
+			continue
+		}
+		v.addf(
+			fmt.Sprintf("group_snapshot.snapshots[%d].source_volume_id", i),
+			"invalid: GroupSnapshot.Snapshots[%d].SourceVolumeID=%s: "+
+				"not a source volume", i, snap.SourceVolumeId)
+	}
+}
+
+func (s *interceptor) validateGetVolumeGroupSnapshotResponse(
+	ctx context.Context,
+	rep csi.GetVolumeGroupSnapshotResponse,
+	v *violations) {
+
+	validateGroupSnapshot(rep.GroupSnapshot, v)
+}
+
+// validateGroupSnapshot records the violations for the group snapshot of
+// a CreateVolumeGroupSnapshot or GetVolumeGroupSnapshot response.
+func validateGroupSnapshot(g *csi.VolumeGroupSnapshot, v *violations) {
+	if g == nil {
+		v.add("group_snapshot", "nil: GroupSnapshot")
+		return
+	}
+	if g.GroupSnapshotId == "" {
+		v.add("group_snapshot.group_snapshot_id",
+			"empty: GroupSnapshot.GroupSnapshotID")
+	}
+	if g.CreationTime == nil {
+		v.add("group_snapshot.creation_time",
+			"nil: GroupSnapshot.CreationTime")
+	}
+	if len(g.Snapshots) == 0 {
+		v.add("group_snapshot.snapshots", "empty: GroupSnapshot.Snapshots")
+		return
+	}
+
+	ready := true
+	for i, snap := range g.Snapshots {
+		field := fmt.Sprintf("group_snapshot.snapshots[%d]", i)
+		name := fmt.Sprintf("GroupSnapshot.Snapshots[%d]", i)
+		validateSnapshot(snap, field, name, v)
+		if snap == nil {
+			continue
+		}
+		if g.GroupSnapshotId != "" &&
+			snap.GroupSnapshotId != g.GroupSnapshotId {
+			v.addf(field+".group_snapshot_id",
+				"invalid: %s.GroupSnapshotID=%s: expected %s",
+				name, snap.GroupSnapshotId, g.GroupSnapshotId)
+		}
+		ready = ready && snap.ReadyToUse
+	}
+
+	// A group snapshot is not ready to use unless all of its snapshots
+	// are ready to use.
+	if g.ReadyToUse && !ready {
+		v.add("group_snapshot.ready_to_use",
+			"invalid: GroupSnapshot.ReadyToUse=true: "+
+				"not all snapshots are ready to use")
+	}
+}
+
+// validateIDs records a violation for each empty or duplicate ID in ids.
+func validateIDs(ids []string, field, name string, v *violations) {
+	seen := map[string]bool{}
+	for i, id := range ids {
+		switch {
+		case id == "":
+			v.addf(fmt.Sprintf("%s[%d]", field, i), "empty: %s[%d]", name, i)
+		case seen[id]:
+			v.addf(fmt.Sprintf("%s[%d]", field, i),
+				"invalid: %s[%d]=%s: duplicate", name, i, id)
+		}
+		seen[id] = true
+	}
+}
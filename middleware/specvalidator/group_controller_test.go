@@ -0,0 +1,113 @@
+package specvalidator_test
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+const (
+	createVolumeGroupSnapshot = "/csi.v1.GroupController/CreateVolumeGroupSnapshot"
+	getVolumeGroupSnapshot    = "/csi.v1.GroupController/GetVolumeGroupSnapshot"
+)
+
+func TestCreateVolumeGroupSnapshotRequest(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+
+	_, err := invoke(i, createVolumeGroupSnapshot,
+		&csi.CreateVolumeGroupSnapshotRequest{})
+	if f := fieldsOf(err); len(f) != 2 ||
+		f[0] != "name" || f[1] != "source_volume_ids" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	_, err = invoke(i, createVolumeGroupSnapshot,
+		&csi.CreateVolumeGroupSnapshotRequest{
+			Name:            "group",
+			SourceVolumeIds: []string{"1", "", "1"},
+		})
+	if f := fieldsOf(err); len(f) != 2 ||
+		f[0] != "source_volume_ids[1]" || f[1] != "source_volume_ids[2]" {
+		t.Fatalf("violations=%v", f)
+	}
+}
+
+func TestGetVolumeGroupSnapshotRequest(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+
+	_, err := invoke(i, getVolumeGroupSnapshot,
+		&csi.GetVolumeGroupSnapshotRequest{})
+	if f := fieldsOf(err); len(f) != 2 ||
+		f[0] != "group_snapshot_id" || f[1] != "snapshot_ids" {
+		t.Fatalf("violations=%v", f)
+	}
+}
+
+func TestCreateVolumeGroupSnapshotResponse(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+
+	var (
+		req = &csi.CreateVolumeGroupSnapshotRequest{
+			Name:            "group",
+			SourceVolumeIds: []string{"1", "2"},
+		}
+		now = ptypes.TimestampNow()
+		rep = &csi.CreateVolumeGroupSnapshotResponse{
+			GroupSnapshot: &csi.VolumeGroupSnapshot{
+				GroupSnapshotId: "g1",
+				CreationTime:    now,
+				ReadyToUse:      true,
+				Snapshots: []*csi.Snapshot{
+					{
+						SnapshotId:      "s1",
+						SourceVolumeId:  "1",
+						GroupSnapshotId: "g1",
+						CreationTime:    now,
+						ReadyToUse:      true,
+					},
+					{
+						SnapshotId:      "s2",
+						SourceVolumeId:  "2",
+						GroupSnapshotId: "g1",
+						CreationTime:    now,
+						ReadyToUse:      true,
+					},
+				},
+			},
+		}
+	)
+
+	if err := invokeWithResponse(
+		i, createVolumeGroupSnapshot, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	rep.GroupSnapshot.Snapshots[1].SourceVolumeId = "3"
+	rep.GroupSnapshot.Snapshots[1].GroupSnapshotId = "g2"
+	rep.GroupSnapshot.Snapshots[1].ReadyToUse = false
+	err := invokeWithResponse(i, createVolumeGroupSnapshot, req, rep)
+	if f := fieldsOf(err); len(f) != 3 ||
+		f[0] != "group_snapshot.snapshots[1].group_snapshot_id" ||
+		f[1] != "group_snapshot.ready_to_use" ||
+		f[2] != "group_snapshot.snapshots[1].source_volume_id" {
+		t.Fatalf("violations=%v", f)
+	}
+
+	err = invokeWithResponse(i, getVolumeGroupSnapshot,
+		&csi.GetVolumeGroupSnapshotRequest{},
+		&csi.GetVolumeGroupSnapshotResponse{
+			GroupSnapshot: &csi.VolumeGroupSnapshot{},
+		})
+	if f := fieldsOf(err); len(f) != 3 ||
+		f[0] != "group_snapshot.group_snapshot_id" ||
+		f[1] != "group_snapshot.creation_time" ||
+		f[2] != "group_snapshot.snapshots" {
+		t.Fatalf("violations=%v", f)
+	}
+}
@@ -0,0 +1,386 @@
+// Package paramschema provides a schema for the untyped
+// CreateVolumeRequest.Parameters map. A Schema declares the allowed keys,
+// their types, defaults, required flags and mutual exclusions, and parses
+// a parameter map into typed, defaulted Values.
+package paramschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Type is the type of a parameter's value.
+type Type string
+
+const (
+	// TypeString is a parameter with any string value.
+	TypeString Type = "string"
+
+	// TypeInt is a parameter with a base-10, 64-bit integer value.
+	TypeInt Type = "int"
+
+	// TypeBool is a parameter with a value accepted by strconv.ParseBool.
+	TypeBool Type = "bool"
+
+	// TypeEnum is a parameter with a value from Param.Enum.
+	TypeEnum Type = "enum"
+
+	// TypeQuantity is a parameter with a size in bytes, optionally with
+	// a decimal (k, M, G, T, P) or binary (Ki, Mi, Gi, Ti, Pi) suffix,
+	// ex. "100Gi".
+	TypeQuantity Type = "quantity"
+
+	// TypeDuration is a parameter with a value accepted by
+	// time.ParseDuration.
+	TypeDuration Type = "duration"
+)
+
+// Param describes a single parameter.
+type Param struct {
+	// Name is the parameter's key.
+	Name string `json:"name"`
+
+	// Type is the parameter's type. The default type is TypeString.
+	Type Type `json:"type,omitempty"`
+
+	// Description describes the parameter.
+	Description string `json:"description,omitempty"`
+
+	// Default is the value used if the parameter is not set.
+	Default string `json:"default,omitempty"`
+
+	// Required indicates the parameter must be set.
+	Required bool `json:"required,omitempty"`
+
+	// Enum is the list of valid values for a parameter of TypeEnum.
+	Enum []string `json:"enum,omitempty"`
+}
+
+// Schema describes the parameters accepted by a storage plug-in.
+type Schema struct {
+	// Params is the list of parameters.
+	Params []Param `json:"params"`
+
+	// MutuallyExclusive is a list of groups of parameter names. At most
+	// one parameter from each group may be set.
+	MutuallyExclusive [][]string `json:"mutuallyExclusive,omitempty"`
+}
+
+// Load reads a JSON-encoded schema from r and validates it.
+func Load(r io.Reader) (*Schema, error) {
+	s := &Schema{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate returns an error if the schema itself is invalid, ex. if a
+// default value does not match its parameter's type.
+func (s *Schema) Validate() error {
+	names := map[string]bool{}
+	for _, p := range s.Params {
+		if p.Name == "" {
+			return fmt.Errorf("paramschema: empty parameter name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("paramschema: duplicate parameter: %s", p.Name)
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case "", TypeString, TypeInt, TypeBool, TypeQuantity, TypeDuration:
+		case TypeEnum:
+			if len(p.Enum) == 0 {
+				return fmt.Errorf("paramschema: %s: empty enum", p.Name)
+			}
+		default:
+			return fmt.Errorf("paramschema: %s: invalid type: %s",
+				p.Name, p.Type)
+		}
+		if p.Default != "" {
+			if _, err := p.parse(p.Default); err != nil {
+				return fmt.Errorf("paramschema: %s: invalid default: %v",
+					p.Name, err)
+			}
+		}
+	}
+	for _, g := range s.MutuallyExclusive {
+		for _, n := range g {
+			if !names[n] {
+				return fmt.Errorf(
+					"paramschema: unknown mutually exclusive parameter: %s",
+					n)
+			}
+		}
+	}
+	return nil
+}
+
+// Error describes an invalid parameter.
+type Error struct {
+	// Key is the parameter's key.
+	Key string
+
+	// Description describes why the parameter is invalid.
+	Description string
+}
+
+// Error returns the error's description.
+func (e *Error) Error() string {
+	return e.Description
+}
+
+// Errors is the list of errors returned by Schema.Parse.
+type Errors []*Error
+
+// Error returns the description of the first error.
+func (e Errors) Error() string {
+	if len(e) == 0 {
+		return ""
+	}
+	return e[0].Description
+}
+
+// Parse parses params according to the schema. If any parameters are
+// unknown, missing or invalid then the returned error is an Errors that
+// lists all of them.
+func (s *Schema) Parse(params map[string]string) (Values, error) {
+	var (
+		errs   Errors
+		vals   = Values{m: map[string]interface{}{}}
+		byName = map[string]*Param{}
+	)
+	for i := range s.Params {
+		byName[s.Params[i].Name] = &s.Params[i]
+	}
+
+	// Report unknown keys in a predictable order.
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if byName[k] == nil {
+			errs = append(errs, &Error{
+				Key:         k,
+				Description: fmt.Sprintf("unknown: Parameters[%s]", k),
+			})
+		}
+	}
+
+	for i := range s.Params {
+		p := &s.Params[i]
+		v, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				errs = append(errs, &Error{
+					Key: p.Name,
+					Description: fmt.Sprintf(
+						"required: Parameters[%s]", p.Name),
+				})
+				continue
+			}
+			if p.Default == "" {
+				continue
+			}
+			v = p.Default
+		}
+		tv, err := p.parse(v)
+		if err != nil {
+			errs = append(errs, &Error{
+				Key: p.Name,
+				Description: fmt.Sprintf(
+					"invalid: Parameters[%s]=%s: %v", p.Name, v, err),
+			})
+			continue
+		}
+		vals.m[p.Name] = tv
+	}
+
+	for _, g := range s.MutuallyExclusive {
+		var set []string
+		for _, n := range g {
+			if _, ok := params[n]; ok {
+				set = append(set, fmt.Sprintf("Parameters[%s]", n))
+			}
+		}
+		if len(set) > 1 {
+			errs = append(errs, &Error{
+				Key: g[0],
+				Description: fmt.Sprintf(
+					"mutually exclusive: %s", strings.Join(set, ", ")),
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return Values{}, errs
+	}
+	return vals, nil
+}
+
+func (p *Param) parse(v string) (interface{}, error) {
+	switch p.Type {
+	case TypeInt:
+		return strconv.ParseInt(v, 10, 64)
+	case TypeBool:
+		return strconv.ParseBool(v)
+	case TypeEnum:
+		for _, e := range p.Enum {
+			if v == e {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("expected one of: %s",
+			strings.Join(p.Enum, ", "))
+	case TypeQuantity:
+		return ParseQuantity(v)
+	case TypeDuration:
+		return time.ParseDuration(v)
+	}
+	return v, nil
+}
+
+var quantitySuffixes = []struct {
+	suffix string
+	mult   int64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"Pi", 1 << 50},
+	{"k", 1e3},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"P", 1e15},
+}
+
+// ParseQuantity parses a size in bytes with an optional decimal
+// (k, M, G, T, P) or binary (Ki, Mi, Gi, Ti, Pi) suffix.
+func ParseQuantity(v string) (int64, error) {
+	num, mult := v, int64(1)
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(v, s.suffix) {
+			num, mult = strings.TrimSuffix(v, s.suffix), s.mult
+			break
+		}
+	}
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("negative quantity: %s", v)
+		}
+		if n > math.MaxInt64/mult {
+			return 0, fmt.Errorf("quantity out of range: %s", v)
+		}
+		return n * mult, nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid quantity: %s", v)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, the first value that
+	// does not fit in an int64.
+	if f *= float64(mult); f >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("quantity out of range: %s", v)
+	}
+	return int64(f), nil
+}
+
+// Values are the typed values of parsed parameters, including defaults.
+type Values struct {
+	m map[string]interface{}
+}
+
+// Has returns a flag indicating whether the parameter was set or has a
+// default value.
+func (v Values) Has(key string) bool {
+	_, ok := v.m[key]
+	return ok
+}
+
+// String returns the value of a TypeString or TypeEnum parameter.
+func (v Values) String(key string) string {
+	s, _ := v.m[key].(string)
+	return s
+}
+
+// Int returns the value of a TypeInt parameter.
+func (v Values) Int(key string) int64 {
+	i, _ := v.m[key].(int64)
+	return i
+}
+
+// Bool returns the value of a TypeBool parameter.
+func (v Values) Bool(key string) bool {
+	b, _ := v.m[key].(bool)
+	return b
+}
+
+// Quantity returns the value, in bytes, of a TypeQuantity parameter.
+func (v Values) Quantity(key string) int64 {
+	return v.Int(key)
+}
+
+// Duration returns the value of a TypeDuration parameter.
+func (v Values) Duration(key string) time.Duration {
+	d, _ := v.m[key].(time.Duration)
+	return d
+}
+
+type valuesKey struct{}
+
+// NewContext returns a new context with the given values.
+func NewContext(ctx context.Context, v Values) context.Context {
+	return context.WithValue(ctx, valuesKey{}, v)
+}
+
+// FromContext returns the values stored in the context by the spec
+// validator when the CreateVolume request's parameters were parsed.
+func FromContext(ctx context.Context) (Values, bool) {
+	v, ok := ctx.Value(valuesKey{}).(Values)
+	return v, ok
+}
+
+// WriteTable writes a human-readable description of the schema to w.
+func (s *Schema) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION")
+	for _, p := range s.Params {
+		typ := p.Type
+		if typ == "" {
+			typ = TypeString
+		}
+		t := string(typ)
+		if typ == TypeEnum {
+			t = fmt.Sprintf("enum(%s)", strings.Join(p.Enum, "|"))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n",
+			p.Name, t, p.Required, p.Default, p.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(s.MutuallyExclusive) > 0 {
+		fmt.Fprintln(w, "\nMUTUALLY EXCLUSIVE")
+		for _, g := range s.MutuallyExclusive {
+			fmt.Fprintf(w, "  %s\n", strings.Join(g, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package paramschema_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+	"github.com/rexray/gocsi/middleware/specvalidator/paramschema"
+)
+
+const schemaJSON = `{
+  "params": [
+    {"name": "pool", "required": true},
+    {"name": "tier", "type": "enum", "enum": ["gold", "silver"],
+     "default": "silver"},
+    {"name": "size", "type": "quantity"},
+    {"name": "iops", "type": "int"},
+    {"name": "thin", "type": "bool", "default": "true"},
+    {"name": "timeout", "type": "duration", "default": "30s"}
+  ],
+  "mutuallyExclusive": [["size", "iops"]]
+}`
+
+func loadSchema(t *testing.T) *paramschema.Schema {
+	s, err := paramschema.Load(strings.NewReader(schemaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchema_Parse(t *testing.T) {
+	s := loadSchema(t)
+
+	v, err := s.Parse(map[string]string{
+		"pool": "p1",
+		"size": "10Gi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String("pool") != "p1" {
+		t.Errorf("pool=%s", v.String("pool"))
+	}
+	if v.String("tier") != "silver" {
+		t.Errorf("tier=%s", v.String("tier"))
+	}
+	if v.Quantity("size") != 10*1024*1024*1024 {
+		t.Errorf("size=%d", v.Quantity("size"))
+	}
+	if !v.Bool("thin") {
+		t.Error("thin=false")
+	}
+	if v.Duration("timeout") != 30*time.Second {
+		t.Errorf("timeout=%v", v.Duration("timeout"))
+	}
+	if v.Has("iops") {
+		t.Error("iops should not be set")
+	}
+}
+
+func TestSchema_ParseErrors(t *testing.T) {
+	s := loadSchema(t)
+
+	_, err := s.Parse(map[string]string{
+		"tier": "bronze",
+		"size": "lots",
+		"iops": "100",
+		"zone": "a",
+	})
+	errs, ok := err.(paramschema.Errors)
+	if !ok {
+		t.Fatalf("err=%T %v", err, err)
+	}
+	exp := []string{
+		"unknown: Parameters[zone]",
+		"required: Parameters[pool]",
+		"invalid: Parameters[tier]=bronze: expected one of: gold, silver",
+		"invalid: Parameters[size]=lots: invalid quantity: lots",
+		"mutually exclusive: Parameters[size], Parameters[iops]",
+	}
+	if len(errs) != len(exp) {
+		t.Fatalf("errs=%v", errs)
+	}
+	for i, e := range exp {
+		if errs[i].Description != e {
+			t.Errorf("errs[%d]=%q, expected %q", i, errs[i].Description, e)
+		}
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	for _, s := range []string{
+		`{"params": [{"name": "a", "type": "float"}]}`,
+		`{"params": [{"name": "a", "type": "enum"}]}`,
+		`{"params": [{"name": "a", "type": "int", "default": "x"}]}`,
+		`{"params": [{"name": "a"}, {"name": "a"}]}`,
+		`{"params": [{"name": "a"}], "mutuallyExclusive": [["a", "b"]]}`,
+	} {
+		if _, err := paramschema.Load(strings.NewReader(s)); err == nil {
+			t.Errorf("expected error: %s", s)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	for v, exp := range map[string]int64{
+		"1024":   1024,
+		"1Ki":    1024,
+		"2Mi":    2 * 1024 * 1024,
+		"1.5Gi":  1536 * 1024 * 1024,
+		"10G":    10e9,
+		"3k":     3000,
+		"8191Pi": 8191 << 50,
+	} {
+		n, err := paramschema.ParseQuantity(v)
+		if err != nil {
+			t.Errorf("%s: %v", v, err)
+			continue
+		}
+		if n != exp {
+			t.Errorf("%s=%d, expected %d", v, n, exp)
+		}
+	}
+	for _, v := range []string{
+		"", "Gi", "-1", "1Zi", "NaN",
+		"9999999999Ti", "9223372036854775807Ki", "8192Pi", "8192.5Pi", "1e30",
+	} {
+		if _, err := paramschema.ParseQuantity(v); err == nil {
+			t.Errorf("%s: expected error", v)
+		}
+	}
+}
+
+func TestWithParamSchema(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithParamSchema(loadSchema(t)))
+
+	req := &csi.CreateVolumeRequest{
+		Name:       "vol",
+		Parameters: map[string]string{"pool": "p1", "iops": "500"},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+			},
+		},
+	}
+	info := &grpc.UnaryServerInfo{
+		FullMethod: "/csi.v1.Controller/CreateVolume",
+	}
+
+	var vals paramschema.Values
+	handler := func(
+		ctx context.Context, req interface{}) (interface{}, error) {
+
+		var ok bool
+		if vals, ok = paramschema.FromContext(ctx); !ok {
+			t.Fatal("missing param values")
+		}
+		return &csi.CreateVolumeResponse{}, nil
+	}
+
+	if _, err := i(context.Background(), req, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if vals.Int("iops") != 500 || vals.String("tier") != "silver" {
+		t.Fatalf("iops=%d tier=%s", vals.Int("iops"), vals.String("tier"))
+	}
+
+	req.Parameters = map[string]string{"iops": "many"}
+	_, err := i(context.Background(), req, info, handler)
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) != 2 ||
+		fvs[0].Field != "parameters[pool]" ||
+		fvs[1].Field != "parameters[iops]" {
+		t.Fatalf("violations=%v", fvs)
+	}
+}
@@ -0,0 +1,111 @@
+package specvalidator
+
+import (
+	"expvar"
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	csictx "github.com/rexray/gocsi/context"
+	"github.com/rexray/gocsi/utils"
+)
+
+// ViolationCounts is the number of spec violations reported in
+// report-only mode, keyed by rule. A rule is the RPC, the direction, the
+// protobuf field path with its indices and map keys elided, and the kind
+// of violation, ex. "CreateVolume request volume_capabilities[].mount:
+// required". The counts are published with expvar as csi_spec_violations.
+var ViolationCounts = expvar.NewMap("csi_spec_violations")
+
+// WithRequestReportOnly is a Option that indicates request violations
+// are logged and counted instead of rejected. The request is passed to
+// the next handler unchanged.
+func WithRequestReportOnly() Option {
+	return func(o *opts) {
+		o.reqReportOnly = true
+	}
+}
+
+// WithResponseReportOnly is a Option that indicates response violations
+// are logged and counted instead of rejected. The response is returned
+// unchanged.
+func WithResponseReportOnly() Option {
+	return func(o *opts) {
+		o.repReportOnly = true
+	}
+}
+
+// WithReportOnly is a Option that indicates both request and response
+// violations are logged and counted instead of rejected.
+func WithReportOnly() Option {
+	return func(o *opts) {
+		o.reqReportOnly = true
+		o.repReportOnly = true
+	}
+}
+
+const (
+	directionRequest  = "request"
+	directionResponse = "response"
+)
+
+// report logs the violations described by the validation error err as a
+// structured warning and increments their counts in ViolationCounts.
+func report(ctx context.Context, method, direction string, err error) {
+	fvs := FieldViolations(err)
+	if len(fvs) == 0 {
+		fvs = []*errdetails.BadRequest_FieldViolation{
+			{Description: status.Convert(err).Message()},
+		}
+	}
+
+	descs := make([]string, len(fvs))
+	for i, fv := range fvs {
+		if fv.Field == "" {
+			descs[i] = fv.Description
+		} else {
+			descs[i] = fmt.Sprintf("%s: %s", fv.Field, fv.Description)
+		}
+		ViolationCounts.Add(ruleKey(method, direction, fv), 1)
+	}
+
+	fields := map[string]interface{}{
+		"method":     method,
+		"direction":  direction,
+		"violations": descs,
+	}
+	if id, ok := csictx.GetRequestID(ctx); ok {
+		fields["requestID"] = id
+	}
+	log.WithFields(fields).Warn("spec violation")
+}
+
+var fieldIndexRX = regexp.MustCompile(`\[[^\]]*\]`)
+
+// ruleKey returns the ViolationCounts key for the violation fv.
+func ruleKey(
+	method, direction string,
+	fv *errdetails.BadRequest_FieldViolation) string {
+
+	if _, _, name, err := utils.ParseMethod(method); err == nil {
+		method = name
+	}
+
+	// The kind of violation is the description's prefix, ex. "required"
+	// or "exceeds size limit".
+	kind := fv.Description
+	if i := strings.Index(kind, ":"); i >= 0 {
+		kind = kind[:i]
+	}
+
+	if fv.Field == "" {
+		return fmt.Sprintf("%s %s: %s", method, direction, kind)
+	}
+	return fmt.Sprintf("%s %s %s: %s",
+		method, direction, fieldIndexRX.ReplaceAllString(fv.Field, "[]"), kind)
+}
@@ -0,0 +1,69 @@
+package specvalidator_test
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+func violationCount(key string) int64 {
+	if v, ok := specvalidator.ViolationCounts.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestReportOnly_Request(t *testing.T) {
+	const key = "CreateVolume request name: required"
+	n := violationCount(key)
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithRequestReportOnly())
+
+	req := newCreateVolumeRequest(nil, gib4)
+	req.Name = ""
+	called, err := invoke(i, createVolume, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("handler not called")
+	}
+	if c := violationCount(key); c != n+1 {
+		t.Fatalf("count=%d, expected %d", c, n+1)
+	}
+
+	// Response violations are still rejected.
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithRequestReportOnly())
+	err = invokeWithResponse(i, createVolume,
+		newCreateVolumeRequest(nil, gib4),
+		&csi.CreateVolumeResponse{Volume: &csi.Volume{}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReportOnly_Response(t *testing.T) {
+	const key = "CreateVolume response volume.volume_id: empty"
+	n := violationCount(key)
+
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithReportOnly())
+
+	rep := &csi.CreateVolumeResponse{Volume: &csi.Volume{}}
+	err := invokeWithResponse(i, createVolume,
+		newCreateVolumeRequest(nil, gib4), rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := violationCount(key); c != n+1 {
+		t.Fatalf("count=%d, expected %d", c, n+1)
+	}
+}
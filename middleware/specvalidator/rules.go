@@ -0,0 +1,197 @@
+package specvalidator
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/utils"
+)
+
+// RequestRule is a custom validation rule for a request message.
+//
+// A non-nil error marks the request as invalid. Errors created with
+// NewFieldError or collected in a FieldErrors are reported with their
+// protobuf field paths. A gRPC status error's BadRequest field violations
+// are reported as-is. Any other error is reported as a violation of the
+// message as a whole.
+type RequestRule func(ctx context.Context, req interface{}) error
+
+// ResponseRule is a custom validation rule for a response message. Its
+// errors are handled the same way as a RequestRule's.
+type ResponseRule func(ctx context.Context, rep interface{}) error
+
+// FieldError is a validation error for a single field.
+type FieldError struct {
+	// Field is the protobuf field path, ex. "parameters" or
+	// "capacity_range.required_bytes".
+	Field string
+
+	// Description describes why the field is invalid.
+	Description string
+}
+
+// NewFieldError returns a new FieldError for the field with the given
+// protobuf field path.
+func NewFieldError(field, format string, args ...interface{}) *FieldError {
+	return &FieldError{Field: field, Description: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the error's description.
+func (e *FieldError) Error() string {
+	return e.Description
+}
+
+// FieldErrors is a list of field errors that may be returned by a rule
+// to report more than one violation.
+type FieldErrors []*FieldError
+
+// Error returns the description of the first error.
+func (e FieldErrors) Error() string {
+	if len(e) == 0 {
+		return ""
+	}
+	return e[0].Description
+}
+
+// Rules is a registry of custom validation rules keyed by RPC method name,
+// ex. "CreateVolume". Rules may be added at any time, including from a
+// StoragePlugin's BeforeServe callback, and are safe for concurrent use.
+// The zero value is ready to use.
+type Rules struct {
+	mu  sync.RWMutex
+	req map[string][]RequestRule
+	rep map[string][]ResponseRule
+}
+
+// AddRequestRule adds a rule for requests to the RPC with the given
+// method name.
+func (r *Rules) AddRequestRule(method string, f RequestRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.req == nil {
+		r.req = map[string][]RequestRule{}
+	}
+	r.req[method] = append(r.req[method], f)
+}
+
+// AddResponseRule adds a rule for responses from the RPC with the given
+// method name.
+func (r *Rules) AddResponseRule(method string, f ResponseRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rep == nil {
+		r.rep = map[string][]ResponseRule{}
+	}
+	r.rep[method] = append(r.rep[method], f)
+}
+
+func (r *Rules) requestRules(method string) []RequestRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.req[method]
+}
+
+func (r *Rules) responseRules(method string) []ResponseRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rep[method]
+}
+
+// WithRequestRule is an Option that adds a custom rule for requests to
+// the RPC with the given method name, ex. "CreateVolume". Request rules
+// run after the built-in checks, and only if the built-in checks passed.
+func WithRequestRule(method string, f RequestRule) Option {
+	return func(o *opts) {
+		o.rules.AddRequestRule(method, f)
+	}
+}
+
+// WithResponseRule is an Option that adds a custom rule for responses from
+// the RPC with the given method name, ex. "CreateVolume". Response rules
+// run after the built-in checks, and only if the built-in checks passed.
+func WithResponseRule(method string, f ResponseRule) Option {
+	return func(o *opts) {
+		o.rules.AddResponseRule(method, f)
+	}
+}
+
+// WithRules is an Option that adds a registry of custom rules. The registry
+// is consulted for every message, so rules added to it after the
+// interceptor is created still take effect.
+func WithRules(r *Rules) Option {
+	return func(o *opts) {
+		o.registries = append(o.registries, r)
+	}
+}
+
+func (s *interceptor) runRequestRules(
+	ctx context.Context,
+	method string,
+	req interface{},
+	v *violations) {
+
+	_, _, name, err := utils.ParseMethod(method)
+	if err != nil {
+		return
+	}
+	for _, r := range append([]*Rules{&s.opts.rules}, s.opts.registries...) {
+		for _, f := range r.requestRules(name) {
+			if err := f(ctx, req); err != nil {
+				v.addRuleError(err)
+			}
+		}
+	}
+}
+
+func (s *interceptor) runResponseRules(
+	ctx context.Context,
+	method string,
+	rep interface{},
+	v *violations) {
+
+	_, _, name, err := utils.ParseMethod(method)
+	if err != nil {
+		return
+	}
+	for _, r := range append([]*Rules{&s.opts.rules}, s.opts.registries...) {
+		for _, f := range r.responseRules(name) {
+			if err := f(ctx, rep); err != nil {
+				v.addRuleError(err)
+			}
+		}
+	}
+}
+
+// addRuleError records the violations described by a rule's error.
+func (v *violations) addRuleError(err error) {
+	switch terr := err.(type) {
+	case *FieldError:
+		v.add(terr.Field, terr.Description)
+		return
+	case FieldErrors:
+		for _, e := range terr {
+			v.add(e.Field, e.Description)
+		}
+		if len(terr) > 0 {
+			return
+		}
+	}
+	if st, ok := status.FromError(err); ok {
+		n := len(v.items)
+		for _, d := range st.Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				v.items = append(v.items, br.FieldViolations...)
+			}
+		}
+		if len(v.items) > n {
+			return
+		}
+		v.add("", st.Message())
+		return
+	}
+	v.add("", err.Error())
+}
@@ -0,0 +1,181 @@
+package specvalidator_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+const (
+	createVolume = "/csi.v1.Controller/CreateVolume"
+	gib4         = 4 * 1024 * 1024 * 1024
+)
+
+func newCreateVolumeRequest(
+	params map[string]string,
+	reqBytes int64) *csi.CreateVolumeRequest {
+
+	return &csi.CreateVolumeRequest{
+		Name:          "vol",
+		Parameters:    params,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: reqBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+			},
+		},
+	}
+}
+
+func requirePool(ctx context.Context, req interface{}) error {
+	r := req.(*csi.CreateVolumeRequest)
+	if r.Parameters["pool"] == "" {
+		return specvalidator.NewFieldError(
+			"parameters", "required: Parameters[pool]")
+	}
+	return nil
+}
+
+func requireMultipleOf4GiB(ctx context.Context, req interface{}) error {
+	r := req.(*csi.CreateVolumeRequest)
+	if n := r.CapacityRange.RequiredBytes; n%gib4 != 0 {
+		return specvalidator.NewFieldError(
+			"capacity_range.required_bytes",
+			"invalid: CapacityRange.RequiredBytes=%d: not a multiple of 4GiB",
+			n)
+	}
+	return nil
+}
+
+func invoke(
+	i grpc.UnaryServerInterceptor,
+	method string,
+	req interface{}) (bool, error) {
+
+	called := false
+	_, err := i(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{VolumeId: "1"},
+			}, nil
+		})
+	return called, err
+}
+
+func TestWithRequestRule(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithRequestRule("CreateVolume", requirePool),
+		specvalidator.WithRequestRule("CreateVolume", requireMultipleOf4GiB))
+
+	// Both rules fail, and both violations are reported.
+	called, err := invoke(i, createVolume, newCreateVolumeRequest(nil, 1))
+	if called {
+		t.Fatal("handler called for invalid request")
+	}
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) != 2 {
+		t.Fatalf("violations=%v", fvs)
+	}
+	if fvs[0].Field != "parameters" {
+		t.Errorf("field[0]=%s", fvs[0].Field)
+	}
+	if fvs[1].Field != "capacity_range.required_bytes" {
+		t.Errorf("field[1]=%s", fvs[1].Field)
+	}
+	if msg := status.Convert(err).Message(); msg != fvs[0].Description {
+		t.Errorf("msg=%s", msg)
+	}
+
+	// Both rules pass.
+	called, err = invoke(i, createVolume, newCreateVolumeRequest(
+		map[string]string{"pool": "gold"}, gib4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("handler not called")
+	}
+}
+
+func TestWithRequestRule_AfterBuiltInChecks(t *testing.T) {
+	var called bool
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithRequestRule("CreateVolume",
+			func(ctx context.Context, req interface{}) error {
+				called = true
+				return nil
+			}))
+
+	req := newCreateVolumeRequest(nil, gib4)
+	req.Name = ""
+	if _, err := invoke(i, createVolume, req); err == nil {
+		t.Fatal("expected error")
+	}
+	if called {
+		t.Fatal("rule called for request that failed built-in checks")
+	}
+}
+
+func TestWithRules(t *testing.T) {
+	var rules specvalidator.Rules
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation(),
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithRules(&rules))
+
+	req := newCreateVolumeRequest(nil, gib4)
+	if _, err := invoke(i, createVolume, req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules added to the registry after the interceptor is created
+	// take effect.
+	rules.AddRequestRule("CreateVolume", requirePool)
+	if _, err := invoke(i, createVolume, req); err == nil {
+		t.Fatal("expected request rule error")
+	}
+
+	// A response rule that returns a plain error.
+	rules.AddResponseRule("CreateVolume",
+		func(ctx context.Context, rep interface{}) error {
+			return errors.New("invalid: Volume.VolumeContext[prefix]")
+		})
+	req.Parameters = map[string]string{"pool": "gold"}
+	_, err := invoke(i, createVolume, req)
+	if c := status.Code(err); c != codes.Internal {
+		t.Fatalf("code=%v", c)
+	}
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) != 1 || fvs[0].Field != "" ||
+		!strings.Contains(fvs[0].Description, "prefix") {
+		t.Fatalf("violations=%v", fvs)
+	}
+
+	// The response is still the first detail.
+	st := status.Convert(err)
+	if _, ok := st.Details()[0].(*csi.CreateVolumeResponse); !ok {
+		t.Fatalf("details[0]=%T", st.Details()[0])
+	}
+}
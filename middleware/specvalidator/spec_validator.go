@@ -1,7 +1,7 @@
 package specvalidator
 
 import (
-	"reflect"
+	"fmt"
 	"regexp"
 	"sync"
 
@@ -14,6 +14,7 @@ import (
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
+	"github.com/rexray/gocsi/middleware/specvalidator/paramschema"
 	"github.com/rexray/gocsi/utils"
 )
 
@@ -24,6 +25,9 @@ type opts struct {
 	sync.Mutex
 	reqValidation               bool
 	repValidation               bool
+	reqReportOnly               bool
+	repReportOnly               bool
+	errCodeValidation           bool
 	requiresStagingTargetPath   bool
 	requiresVolContext          bool
 	requiresPubContext          bool
@@ -33,7 +37,19 @@ type opts struct {
 	requiresCtlrUnpubVolSecrets bool
 	requiresNodeStgVolSecrets   bool
 	requiresNodePubVolSecrets   bool
+	requiresCtlrNewSnapSecrets  bool
+	requiresCtlrDelSnapSecrets  bool
+	requiresCtlrListSnapSecrets bool
+	requiresCtlrExpVolSecrets   bool
 	disableFieldLenCheck        bool
+	rules                       Rules
+	registries                  []*Rules
+	paramSchema                 *paramschema.Schema
+	pluginCaps                  []*csi.PluginCapability
+	ctrlrCaps                   []*csi.ControllerServiceCapability
+	nodeCaps                    []*csi.NodeServiceCapability
+	hasCtrlrCaps                bool
+	hasNodeCaps                 bool
 }
 
 // WithRequestValidation is a Option that enables request validation.
@@ -132,6 +148,91 @@ func WithRequiresNodePublishVolumeSecrets() Option {
 	}
 }
 
+// WithRequiresControllerCreateSnapshotSecrets is a Option
+// that indicates the eponymous requests must contain non-empty secrets
+// data.
+func WithRequiresControllerCreateSnapshotSecrets() Option {
+	return func(o *opts) {
+		o.requiresCtlrNewSnapSecrets = true
+	}
+}
+
+// WithRequiresControllerDeleteSnapshotSecrets is a Option
+// that indicates the eponymous requests must contain non-empty secrets
+// data.
+func WithRequiresControllerDeleteSnapshotSecrets() Option {
+	return func(o *opts) {
+		o.requiresCtlrDelSnapSecrets = true
+	}
+}
+
+// WithRequiresControllerListSnapshotsSecrets is a Option
+// that indicates the eponymous requests must contain non-empty secrets
+// data.
+func WithRequiresControllerListSnapshotsSecrets() Option {
+	return func(o *opts) {
+		o.requiresCtlrListSnapSecrets = true
+	}
+}
+
+// WithRequiresControllerExpandVolumeSecrets is a Option
+// that indicates the eponymous requests must contain non-empty secrets
+// data.
+func WithRequiresControllerExpandVolumeSecrets() Option {
+	return func(o *opts) {
+		o.requiresCtlrExpVolSecrets = true
+	}
+}
+
+// WithParamSchema is a Option that validates CreateVolume request
+// parameters against the given schema. Unknown, missing and invalid
+// parameters are rejected with InvalidArgument. The typed, defaulted
+// parameters are available to the handler via paramschema.FromContext.
+func WithParamSchema(schema *paramschema.Schema) Option {
+	return func(o *opts) {
+		o.paramSchema = schema
+	}
+}
+
+// WithPluginCapabilities is a Option that provides the capabilities
+// advertised by the plug-in's GetPluginCapabilities RPC. When the
+// capabilities include VOLUME_ACCESSIBILITY_CONSTRAINTS, NodeGetInfo
+// responses must contain AccessibleTopology.
+func WithPluginCapabilities(caps ...*csi.PluginCapability) Option {
+	return func(o *opts) {
+		o.pluginCaps = caps
+	}
+}
+
+// WithControllerCapabilities is a Option that provides the capabilities
+// advertised by the plug-in's ControllerGetCapabilities RPC. The
+// capabilities determine which of the volume status fields ListVolumes
+// and ControllerGetVolume responses must contain, and whether Controller
+// requests may use the SINGLE_NODE_SINGLE_WRITER and
+// SINGLE_NODE_MULTI_WRITER access modes.
+func WithControllerCapabilities(
+	caps ...*csi.ControllerServiceCapability) Option {
+
+	return func(o *opts) {
+		o.ctrlrCaps = caps
+		o.hasCtrlrCaps = true
+	}
+}
+
+// WithNodeCapabilities is a Option that provides the capabilities
+// advertised by the plug-in's NodeGetCapabilities RPC. When the
+// capabilities include VOLUME_CONDITION, NodeGetVolumeStats responses
+// must contain VolumeCondition. Node requests may use the
+// SINGLE_NODE_SINGLE_WRITER and SINGLE_NODE_MULTI_WRITER access modes
+// only if the capabilities include SINGLE_NODE_MULTI_WRITER, and may
+// specify a volume mount group only if they include VOLUME_MOUNT_GROUP.
+func WithNodeCapabilities(caps ...*csi.NodeServiceCapability) Option {
+	return func(o *opts) {
+		o.nodeCaps = caps
+		o.hasNodeCaps = true
+	}
+}
+
 // WithDisableFieldLenCheck is a Option
 // that indicates that the length of fields should not be validated
 func WithDisableFieldLenCheck() Option {
@@ -174,9 +275,10 @@ func (s *interceptor) handleServer(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
 
-	return s.handle(ctx, info.FullMethod, req, func() (interface{}, error) {
-		return handler(ctx, req)
-	})
+	return s.handle(ctx, info.FullMethod, req,
+		func(ctx context.Context) (interface{}, error) {
+			return handler(ctx, req)
+		})
 }
 
 func (s *interceptor) handleClient(
@@ -187,9 +289,10 @@ func (s *interceptor) handleClient(
 	invoker grpc.UnaryInvoker,
 	opts ...grpc.CallOption) error {
 
-	_, err := s.handle(ctx, method, req, func() (interface{}, error) {
-		return rep, invoker(ctx, method, req, rep, cc, opts...)
-	})
+	_, err := s.handle(ctx, method, req,
+		func(ctx context.Context) (interface{}, error) {
+			return rep, invoker(ctx, method, req, rep, cc, opts...)
+		})
 	return err
 }
 
@@ -197,34 +300,49 @@ func (s *interceptor) handle(
 	ctx context.Context,
 	method string,
 	req interface{},
-	next func() (interface{}, error)) (interface{}, error) {
+	next func(context.Context) (interface{}, error)) (interface{}, error) {
 
 	// If the request is nil then pass control to the next handler
 	// in the chain.
 	if req == nil {
-		return next()
+		return next(ctx)
 	}
 
 	if s.opts.reqValidation {
-		// Validate the request against the CSI specification.
-		if err := s.validateRequest(ctx, method, req); err != nil {
-			return nil, err
+		// Validate the request against the CSI specification. The
+		// returned context may contain data derived from the request,
+		// such as the parsed CreateVolume parameters.
+		var err error
+		if ctx, err = s.validateRequest(ctx, method, req); err != nil {
+			if !s.opts.reqReportOnly {
+				return nil, err
+			}
+			report(ctx, method, directionRequest, err)
 		}
 	}
 
 	// Use the function passed into this one to get the response. On the
 	// server-side this could possibly invoke additional interceptors or
 	// the RPC. On the client side this invokes the RPC.
-	rep, err := next()
+	rep, err := next(ctx)
 
 	if err != nil {
+		if s.opts.errCodeValidation {
+			return nil, s.validateError(ctx, method, err)
+		}
 		return nil, err
 	}
 
 	if s.opts.repValidation {
 		log.Debug("response validation enabled")
 		// Validate the response against the CSI specification.
-		if err := s.validateResponse(ctx, method, rep); err != nil {
+		if err := s.validateResponse(ctx, method, req, rep); err != nil {
+
+			// In report-only mode the response is returned unchanged.
+			if s.opts.repReportOnly {
+				report(ctx, method, directionResponse, err)
+				return rep, nil
+			}
 
 			// If an error occurred while validating the response, it is
 			// imperative the response not be discarded as it could be
@@ -234,8 +352,16 @@ func (s *interceptor) handle(
 				st = status.New(codes.Internal, err.Error())
 			}
 
-			// Add the response to the error details.
-			st, err2 := st.WithDetails(rep.(proto.Message))
+			// Add the response to the error details ahead of any details
+			// that describe the validation failure.
+			details := []proto.Message{rep.(proto.Message)}
+			for _, d := range st.Details() {
+				if m, ok := d.(proto.Message); ok {
+					details = append(details, m)
+				}
+			}
+			st, err2 := status.New(st.Code(), st.Message()).
+				WithDetails(details...)
 
 			// If there is a problem encoding the response into the
 			// protobuf details then err on the side of caution, log
@@ -278,48 +404,44 @@ type interceptorHasPublishContext interface {
 func (s *interceptor) validateRequest(
 	ctx context.Context,
 	method string,
-	req interface{}) error {
+	req interface{}) (context.Context, error) {
 
 	if req == nil {
-		return nil
+		return ctx, nil
 	}
 
+	v := &violations{code: codes.InvalidArgument}
+
 	// Validate field sizes.
 	if !s.opts.disableFieldLenCheck {
-		if err := validateFieldSizes(req); err != nil {
-			return err
-		}
+		validateFieldSizes(req, v)
 	}
 
 	// Check to see if the request has a volume ID and if it is set.
-	// If the volume ID is not set then return an error.
 	if treq, ok := req.(interceptorHasVolumeID); ok {
 		if treq.GetVolumeId() == "" {
-			return status.Error(
-				codes.InvalidArgument, "required: VolumeID")
+			v.add("volume_id", "required: VolumeID")
 		}
 	}
 
 	// Check to see if the request has volume context and if they're
 	// required. If the volume context is required by no attributes are
-	// specified then return an error.
+	// specified then record a violation.
 	if s.opts.requiresVolContext {
 		if treq, ok := req.(interceptorHasVolumeContext); ok {
 			if len(treq.GetVolumeContext()) == 0 {
-				return status.Error(
-					codes.InvalidArgument, "required: VolumeContext")
+				v.add("volume_context", "required: VolumeContext")
 			}
 		}
 	}
 
 	// Check to see if the request has publish context and if they're
 	// required. If the publish context is required by no attributes are
-	// specified then return an error.
+	// specified then record a violation.
 	if s.opts.requiresPubContext {
 		if treq, ok := req.(interceptorHasPublishContext); ok {
 			if len(treq.GetPublishContext()) == 0 {
-				return status.Error(
-					codes.InvalidArgument, "required: PublishContext")
+				v.add("publish_context", "required: PublishContext")
 			}
 		}
 	}
@@ -333,47 +455,75 @@ func (s *interceptor) validateRequest(
 	// Controller Service
 	//
 	case *csi.CreateVolumeRequest:
-		return s.validateCreateVolumeRequest(ctx, *tobj)
+		ctx = s.validateCreateVolumeRequest(ctx, *tobj, v)
 	case *csi.DeleteVolumeRequest:
-		return s.validateDeleteVolumeRequest(ctx, *tobj)
+		s.validateDeleteVolumeRequest(ctx, *tobj, v)
 	case *csi.ControllerPublishVolumeRequest:
-		return s.validateControllerPublishVolumeRequest(ctx, *tobj)
+		s.validateControllerPublishVolumeRequest(ctx, *tobj, v)
 	case *csi.ControllerUnpublishVolumeRequest:
-		return s.validateControllerUnpublishVolumeRequest(ctx, *tobj)
+		s.validateControllerUnpublishVolumeRequest(ctx, *tobj, v)
 	case *csi.ValidateVolumeCapabilitiesRequest:
-		return s.validateValidateVolumeCapabilitiesRequest(ctx, *tobj)
+		s.validateValidateVolumeCapabilitiesRequest(ctx, *tobj, v)
 	case *csi.GetCapacityRequest:
-		return s.validateGetCapacityRequest(ctx, *tobj)
+		s.validateGetCapacityRequest(ctx, *tobj, v)
+	case *csi.CreateSnapshotRequest:
+		s.validateCreateSnapshotRequest(ctx, *tobj, v)
+	case *csi.DeleteSnapshotRequest:
+		s.validateDeleteSnapshotRequest(ctx, *tobj, v)
+	case *csi.ListSnapshotsRequest:
+		s.validateListSnapshotsRequest(ctx, *tobj, v)
+	case *csi.ControllerExpandVolumeRequest:
+		s.validateControllerExpandVolumeRequest(ctx, *tobj, v)
 		//
 		// Node Service
 		//
 	case *csi.NodeStageVolumeRequest:
-		return s.validateNodeStageVolumeRequest(ctx, *tobj)
+		s.validateNodeStageVolumeRequest(ctx, *tobj, v)
 	case *csi.NodeUnstageVolumeRequest:
-		return s.validateNodeUnstageVolumeRequest(ctx, *tobj)
+		s.validateNodeUnstageVolumeRequest(ctx, *tobj, v)
 	case *csi.NodePublishVolumeRequest:
-		return s.validateNodePublishVolumeRequest(ctx, *tobj)
+		s.validateNodePublishVolumeRequest(ctx, *tobj, v)
 	case *csi.NodeUnpublishVolumeRequest:
-		return s.validateNodeUnpublishVolumeRequest(ctx, *tobj)
+		s.validateNodeUnpublishVolumeRequest(ctx, *tobj, v)
+	case *csi.NodeGetVolumeStatsRequest:
+		s.validateNodeGetVolumeStatsRequest(ctx, *tobj, v)
+	case *csi.NodeExpandVolumeRequest:
+		s.validateNodeExpandVolumeRequest(ctx, *tobj, v)
+		//
+		// GroupController Service
+		//
+	case *csi.CreateVolumeGroupSnapshotRequest:
+		s.validateCreateVolumeGroupSnapshotRequest(ctx, *tobj, v)
+	case *csi.DeleteVolumeGroupSnapshotRequest:
+		s.validateDeleteVolumeGroupSnapshotRequest(ctx, *tobj, v)
+	case *csi.GetVolumeGroupSnapshotRequest:
+		s.validateGetVolumeGroupSnapshotRequest(ctx, *tobj, v)
+	}
+
+	// Custom rules only run if the built-in checks passed so that they
+	// may rely on the request being well formed.
+	if len(v.items) == 0 {
+		s.runRequestRules(ctx, method, req, v)
 	}
 
-	return nil
+	return ctx, v.err()
 }
 
 func (s *interceptor) validateResponse(
 	ctx context.Context,
 	method string,
-	rep interface{}) error {
+	req, rep interface{}) error {
+
+	v := &violations{code: codes.Internal}
 
 	if utils.IsNilResponse(rep) {
-		return status.Error(codes.Internal, "nil response")
+		v.add("", "nil response")
+		return v.err()
 	}
 
 	// Validate the field sizes.
 	if !s.opts.disableFieldLenCheck {
-		if err := validateFieldSizes(rep); err != nil {
-			return err
-		}
+		validateFieldSizes(rep, v)
 	}
 
 	switch tobj := rep.(type) {
@@ -381,240 +531,567 @@ func (s *interceptor) validateResponse(
 	// Controller Service
 	//
 	case *csi.CreateVolumeResponse:
-		return s.validateCreateVolumeResponse(ctx, *tobj)
+		s.validateCreateVolumeResponse(ctx, req, *tobj, v)
 	case *csi.ControllerPublishVolumeResponse:
-		return s.validateControllerPublishVolumeResponse(ctx, *tobj)
+		s.validateControllerPublishVolumeResponse(ctx, *tobj, v)
 	case *csi.ListVolumesResponse:
-		return s.validateListVolumesResponse(ctx, *tobj)
+		s.validateListVolumesResponse(ctx, *tobj, v)
+	case *csi.ControllerGetVolumeResponse:
+		s.validateControllerGetVolumeResponse(ctx, *tobj, v)
 	case *csi.ControllerGetCapabilitiesResponse:
-		return s.validateControllerGetCapabilitiesResponse(ctx, *tobj)
+		s.validateControllerGetCapabilitiesResponse(ctx, *tobj, v)
+	case *csi.ValidateVolumeCapabilitiesResponse:
+		s.validateValidateVolumeCapabilitiesResponse(ctx, *tobj, v)
+	case *csi.GetCapacityResponse:
+		s.validateGetCapacityResponse(ctx, *tobj, v)
+	case *csi.CreateSnapshotResponse:
+		s.validateCreateSnapshotResponse(ctx, *tobj, v)
+	case *csi.ListSnapshotsResponse:
+		s.validateListSnapshotsResponse(ctx, *tobj, v)
+	case *csi.ControllerExpandVolumeResponse:
+		s.validateControllerExpandVolumeResponse(ctx, *tobj, v)
 	//
 	// Identity Service
 	//
 	case *csi.GetPluginInfoResponse:
-		return s.validateGetPluginInfoResponse(ctx, *tobj)
+		s.validateGetPluginInfoResponse(ctx, *tobj, v)
+	case *csi.GetPluginCapabilitiesResponse:
+		s.validateGetPluginCapabilitiesResponse(ctx, *tobj, v)
+	// A ProbeResponse's only field, Ready, is optional and may have
+	// any value, so there is nothing to validate.
+	// case *csi.ProbeResponse:
 	//
 	// Node Service
 	//
 	case *csi.NodeGetInfoResponse:
-		return s.validateNodeGetInfoResponse(ctx, *tobj)
+		s.validateNodeGetInfoResponse(ctx, *tobj, v)
 	case *csi.NodeGetCapabilitiesResponse:
-		return s.validateNodeGetCapabilitiesResponse(ctx, *tobj)
+		s.validateNodeGetCapabilitiesResponse(ctx, *tobj, v)
+	case *csi.NodeGetVolumeStatsResponse:
+		s.validateNodeGetVolumeStatsResponse(ctx, *tobj, v)
+	case *csi.NodeExpandVolumeResponse:
+		s.validateNodeExpandVolumeResponse(ctx, *tobj, v)
+	//
+	// GroupController Service
+	//
+	case *csi.GroupControllerGetCapabilitiesResponse:
+		s.validateGroupControllerGetCapabilitiesResponse(ctx, *tobj, v)
+	case *csi.CreateVolumeGroupSnapshotResponse:
+		s.validateCreateVolumeGroupSnapshotResponse(ctx, req, *tobj, v)
+	case *csi.GetVolumeGroupSnapshotResponse:
+		s.validateGetVolumeGroupSnapshotResponse(ctx, *tobj, v)
 	}
 
-	return nil
+	// Custom rules only run if the built-in checks passed so that they
+	// may rely on the response being well formed.
+	if len(v.items) == 0 {
+		s.runResponseRules(ctx, method, rep, v)
+	}
+
+	return v.err()
+}
+
+func validateSecrets(secrets map[string]string, v *violations) {
+	if len(secrets) == 0 {
+		v.add("secrets", "required: Secrets")
+	}
 }
 
 func (s *interceptor) validateCreateVolumeRequest(
 	ctx context.Context,
-	req csi.CreateVolumeRequest) error {
+	req csi.CreateVolumeRequest,
+	v *violations) context.Context {
 
 	if req.Name == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: Name")
+		v.add("name", "required: Name")
 	}
 	if s.opts.requiresCtlrNewVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
+		validateSecrets(req.Secrets, v)
+	}
+
+	validateVolumeCapabilitiesArg(req.VolumeCapabilities, true, v)
+	s.validateControllerAccessModes(req.VolumeCapabilities, v)
+	validateAccessibilityRequirements(req.AccessibilityRequirements, v)
+
+	if s.opts.paramSchema != nil {
+		vals, err := s.opts.paramSchema.Parse(req.Parameters)
+		if err != nil {
+			for _, e := range err.(paramschema.Errors) {
+				v.add(fmt.Sprintf("parameters[%s]", e.Key), e.Description)
+			}
+			return ctx
 		}
+		ctx = paramschema.NewContext(ctx, vals)
 	}
 
-	return validateVolumeCapabilitiesArg(req.VolumeCapabilities, true)
+	return ctx
 }
 
 func (s *interceptor) validateDeleteVolumeRequest(
 	ctx context.Context,
-	req csi.DeleteVolumeRequest) error {
+	req csi.DeleteVolumeRequest,
+	v *violations) {
 
 	if s.opts.requiresCtlrDelVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
-		}
+		validateSecrets(req.Secrets, v)
 	}
-
-	return nil
 }
 
 func (s *interceptor) validateControllerPublishVolumeRequest(
 	ctx context.Context,
-	req csi.ControllerPublishVolumeRequest) error {
+	req csi.ControllerPublishVolumeRequest,
+	v *violations) {
 
 	if s.opts.requiresCtlrPubVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
-		}
+		validateSecrets(req.Secrets, v)
 	}
 
 	if req.NodeId == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: NodeID")
+		v.add("node_id", "required: NodeID")
 	}
 
-	return validateVolumeCapabilityArg(req.VolumeCapability, true)
+	validateVolumeCapabilityArg(req.VolumeCapability, true, v)
+	s.validateControllerAccessMode(req.VolumeCapability, v)
 }
 
 func (s *interceptor) validateControllerUnpublishVolumeRequest(
 	ctx context.Context,
-	req csi.ControllerUnpublishVolumeRequest) error {
+	req csi.ControllerUnpublishVolumeRequest,
+	v *violations) {
 
 	if s.opts.requiresCtlrUnpubVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
-		}
+		validateSecrets(req.Secrets, v)
 	}
-
-	return nil
 }
 
 func (s *interceptor) validateValidateVolumeCapabilitiesRequest(
 	ctx context.Context,
-	req csi.ValidateVolumeCapabilitiesRequest) error {
+	req csi.ValidateVolumeCapabilitiesRequest,
+	v *violations) {
 
-	return validateVolumeCapabilitiesArg(req.VolumeCapabilities, true)
+	validateVolumeCapabilitiesArg(req.VolumeCapabilities, true, v)
 }
 
 func (s *interceptor) validateGetCapacityRequest(
 	ctx context.Context,
-	req csi.GetCapacityRequest) error {
+	req csi.GetCapacityRequest,
+	v *violations) {
+
+	validateVolumeCapabilitiesArg(req.VolumeCapabilities, false, v)
+	s.validateControllerAccessModes(req.VolumeCapabilities, v)
+}
+
+func (s *interceptor) validateCreateSnapshotRequest(
+	ctx context.Context,
+	req csi.CreateSnapshotRequest,
+	v *violations) {
+
+	if req.Name == "" {
+		v.add("name", "required: Name")
+	}
+	if req.SourceVolumeId == "" {
+		v.add("source_volume_id", "required: SourceVolumeID")
+	}
+	if s.opts.requiresCtlrNewSnapSecrets {
+		validateSecrets(req.Secrets, v)
+	}
+}
+
+func (s *interceptor) validateDeleteSnapshotRequest(
+	ctx context.Context,
+	req csi.DeleteSnapshotRequest,
+	v *violations) {
+
+	if req.SnapshotId == "" {
+		v.add("snapshot_id", "required: SnapshotID")
+	}
+	if s.opts.requiresCtlrDelSnapSecrets {
+		validateSecrets(req.Secrets, v)
+	}
+}
+
+func (s *interceptor) validateListSnapshotsRequest(
+	ctx context.Context,
+	req csi.ListSnapshotsRequest,
+	v *violations) {
+
+	if req.MaxEntries < 0 {
+		v.addf("max_entries", "invalid: MaxEntries=%d", req.MaxEntries)
+	}
+	if s.opts.requiresCtlrListSnapSecrets {
+		validateSecrets(req.Secrets, v)
+	}
+}
+
+func (s *interceptor) validateControllerExpandVolumeRequest(
+	ctx context.Context,
+	req csi.ControllerExpandVolumeRequest,
+	v *violations) {
+
+	if s.opts.requiresCtlrExpVolSecrets {
+		validateSecrets(req.Secrets, v)
+	}
 
-	return validateVolumeCapabilitiesArg(req.VolumeCapabilities, false)
+	validateCapacityRangeArg(req.CapacityRange, true, v)
+	validateVolumeCapabilityArg(req.VolumeCapability, false, v)
+	s.validateControllerAccessMode(req.VolumeCapability, v)
 }
 
 func (s *interceptor) validateNodeStageVolumeRequest(
 	ctx context.Context,
-	req csi.NodeStageVolumeRequest) error {
+	req csi.NodeStageVolumeRequest,
+	v *violations) {
 
 	if req.StagingTargetPath == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: StagingTargetPath")
+		v.add("staging_target_path", "required: StagingTargetPath")
 	}
 
 	if s.opts.requiresNodeStgVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
-		}
+		validateSecrets(req.Secrets, v)
 	}
 
-	return validateVolumeCapabilityArg(req.VolumeCapability, true)
+	validateVolumeCapabilityArg(req.VolumeCapability, true, v)
+	s.validateNodeAccessMode(req.VolumeCapability, v)
+	s.validateVolumeMountGroup(req.VolumeCapability, v)
 }
 
 func (s *interceptor) validateNodeUnstageVolumeRequest(
 	ctx context.Context,
-	req csi.NodeUnstageVolumeRequest) error {
+	req csi.NodeUnstageVolumeRequest,
+	v *violations) {
 
 	if req.StagingTargetPath == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: StagingTargetPath")
+		v.add("staging_target_path", "required: StagingTargetPath")
 	}
-
-	return nil
 }
 
 func (s *interceptor) validateNodePublishVolumeRequest(
 	ctx context.Context,
-	req csi.NodePublishVolumeRequest) error {
+	req csi.NodePublishVolumeRequest,
+	v *violations) {
 
 	if s.opts.requiresStagingTargetPath && req.StagingTargetPath == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: StagingTargetPath")
+		v.add("staging_target_path", "required: StagingTargetPath")
 	}
 
 	if req.TargetPath == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: TargetPath")
+		v.add("target_path", "required: TargetPath")
 	}
 
 	if s.opts.requiresNodePubVolSecrets {
-		if len(req.Secrets) == 0 {
-			return status.Error(
-				codes.InvalidArgument, "required: Secrets")
-		}
+		validateSecrets(req.Secrets, v)
 	}
 
-	return validateVolumeCapabilityArg(req.VolumeCapability, true)
+	validateVolumeCapabilityArg(req.VolumeCapability, true, v)
+	s.validateNodeAccessMode(req.VolumeCapability, v)
+	s.validateVolumeMountGroup(req.VolumeCapability, v)
 }
 
 func (s *interceptor) validateNodeUnpublishVolumeRequest(
 	ctx context.Context,
-	req csi.NodeUnpublishVolumeRequest) error {
+	req csi.NodeUnpublishVolumeRequest,
+	v *violations) {
 
 	if req.TargetPath == "" {
-		return status.Error(
-			codes.InvalidArgument, "required: TargetPath")
+		v.add("target_path", "required: TargetPath")
 	}
+}
+
+func (s *interceptor) validateNodeGetVolumeStatsRequest(
+	ctx context.Context,
+	req csi.NodeGetVolumeStatsRequest,
+	v *violations) {
 
-	return nil
+	if req.VolumePath == "" {
+		v.add("volume_path", "required: VolumePath")
+	}
+}
+
+func (s *interceptor) validateNodeExpandVolumeRequest(
+	ctx context.Context,
+	req csi.NodeExpandVolumeRequest,
+	v *violations) {
+
+	if req.VolumePath == "" {
+		v.add("volume_path", "required: VolumePath")
+	}
+
+	validateCapacityRangeArg(req.CapacityRange, false, v)
+	validateVolumeCapabilityArg(req.VolumeCapability, false, v)
+	s.validateNodeAccessMode(req.VolumeCapability, v)
 }
 
 func (s *interceptor) validateCreateVolumeResponse(
 	ctx context.Context,
-	rep csi.CreateVolumeResponse) error {
+	req interface{},
+	rep csi.CreateVolumeResponse,
+	v *violations) {
 
 	if rep.Volume == nil {
-		return status.Error(codes.Internal, "nil: Volume")
+		v.add("volume", "nil: Volume")
+		return
 	}
 
 	if rep.Volume.VolumeId == "" {
-		return status.Error(codes.Internal, "empty: Volume.Id")
+		v.add("volume.volume_id", "empty: Volume.Id")
 	}
 
 	if s.opts.requiresVolContext && len(rep.Volume.VolumeContext) == 0 {
-		return status.Error(
-			codes.Internal, "non-nil, empty: Volume.VolumeContext")
+		v.add("volume.volume_context",
+			"non-nil, empty: Volume.VolumeContext")
 	}
 
-	return nil
+	validateTopologies(rep.Volume.AccessibleTopology,
+		"volume.accessible_topology", "Volume.AccessibleTopology", v)
+	if treq, ok := req.(*csi.CreateVolumeRequest); ok {
+		validateAccessibleTopology(
+			rep.Volume.AccessibleTopology,
+			treq.AccessibilityRequirements,
+			v)
+	}
 }
 
 func (s *interceptor) validateControllerPublishVolumeResponse(
 	ctx context.Context,
-	rep csi.ControllerPublishVolumeResponse) error {
+	rep csi.ControllerPublishVolumeResponse,
+	v *violations) {
 
 	if s.opts.requiresPubContext && len(rep.PublishContext) == 0 {
-		return status.Error(codes.Internal, "empty: PublishContext")
+		v.add("publish_context", "empty: PublishContext")
 	}
-	return nil
 }
 
 func (s *interceptor) validateListVolumesResponse(
 	ctx context.Context,
-	rep csi.ListVolumesResponse) error {
+	rep csi.ListVolumesResponse,
+	v *violations) {
+
+	var (
+		withPubNodes = hasControllerCapability(s.opts.ctrlrCaps,
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES)
+		withCondition = hasControllerCapability(s.opts.ctrlrCaps,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION)
+	)
 
 	for i, e := range rep.Entries {
-		vol := e.Volume
-		if vol == nil {
-			return status.Errorf(
-				codes.Internal,
+		if e == nil || e.Volume == nil {
+			v.addf(fmt.Sprintf("entries[%d].volume", i),
 				"nil: Entries[%d].Volume", i)
+			continue
 		}
+		vol := e.Volume
 		if vol.VolumeId == "" {
-			return status.Errorf(
-				codes.Internal,
+			v.addf(fmt.Sprintf("entries[%d].volume.volume_id", i),
 				"empty: Entries[%d].Volume.Id", i)
 		}
 		if vol.VolumeContext != nil && len(vol.VolumeContext) == 0 {
-			return status.Errorf(
-				codes.Internal,
+			v.addf(fmt.Sprintf("entries[%d].volume.volume_context", i),
 				"non-nil, empty: Entries[%d].Volume.VolumeContext", i)
 		}
+		validateTopologies(vol.AccessibleTopology,
+			fmt.Sprintf("entries[%d].volume.accessible_topology", i),
+			fmt.Sprintf("Entries[%d].Volume.AccessibleTopology", i),
+			v)
+
+		field := fmt.Sprintf("entries[%d].status", i)
+		name := fmt.Sprintf("Entries[%d].Status", i)
+		if e.Status == nil {
+			if withPubNodes || withCondition {
+				v.addf(field, "nil: %s", name)
+			}
+			continue
+		}
+		validatePublishedNodeIDs(e.Status.PublishedNodeIds, field, name, v)
+		validateVolumeCondition(e.Status.VolumeCondition, withCondition,
+			field+".volume_condition", name+".VolumeCondition", v)
 	}
+}
+
+func (s *interceptor) validateControllerGetVolumeResponse(
+	ctx context.Context,
+	rep csi.ControllerGetVolumeResponse,
+	v *violations) {
 
-	return nil
+	if rep.Volume == nil {
+		v.add("volume", "nil: Volume")
+	} else {
+		if rep.Volume.VolumeId == "" {
+			v.add("volume.volume_id", "empty: Volume.Id")
+		}
+		validateTopologies(rep.Volume.AccessibleTopology,
+			"volume.accessible_topology", "Volume.AccessibleTopology", v)
+	}
+
+	if rep.Status == nil {
+		v.add("status", "nil: Status")
+		return
+	}
+	validatePublishedNodeIDs(rep.Status.PublishedNodeIds, "status", "Status", v)
+	validateVolumeCondition(rep.Status.VolumeCondition,
+		hasControllerCapability(s.opts.ctrlrCaps,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION),
+		"status.volume_condition", "Status.VolumeCondition", v)
 }
 
 func (s *interceptor) validateControllerGetCapabilitiesResponse(
 	ctx context.Context,
-	rep csi.ControllerGetCapabilitiesResponse) error {
+	rep csi.ControllerGetCapabilitiesResponse,
+	v *violations) {
 
 	if rep.Capabilities != nil && len(rep.Capabilities) == 0 {
-		return status.Error(codes.Internal, "non-nil, empty: Capabilities")
+		v.add("capabilities", "non-nil, empty: Capabilities")
+	}
+
+	if hasControllerCapability(rep.Capabilities,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES) &&
+		!hasControllerCapability(rep.Capabilities,
+			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME) {
+
+		v.addf("capabilities", "invalid: %s requires %s",
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+			csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME)
+	}
+}
+
+func (s *interceptor) validateValidateVolumeCapabilitiesResponse(
+	ctx context.Context,
+	rep csi.ValidateVolumeCapabilitiesResponse,
+	v *violations) {
+
+	if rep.Confirmed == nil {
+		return
+	}
+
+	if len(rep.Confirmed.VolumeCapabilities) == 0 {
+		v.add("confirmed.volume_capabilities",
+			"empty: Confirmed.VolumeCapabilities")
+		return
+	}
+
+	for i, cap := range rep.Confirmed.VolumeCapabilities {
+		field := fmt.Sprintf("confirmed.volume_capabilities[%d]", i)
+		if cap == nil {
+			v.addf(field, "nil: Confirmed.VolumeCapabilities[%d]", i)
+			continue
+		}
+		if cap.AccessMode == nil {
+			v.addf(field+".access_mode",
+				"nil: Confirmed.VolumeCapabilities[%d].AccessMode", i)
+		}
+		if cap.AccessType == nil {
+			v.addf(field+".access_type",
+				"nil: Confirmed.VolumeCapabilities[%d].AccessType", i)
+		}
+	}
+}
+
+func (s *interceptor) validateGetCapacityResponse(
+	ctx context.Context,
+	rep csi.GetCapacityResponse,
+	v *violations) {
+
+	if rep.AvailableCapacity < 0 {
+		v.addf("available_capacity",
+			"invalid: AvailableCapacity=%d", rep.AvailableCapacity)
+	}
+}
+
+func (s *interceptor) validateCreateSnapshotResponse(
+	ctx context.Context,
+	rep csi.CreateSnapshotResponse,
+	v *violations) {
+
+	validateSnapshot(rep.Snapshot, "snapshot", "Snapshot", v)
+}
+
+func (s *interceptor) validateListSnapshotsResponse(
+	ctx context.Context,
+	rep csi.ListSnapshotsResponse,
+	v *violations) {
+
+	for i, e := range rep.Entries {
+		if e == nil {
+			v.addf(fmt.Sprintf("entries[%d]", i), "nil: Entries[%d]", i)
+			continue
+		}
+		validateSnapshot(
+			e.Snapshot,
+			fmt.Sprintf("entries[%d].snapshot", i),
+			fmt.Sprintf("Entries[%d].Snapshot", i),
+			v)
+	}
+}
+
+func (s *interceptor) validateControllerExpandVolumeResponse(
+	ctx context.Context,
+	rep csi.ControllerExpandVolumeResponse,
+	v *violations) {
+
+	if rep.CapacityBytes < 0 {
+		v.addf("capacity_bytes",
+			"invalid: CapacityBytes=%d", rep.CapacityBytes)
+	}
+}
+
+// validateSnapshot records the violations for snap. The field argument
+// is the snapshot's protobuf field path and name is the path used in the
+// violation descriptions.
+func validateSnapshot(
+	snap *csi.Snapshot,
+	field, name string,
+	v *violations) {
+
+	if snap == nil {
+		v.addf(field, "nil: %s", name)
+		return
+	}
+	if snap.SnapshotId == "" {
+		v.addf(field+".snapshot_id", "empty: %s.SnapshotID", name)
+	}
+	if snap.SourceVolumeId == "" {
+		v.addf(field+".source_volume_id", "empty: %s.SourceVolumeID", name)
+	}
+	if snap.CreationTime == nil {
+		v.addf(field+".creation_time", "nil: %s.CreationTime", name)
+	}
+	if snap.SizeBytes < 0 {
+		v.addf(field+".size_bytes",
+			"invalid: %s.SizeBytes=%d", name, snap.SizeBytes)
+	}
+}
+
+// validatePublishedNodeIDs records a violation for each empty ID in ids.
+// The field and name arguments are those of the volume status.
+func validatePublishedNodeIDs(
+	ids []string,
+	field, name string,
+	v *violations) {
+
+	for i, id := range ids {
+		if id == "" {
+			v.addf(fmt.Sprintf("%s.published_node_ids[%d]", field, i),
+				"empty: %s.PublishedNodeIds[%d]", name, i)
+		}
+	}
+}
+
+// validateVolumeCondition records the violations for cond. A nil
+// condition is a violation only if required is true.
+func validateVolumeCondition(
+	cond *csi.VolumeCondition,
+	required bool,
+	field, name string,
+	v *violations) {
+
+	if cond == nil {
+		if required {
+			v.addf(field, "nil: %s", name)
+		}
+		return
+	}
+	if cond.Message == "" {
+		v.addf(field+".message", "empty: %s.Message", name)
 	}
-	return nil
 }
 
 const (
@@ -623,205 +1100,229 @@ const (
 	pluginVendorVersionPatt = `^v?(\d+\.){2}(\d+)(-.+)?$`
 )
 
+var (
+	pluginNameRX          = regexp.MustCompile(pluginNamePatt)
+	pluginVendorVersionRX = regexp.MustCompile(pluginVendorVersionPatt)
+)
+
 func (s *interceptor) validateGetPluginInfoResponse(
 	ctx context.Context,
-	rep csi.GetPluginInfoResponse) error {
+	rep csi.GetPluginInfoResponse,
+	v *violations) {
 
 	log.Debug("validateGetPluginInfoResponse: enter")
 
 	if rep.Name == "" {
-		return status.Error(codes.Internal, "empty: Name")
-	}
-	if l := len(rep.Name); l > pluginNameMax {
-		return status.Errorf(codes.Internal,
-			"exceeds size limit: Name=%s: max=%d, size=%d",
+		v.add("name", "empty: Name")
+	} else if l := len(rep.Name); l > pluginNameMax {
+		v.addf("name", "exceeds size limit: Name=%s: max=%d, size=%d",
 			rep.Name, pluginNameMax, l)
-	}
-	nok, err := regexp.MatchString(pluginNamePatt, rep.Name)
-	if err != nil {
-		return err
-	}
-	if !nok {
-		return status.Errorf(codes.Internal,
-			"invalid: Name=%s: patt=%s",
+	} else if !pluginNameRX.MatchString(rep.Name) {
+		v.addf("name", "invalid: Name=%s: patt=%s",
 			rep.Name, pluginNamePatt)
 	}
 	if rep.VendorVersion == "" {
-		return status.Error(codes.Internal, "empty: VendorVersion")
-	}
-	vok, err := regexp.MatchString(pluginVendorVersionPatt, rep.VendorVersion)
-	if err != nil {
-		return err
-	}
-	if !vok {
-		return status.Errorf(codes.Internal,
-			"invalid: VendorVersion=%s: patt=%s",
+		v.add("vendor_version", "empty: VendorVersion")
+	} else if !pluginVendorVersionRX.MatchString(rep.VendorVersion) {
+		v.addf("vendor_version", "invalid: VendorVersion=%s: patt=%s",
 			rep.VendorVersion, pluginVendorVersionPatt)
 	}
 	if rep.Manifest != nil && len(rep.Manifest) == 0 {
-		return status.Error(codes.Internal,
-			"non-nil, empty: Manifest")
+		v.add("manifest", "non-nil, empty: Manifest")
+	}
+}
+
+func (s *interceptor) validateGetPluginCapabilitiesResponse(
+	ctx context.Context,
+	rep csi.GetPluginCapabilitiesResponse,
+	v *violations) {
+
+	if rep.Capabilities != nil && len(rep.Capabilities) == 0 {
+		v.add("capabilities", "non-nil, empty: Capabilities")
+	}
+	for i, c := range rep.Capabilities {
+		if c == nil || c.Type == nil {
+			v.addf(fmt.Sprintf("capabilities[%d].type", i),
+				"nil: Capabilities[%d].Type", i)
+		}
 	}
-	return nil
 }
 
 func (s *interceptor) validateNodeGetInfoResponse(
 	ctx context.Context,
-	rep csi.NodeGetInfoResponse) error {
+	rep csi.NodeGetInfoResponse,
+	v *violations) {
+
 	if rep.NodeId == "" {
-		return status.Error(codes.Internal, "empty: NodeID")
+		v.add("node_id", "empty: NodeID")
 	}
 
-	return nil
+	if rep.AccessibleTopology != nil {
+		validateTopology(rep.AccessibleTopology,
+			"accessible_topology", "AccessibleTopology", v)
+	} else if hasVolumeAccessibilityConstraints(s.opts.pluginCaps) {
+		v.add("accessible_topology", "nil: AccessibleTopology")
+	}
 }
 
 func (s *interceptor) validateNodeGetCapabilitiesResponse(
 	ctx context.Context,
-	rep csi.NodeGetCapabilitiesResponse) error {
+	rep csi.NodeGetCapabilitiesResponse,
+	v *violations) {
 
 	if rep.Capabilities != nil && len(rep.Capabilities) == 0 {
-		return status.Error(codes.Internal, "non-nil, empty: Capabilities")
+		v.add("capabilities", "non-nil, empty: Capabilities")
+	}
+}
+
+func (s *interceptor) validateNodeGetVolumeStatsResponse(
+	ctx context.Context,
+	rep csi.NodeGetVolumeStatsResponse,
+	v *violations) {
+
+	for i, u := range rep.Usage {
+		field := fmt.Sprintf("usage[%d]", i)
+		if u == nil {
+			v.addf(field, "nil: Usage[%d]", i)
+			continue
+		}
+		if u.Available < 0 {
+			v.addf(field+".available",
+				"invalid: Usage[%d].Available=%d", i, u.Available)
+		}
+		if u.Total < 0 {
+			v.addf(field+".total",
+				"invalid: Usage[%d].Total=%d", i, u.Total)
+		}
+		if u.Used < 0 {
+			v.addf(field+".used",
+				"invalid: Usage[%d].Used=%d", i, u.Used)
+		}
+	}
+
+	validateVolumeCondition(rep.VolumeCondition,
+		hasNodeCapability(s.opts.nodeCaps,
+			csi.NodeServiceCapability_RPC_VOLUME_CONDITION),
+		"volume_condition", "VolumeCondition", v)
+}
+
+func (s *interceptor) validateNodeExpandVolumeResponse(
+	ctx context.Context,
+	rep csi.NodeExpandVolumeResponse,
+	v *violations) {
+
+	if rep.CapacityBytes < 0 {
+		v.addf("capacity_bytes",
+			"invalid: CapacityBytes=%d", rep.CapacityBytes)
+	}
+}
+
+func validateCapacityRangeArg(
+	cr *csi.CapacityRange,
+	required bool,
+	v *violations) {
+
+	if cr == nil {
+		if required {
+			v.add("capacity_range", "required: CapacityRange")
+		}
+		return
+	}
+
+	if cr.RequiredBytes < 0 {
+		v.addf("capacity_range.required_bytes",
+			"invalid: CapacityRange.RequiredBytes=%d", cr.RequiredBytes)
+	}
+	if cr.LimitBytes < 0 {
+		v.addf("capacity_range.limit_bytes",
+			"invalid: CapacityRange.LimitBytes=%d", cr.LimitBytes)
+	}
+	if cr.RequiredBytes == 0 && cr.LimitBytes == 0 {
+		v.add("capacity_range",
+			"required: CapacityRange.RequiredBytes or "+
+				"CapacityRange.LimitBytes")
+	}
+	if cr.LimitBytes > 0 && cr.LimitBytes < cr.RequiredBytes {
+		v.addf("capacity_range.limit_bytes",
+			"invalid: CapacityRange.LimitBytes=%d < RequiredBytes=%d",
+			cr.LimitBytes, cr.RequiredBytes)
 	}
-	return nil
 }
 
 func validateVolumeCapabilityArg(
 	volCap *csi.VolumeCapability,
-	required bool) error {
+	required bool,
+	v *violations) {
 
-	if required && volCap == nil {
-		return status.Error(codes.InvalidArgument, "required: VolumeCapability")
+	if volCap == nil {
+		if required {
+			v.add("volume_capability", "required: VolumeCapability")
+		}
+		return
 	}
 
 	if volCap.AccessMode == nil {
-		return status.Error(codes.InvalidArgument, "required: AccessMode")
-	}
-
-	atype := volCap.GetAccessType()
-	if atype == nil {
-		return status.Error(codes.InvalidArgument, "required: AccessType")
+		v.add("volume_capability.access_mode", "required: AccessMode")
 	}
 
-	switch tatype := atype.(type) {
+	switch tatype := volCap.GetAccessType().(type) {
+	case nil:
+		v.add("volume_capability.access_type", "required: AccessType")
 	case *csi.VolumeCapability_Block:
 		if tatype.Block == nil {
-			return status.Error(codes.InvalidArgument,
+			v.add("volume_capability.block",
 				"required: AccessType.Block")
 		}
 	case *csi.VolumeCapability_Mount:
 		if tatype.Mount == nil {
-			return status.Error(codes.InvalidArgument,
+			v.add("volume_capability.mount",
 				"required: AccessType.Mount")
 		}
 	default:
-		return status.Errorf(codes.InvalidArgument,
-			"invalid: AccessType=%T", atype)
+		v.addf("volume_capability.access_type",
+			"invalid: AccessType=%T", tatype)
 	}
-
-	return nil
 }
 
 func validateVolumeCapabilitiesArg(
 	volCaps []*csi.VolumeCapability,
-	required bool) error {
+	required bool,
+	v *violations) {
 
 	if len(volCaps) == 0 {
 		if required {
-			return status.Error(
-				codes.InvalidArgument, "required: VolumeCapabilities")
+			v.add("volume_capabilities", "required: VolumeCapabilities")
 		}
-		return nil
+		return
 	}
 
 	for i, cap := range volCaps {
+		field := fmt.Sprintf("volume_capabilities[%d]", i)
+		if cap == nil {
+			v.addf(field, "required: VolumeCapabilities[%d]", i)
+			continue
+		}
 		if cap.AccessMode == nil {
-			return status.Errorf(
-				codes.InvalidArgument,
+			v.addf(field+".access_mode",
 				"required: VolumeCapabilities[%d].AccessMode", i)
 		}
-		atype := cap.GetAccessType()
-		if atype == nil {
-			return status.Errorf(
-				codes.InvalidArgument,
+		switch tatype := cap.GetAccessType().(type) {
+		case nil:
+			v.addf(field+".access_type",
 				"required: VolumeCapabilities[%d].AccessType", i)
-		}
-		switch tatype := atype.(type) {
 		case *csi.VolumeCapability_Block:
 			if tatype.Block == nil {
-				return status.Errorf(
-					codes.InvalidArgument,
+				v.addf(field+".block",
 					"required: VolumeCapabilities[%d].AccessType.Block", i)
-
 			}
 		case *csi.VolumeCapability_Mount:
 			if tatype.Mount == nil {
-				return status.Errorf(
-					codes.InvalidArgument,
+				v.addf(field+".mount",
 					"required: VolumeCapabilities[%d].AccessType.Mount", i)
 			}
 		default:
-			return status.Errorf(
-				codes.InvalidArgument,
-				"invalid: VolumeCapabilities[%d].AccessType=%T", i, atype)
-		}
-	}
-
-	return nil
-}
-
-const (
-	maxFieldString = 128
-	maxFieldMap    = 4096
-)
-
-func validateFieldSizes(msg interface{}) error {
-	rv := reflect.ValueOf(msg).Elem()
-	tv := rv.Type()
-	nf := tv.NumField()
-	for i := 0; i < nf; i++ {
-		f := rv.Field(i)
-		switch f.Kind() {
-		case reflect.String:
-			if l := f.Len(); l > maxFieldString {
-				return status.Errorf(
-					codes.InvalidArgument,
-					"exceeds size limit: %s: max=%d, size=%d",
-					tv.Field(i).Name, maxFieldString, l)
-			}
-		case reflect.Map:
-			if f.Len() == 0 {
-				continue
-			}
-			size := 0
-			for _, k := range f.MapKeys() {
-				if k.Kind() == reflect.String {
-					kl := k.Len()
-					if kl > maxFieldString {
-						return status.Errorf(
-							codes.InvalidArgument,
-							"exceeds size limit: %s[%s]: max=%d, size=%d",
-							tv.Field(i).Name, k.String(), maxFieldString, kl)
-					}
-					size = size + kl
-				}
-				if v := f.MapIndex(k); v.Kind() == reflect.String {
-					vl := v.Len()
-					if vl > maxFieldString {
-						return status.Errorf(
-							codes.InvalidArgument,
-							"exceeds size limit: %s[%s]=: max=%d, size=%d",
-							tv.Field(i).Name, k.String(), maxFieldString, vl)
-					}
-					size = size + vl
-				}
-			}
-			if size > maxFieldMap {
-				return status.Errorf(
-					codes.InvalidArgument,
-					"exceeds size limit: %s: max=%d, size=%d",
-					tv.Field(i).Name, maxFieldMap, size)
-			}
+			v.addf(field+".access_type",
+				"invalid: VolumeCapabilities[%d].AccessType=%T", i, tatype)
 		}
 	}
-	return nil
 }
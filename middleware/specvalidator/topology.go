@@ -0,0 +1,198 @@
+package specvalidator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const topologyMax = 63
+
+var (
+	// topologyNameRX matches a topology key's name segment and a
+	// topology value: alphanumerics at both ends with dashes, underscores,
+	// dots and alphanumerics in between.
+	topologyNameRX = regexp.MustCompile(
+		`^[a-zA-Z0-9]([-_.a-zA-Z0-9]*[a-zA-Z0-9])?$`)
+
+	// topologyPrefixRX matches a topology key's prefix, a DNS subdomain.
+	topologyPrefixRX = regexp.MustCompile(
+		`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// validateTopologyKey returns a description of why k is not a valid
+// topology key, or an empty string if it is valid.
+func validateTopologyKey(k string) string {
+	name := k
+	if i := strings.LastIndex(k, "/"); i >= 0 {
+		prefix := k[:i]
+		name = k[i+1:]
+		if prefix == "" {
+			return "empty prefix"
+		}
+		if len(prefix) > topologyMax {
+			return fmt.Sprintf(
+				"prefix exceeds size limit: max=%d, size=%d",
+				topologyMax, len(prefix))
+		}
+		if !topologyPrefixRX.MatchString(prefix) {
+			return "invalid prefix"
+		}
+	}
+	if name == "" {
+		return "empty name"
+	}
+	if len(name) > topologyMax {
+		return fmt.Sprintf(
+			"name exceeds size limit: max=%d, size=%d",
+			topologyMax, len(name))
+	}
+	if !topologyNameRX.MatchString(name) {
+		return "invalid name"
+	}
+	return ""
+}
+
+// validateTopology records the violations for t. The field argument is
+// the topology's protobuf field path and name is the path used in the
+// violation descriptions.
+func validateTopology(t *csi.Topology, field, name string, v *violations) {
+	if t == nil {
+		v.addf(field, "nil: %s", name)
+		return
+	}
+
+	// Report the violations in a predictable order.
+	keys := make([]string, 0, len(t.Segments))
+	for k := range t.Segments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		sf := fmt.Sprintf("%s.segments[%s]", field, k)
+		if desc := validateTopologyKey(k); desc != "" {
+			v.addf(sf, "invalid: %s.Segments[%s]: key: %s", name, k, desc)
+		}
+		val := t.Segments[k]
+		switch {
+		case val == "":
+			v.addf(sf, "empty: %s.Segments[%s]", name, k)
+		case len(val) > topologyMax:
+			v.addf(sf, "exceeds size limit: %s.Segments[%s]: max=%d, size=%d",
+				name, k, topologyMax, len(val))
+		case !topologyNameRX.MatchString(val):
+			v.addf(sf, "invalid: %s.Segments[%s]=%s", name, k, val)
+		}
+	}
+}
+
+func validateTopologies(
+	topologies []*csi.Topology,
+	field, name string,
+	v *violations) {
+
+	for i, t := range topologies {
+		validateTopology(
+			t,
+			fmt.Sprintf("%s[%d]", field, i),
+			fmt.Sprintf("%s[%d]", name, i),
+			v)
+	}
+}
+
+func validateAccessibilityRequirements(
+	ar *csi.TopologyRequirement,
+	v *violations) {
+
+	if ar == nil {
+		return
+	}
+
+	validateTopologies(ar.Requisite,
+		"accessibility_requirements.requisite",
+		"AccessibilityRequirements.Requisite", v)
+	validateTopologies(ar.Preferred,
+		"accessibility_requirements.preferred",
+		"AccessibilityRequirements.Preferred", v)
+
+	// If requisite topologies are specified then every preferred
+	// topology must also be a requisite topology.
+	if len(ar.Requisite) == 0 {
+		return
+	}
+	for i, p := range ar.Preferred {
+		if p == nil {
+			continue
+		}
+		found := false
+		for _, r := range ar.Requisite {
+			if r != nil && segmentsEqual(p.Segments, r.Segments) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addf(
+				fmt.Sprintf("accessibility_requirements.preferred[%d]", i),
+				"invalid: AccessibilityRequirements.Preferred[%d]: "+
+					"not in AccessibilityRequirements.Requisite", i)
+		}
+	}
+}
+
+// validateAccessibleTopology records a violation if none of a new
+// volume's accessible topologies are compatible with any of the requisite
+// topologies from the request.
+func validateAccessibleTopology(
+	accessible []*csi.Topology,
+	ar *csi.TopologyRequirement,
+	v *violations) {
+
+	if ar == nil || len(ar.Requisite) == 0 || len(accessible) == 0 {
+		return
+	}
+	for _, a := range accessible {
+		for _, r := range ar.Requisite {
+			if a != nil && r != nil &&
+				segmentsCompatible(a.Segments, r.Segments) {
+				return
+			}
+		}
+	}
+	v.add("volume.accessible_topology",
+		"invalid: Volume.AccessibleTopology: "+
+			"does not satisfy AccessibilityRequirements.Requisite")
+}
+
+func segmentsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return segmentsCompatible(a, b)
+}
+
+// segmentsCompatible returns true if every key in both a and b has the
+// same value in both, ex. {zone: z1} is compatible with
+// {zone: z1, rack: r1}.
+func segmentsCompatible(a, b map[string]string) bool {
+	for k, av := range a {
+		if bv, ok := b[k]; ok && av != bv {
+			return false
+		}
+	}
+	return true
+}
+
+func hasVolumeAccessibilityConstraints(caps []*csi.PluginCapability) bool {
+	for _, c := range caps {
+		if s := c.GetService(); s != nil && s.Type ==
+			csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS {
+			return true
+		}
+	}
+	return false
+}
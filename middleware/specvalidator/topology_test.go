@@ -0,0 +1,181 @@
+package specvalidator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/middleware/specvalidator"
+)
+
+func topology(kv ...string) *csi.Topology {
+	t := &csi.Topology{Segments: map[string]string{}}
+	for i := 0; i+1 < len(kv); i += 2 {
+		t.Segments[kv[i]] = kv[i+1]
+	}
+	return t
+}
+
+func invokeWithResponse(
+	i grpc.UnaryServerInterceptor,
+	method string,
+	req, rep interface{}) error {
+
+	_, err := i(
+		context.Background(),
+		req,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return rep, nil
+		})
+	return err
+}
+
+func TestTopology_Request(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+
+	req := newCreateVolumeRequest(nil, gib4)
+	req.AccessibilityRequirements = &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{
+			topology("example.com/zone", "z1"),
+			topology("example.com/zone", "z2"),
+		},
+		Preferred: []*csi.Topology{
+			topology("example.com/zone", "z2"),
+		},
+	}
+	if _, err := invoke(i, createVolume, req); err != nil {
+		t.Fatal(err)
+	}
+
+	// A preferred topology that is not a requisite topology.
+	req.AccessibilityRequirements.Preferred = append(
+		req.AccessibilityRequirements.Preferred,
+		topology("example.com/zone", "z3"))
+	_, err := invoke(i, createVolume, req)
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Fatalf("code=%v", c)
+	}
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) != 1 ||
+		fvs[0].Field != "accessibility_requirements.preferred[1]" {
+		t.Fatalf("violations=%v", fvs)
+	}
+}
+
+func TestTopology_Syntax(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithRequestValidation())
+
+	for _, tc := range []struct {
+		key, val string
+		ok       bool
+	}{
+		{"zone", "z1", true},
+		{"topology.example.com/zone", "us-east-1a", true},
+		{"example.com/rack_1.a", "r.1", true},
+		{"/zone", "z1", false},
+		{"Example.com/zone", "z1", false},
+		{"example.com/-zone", "z1", false},
+		{"example.com/", "z1", false},
+		{strings.Repeat("z", 64), "z1", false},
+		{strings.Repeat("p", 64) + "/zone", "z1", false},
+		{"zone", "", false},
+		{"zone", "z1-", false},
+		{"zone", strings.Repeat("z", 64), false},
+	} {
+		req := newCreateVolumeRequest(nil, gib4)
+		req.AccessibilityRequirements = &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{topology(tc.key, tc.val)},
+		}
+		_, err := invoke(i, createVolume, req)
+		if tc.ok && err != nil {
+			t.Errorf("%q=%q: %v", tc.key, tc.val, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("%q=%q: expected error", tc.key, tc.val)
+		}
+	}
+}
+
+func TestTopology_CreateVolumeResponse(t *testing.T) {
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+
+	req := newCreateVolumeRequest(nil, gib4)
+	req.AccessibilityRequirements = &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{
+			topology("zone", "z1", "rack", "r1"),
+		},
+	}
+	newRep := func(t ...*csi.Topology) *csi.CreateVolumeResponse {
+		return &csi.CreateVolumeResponse{
+			Volume: &csi.Volume{VolumeId: "1", AccessibleTopology: t},
+		}
+	}
+
+	for _, rep := range []*csi.CreateVolumeResponse{
+		newRep(),
+		newRep(topology("zone", "z1")),
+		newRep(topology("zone", "z2"), topology("zone", "z1", "rack", "r1")),
+	} {
+		if err := invokeWithResponse(i, createVolume, req, rep); err != nil {
+			t.Errorf("%v: %v", rep.Volume.AccessibleTopology, err)
+		}
+	}
+
+	err := invokeWithResponse(
+		i, createVolume, req, newRep(topology("zone", "z1", "rack", "r2")))
+	if c := status.Code(err); c != codes.Internal {
+		t.Fatalf("code=%v", c)
+	}
+	fvs := specvalidator.FieldViolations(err)
+	if len(fvs) != 1 || fvs[0].Field != "volume.accessible_topology" {
+		t.Fatalf("violations=%v", fvs)
+	}
+}
+
+func TestTopology_NodeGetInfoResponse(t *testing.T) {
+	const nodeGetInfo = "/csi.v1.Node/NodeGetInfo"
+
+	var (
+		req  = &csi.NodeGetInfoRequest{}
+		rep  = &csi.NodeGetInfoResponse{NodeId: "1"}
+		caps = []*csi.PluginCapability{
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+					},
+				},
+			},
+		}
+	)
+
+	// Topology is optional if the plug-in does not advertise
+	// accessibility constraints.
+	i := specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation())
+	if err := invokeWithResponse(i, nodeGetInfo, req, rep); err != nil {
+		t.Fatal(err)
+	}
+
+	i = specvalidator.NewServerSpecValidator(
+		specvalidator.WithResponseValidation(),
+		specvalidator.WithPluginCapabilities(caps...))
+	err := invokeWithResponse(i, nodeGetInfo, req, rep)
+	if fvs := specvalidator.FieldViolations(err); len(fvs) != 1 ||
+		fvs[0].Field != "accessible_topology" {
+		t.Fatalf("violations=%v", fvs)
+	}
+
+	rep.AccessibleTopology = topology("zone", "z1")
+	if err := invokeWithResponse(i, nodeGetInfo, req, rep); err != nil {
+		t.Fatal(err)
+	}
+}
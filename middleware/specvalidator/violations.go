@@ -0,0 +1,76 @@
+package specvalidator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// violations collects the field violations found while validating a
+// single request or response so that all of them may be reported at once.
+type violations struct {
+	code  codes.Code
+	items []*errdetails.BadRequest_FieldViolation
+}
+
+// add records a violation for the field with the given protobuf field
+// path, ex. "volume_capabilities[0].access_mode".
+func (v *violations) add(field, desc string) {
+	v.items = append(v.items, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: desc,
+	})
+}
+
+func (v *violations) addf(field, format string, args ...interface{}) {
+	v.add(field, fmt.Sprintf(format, args...))
+}
+
+// err returns nil if no violations were recorded. Otherwise a gRPC status
+// error is returned with the description of the first violation as its
+// message and a google.rpc.BadRequest detail that lists every violation.
+func (v *violations) err() error {
+	if len(v.items) == 0 {
+		return nil
+	}
+	st := status.New(v.code, v.items[0].Description)
+	dst, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: v.items,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return dst.Err()
+}
+
+// FieldViolations returns the field violations from the google.rpc.BadRequest
+// details of the gRPC status error err. A nil slice is returned if err is
+// not a gRPC status error or has no such details.
+func FieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	var fvs []*errdetails.BadRequest_FieldViolation
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			fvs = append(fvs, br.FieldViolations...)
+		}
+	}
+	return fvs
+}
+
+// protoFieldName returns the protobuf name of the struct field f, or the
+// Go field name if f does not have a protobuf struct tag.
+func protoFieldName(f reflect.StructField) string {
+	for _, s := range strings.Split(f.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(s, "name=") {
+			return s[len("name="):]
+		}
+	}
+	return f.Name
+}
@@ -14,9 +14,10 @@ import (
 func New() gocsi.StoragePluginProvider {
 	svc := service.New()
 	return &gocsi.StoragePlugin{
-		Controller: svc,
-		Identity:   svc,
-		Node:       svc,
+		Controller:      svc,
+		GroupController: svc,
+		Identity:        svc,
+		Node:            svc,
 
 		// BeforeServe allows the SP to participate in the startup
 		// sequence. This function is invoked directly before the
@@ -42,6 +42,15 @@ func (s *service) CreateVolume(
 	defer s.volsRWL.Unlock()
 	s.vols = append(s.vols, v)
 
+	// Volumes created with the abnormal parameter report an abnormal
+	// condition until it is changed with SetVolumeCondition.
+	if msg, ok := req.Parameters[AbnormalParam]; ok {
+		if msg == "" {
+			msg = "volume is abnormal"
+		}
+		s.conds[v.VolumeId] = csi.VolumeCondition{Abnormal: true, Message: msg}
+	}
+
 	return &csi.CreateVolumeResponse{Volume: &v}, nil
 }
 
@@ -65,6 +74,8 @@ func (s *service) DeleteVolume(
 	copy(s.vols[i:], s.vols[i+1:])
 	s.vols[len(s.vols)-1] = csi.Volume{}
 	s.vols = s.vols[:len(s.vols)-1]
+	delete(s.conds, req.VolumeId)
+	delete(s.singleWriters, req.VolumeId)
 	log.WithField("volumeID", req.VolumeId).Debug("mock delete volume")
 	return &csi.DeleteVolumeResponse{}, nil
 }
@@ -87,6 +98,19 @@ func (s *service) ControllerPublishVolume(
 	// to the specified node.
 	devPathKey := path.Join(req.NodeId, "dev")
 
+	// A volume published with a single node access mode may not be
+	// published to another node.
+	switch req.GetVolumeCapability().GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		for _, nid := range publishedNodeIDs(v) {
+			if nid != req.NodeId {
+				return nil, status.Errorf(codes.FailedPrecondition,
+					"%s: published to node %s", req.VolumeId, nid)
+			}
+		}
+	}
+
 	// Check to see if the volume is already published.
 	if device := v.VolumeContext[devPathKey]; device != "" {
 		return &csi.ControllerPublishVolumeResponse{
@@ -171,12 +195,22 @@ func (s *service) ListVolumes(
 	// Copy the mock volumes into a new slice in order to avoid
 	// locking the service's volume slice for the duration of the
 	// ListVolumes RPC.
-	var vols []csi.Volume
+	var (
+		vols     []csi.Volume
+		statuses []*csi.ListVolumesResponse_VolumeStatus
+	)
 	func() {
 		s.volsRWL.RLock()
 		defer s.volsRWL.RUnlock()
 		vols = make([]csi.Volume, len(s.vols))
 		copy(vols, s.vols)
+		statuses = make([]*csi.ListVolumesResponse_VolumeStatus, len(vols))
+		for i, v := range vols {
+			statuses[i] = &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodeIDs(v),
+				VolumeCondition:  s.volumeConditionNoLock(v.VolumeId),
+			}
+		}
 	}()
 
 	var (
@@ -223,6 +257,7 @@ func (s *service) ListVolumes(
 	for i = 0; i < len(entries); i++ {
 		entries[i] = &csi.ListVolumesResponse_Entry{
 			Volume: &vols[j],
+			Status: statuses[j],
 		}
 		j++
 	}
@@ -238,6 +273,28 @@ func (s *service) ListVolumes(
 	}, nil
 }
 
+func (s *service) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest) (
+	*csi.ControllerGetVolumeResponse, error) {
+
+	s.volsRWL.RLock()
+	defer s.volsRWL.RUnlock()
+
+	i, v := s.findVolNoLock("id", req.VolumeId)
+	if i < 0 {
+		return nil, status.Error(codes.NotFound, req.VolumeId)
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &v,
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: publishedNodeIDs(v),
+			VolumeCondition:  s.volumeConditionNoLock(v.VolumeId),
+		},
+	}, nil
+}
+
 func (s *service) GetCapacity(
 	ctx context.Context,
 	req *csi.GetCapacityRequest) (
@@ -297,6 +354,34 @@ func (s *service) ControllerGetCapabilities(
 					},
 				},
 			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_GET_VOLUME,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -440,3 +525,11 @@ func (s *service) ControllerExpandVolume(
 		NodeExpansionRequired: false,
 	}, nil
 }
+
+func (s *service) ControllerModifyVolume(
+	ctx context.Context,
+	req *csi.ControllerModifyVolumeRequest) (
+	*csi.ControllerModifyVolumeResponse, error) {
+
+	return nil, status.Error(codes.Unimplemented, "")
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// groupSnapshot is a volume group snapshot and the name with which it
+// was created.
+type groupSnapshot struct {
+	name  string
+	group csi.VolumeGroupSnapshot
+}
+
+func (s *service) GroupControllerGetCapabilities(
+	ctx context.Context,
+	req *csi.GroupControllerGetCapabilitiesRequest) (
+	*csi.GroupControllerGetCapabilitiesResponse, error) {
+
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.GroupControllerServiceCapability{
+			{
+				Type: &csi.GroupControllerServiceCapability_Rpc{
+					Rpc: &csi.GroupControllerServiceCapability_RPC{
+						Type: csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (s *service) CreateVolumeGroupSnapshot(
+	ctx context.Context,
+	req *csi.CreateVolumeGroupSnapshotRequest) (
+	*csi.CreateVolumeGroupSnapshotResponse, error) {
+
+	s.groupsRWL.Lock()
+	defer s.groupsRWL.Unlock()
+
+	// Check to see if the group snapshot already exists.
+	for _, g := range s.groups {
+		if !strings.EqualFold(g.name, req.Name) {
+			continue
+		}
+		if !sameIDs(groupSourceVolumeIDs(g.group), req.SourceVolumeIds) {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"%s: exists with different source volumes", req.Name)
+		}
+		return &csi.CreateVolumeGroupSnapshotResponse{
+			GroupSnapshot: copyGroupSnapshot(g.group),
+		}, nil
+	}
+
+	s.volsRWL.RLock()
+	defer s.volsRWL.RUnlock()
+
+	var (
+		id  = fmt.Sprintf("%d", atomic.AddUint64(&s.groupsNID, 1))
+		now = ptypes.TimestampNow()
+		g   = csi.VolumeGroupSnapshot{
+			GroupSnapshotId: id,
+			CreationTime:    now,
+			ReadyToUse:      true,
+		}
+	)
+	for _, volID := range req.SourceVolumeIds {
+		i, v := s.findVolNoLock("id", volID)
+		if i < 0 {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"%s: source volume not found", volID)
+		}
+		g.Snapshots = append(g.Snapshots, &csi.Snapshot{
+			// The snapshot ID is "<group-snapshot-id>:<volume-id>".
+			SnapshotId:      id + ":" + v.VolumeId,
+			SourceVolumeId:  v.VolumeId,
+			GroupSnapshotId: id,
+			SizeBytes:       v.CapacityBytes,
+			CreationTime:    now,
+			ReadyToUse:      true,
+		})
+	}
+	s.groups[id] = groupSnapshot{name: req.Name, group: g}
+
+	return &csi.CreateVolumeGroupSnapshotResponse{
+		GroupSnapshot: copyGroupSnapshot(g),
+	}, nil
+}
+
+func (s *service) DeleteVolumeGroupSnapshot(
+	ctx context.Context,
+	req *csi.DeleteVolumeGroupSnapshotRequest) (
+	*csi.DeleteVolumeGroupSnapshotResponse, error) {
+
+	s.groupsRWL.Lock()
+	defer s.groupsRWL.Unlock()
+
+	// Deleting a group snapshot that does not exist succeeds.
+	g, ok := s.groups[req.GroupSnapshotId]
+	if !ok {
+		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+	}
+	if !sameIDs(groupSnapshotIDs(g.group), req.SnapshotIds) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"%s: snapshot list mismatch", req.GroupSnapshotId)
+	}
+	delete(s.groups, req.GroupSnapshotId)
+
+	return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+}
+
+func (s *service) GetVolumeGroupSnapshot(
+	ctx context.Context,
+	req *csi.GetVolumeGroupSnapshotRequest) (
+	*csi.GetVolumeGroupSnapshotResponse, error) {
+
+	s.groupsRWL.RLock()
+	defer s.groupsRWL.RUnlock()
+
+	g, ok := s.groups[req.GroupSnapshotId]
+	if !ok {
+		return nil, status.Error(codes.NotFound, req.GroupSnapshotId)
+	}
+	if !sameIDs(groupSnapshotIDs(g.group), req.SnapshotIds) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"%s: snapshot list mismatch", req.GroupSnapshotId)
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{
+		GroupSnapshot: copyGroupSnapshot(g.group),
+	}, nil
+}
+
+// copyGroupSnapshot returns a copy of g whose snapshots may be modified
+// without affecting g.
+func copyGroupSnapshot(g csi.VolumeGroupSnapshot) *csi.VolumeGroupSnapshot {
+	snaps := make([]*csi.Snapshot, len(g.Snapshots))
+	for i, snap := range g.Snapshots {
+		c := *snap
+		snaps[i] = &c
+	}
+	g.Snapshots = snaps
+	return &g
+}
+
+func groupSnapshotIDs(g csi.VolumeGroupSnapshot) []string {
+	ids := make([]string, len(g.Snapshots))
+	for i, snap := range g.Snapshots {
+		ids[i] = snap.SnapshotId
+	}
+	return ids
+}
+
+func groupSourceVolumeIDs(g csi.VolumeGroupSnapshot) []string {
+	ids := make([]string, len(g.Snapshots))
+	for i, snap := range g.Snapshots {
+		ids[i] = snap.SourceVolumeId
+	}
+	return ids
+}
+
+// sameIDs returns a flag indicating whether a and b contain the same IDs,
+// regardless of their order.
+func sameIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
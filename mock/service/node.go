@@ -2,6 +2,7 @@ package service
 
 import (
 	"path"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -51,6 +52,24 @@ func (s *service) NodePublishVolume(
 	// mock mount path if the volume has been published by the node
 	nodeMntPathKey := path.Join(s.nodeID, req.TargetPath)
 
+	// A volume published for a single writer may not be published at
+	// another target path on the node, and a volume already published at
+	// another target path may not be published for a single writer.
+	if k, ok := s.singleWriters[req.VolumeId]; ok && k != nodeMntPathKey {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"%s: published for a single writer", req.VolumeId)
+	}
+	singleWriter := req.GetVolumeCapability().GetAccessMode().GetMode() ==
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+	if singleWriter {
+		for _, k := range s.nodeMntPathKeysNoLock(v) {
+			if k != nodeMntPathKey {
+				return nil, status.Errorf(codes.FailedPrecondition,
+					"%s: published at another target path", req.VolumeId)
+			}
+		}
+	}
+
 	// Check to see if the volume has already been published.
 	if v.VolumeContext[nodeMntPathKey] != "" {
 
@@ -65,7 +84,13 @@ func (s *service) NodePublishVolume(
 
 	// Publish the volume.
 	v.VolumeContext[nodeMntPathKey] = device
+	if g := req.GetVolumeCapability().GetMount().GetVolumeMountGroup(); g != "" {
+		v.VolumeContext[nodeMntPathKey+volMntGroupKeySuffix] = g
+	}
 	s.vols[i] = v
+	if singleWriter {
+		s.singleWriters[req.VolumeId] = nodeMntPathKey
+	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
@@ -94,11 +119,36 @@ func (s *service) NodeUnpublishVolume(
 
 	// Unpublish the volume.
 	delete(v.VolumeContext, nodeMntPathKey)
+	delete(v.VolumeContext, nodeMntPathKey+volMntGroupKeySuffix)
 	s.vols[i] = v
+	if s.singleWriters[req.VolumeId] == nodeMntPathKey {
+		delete(s.singleWriters, req.VolumeId)
+	}
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+// volMntGroupKeySuffix is appended to a mock mount path key to form the
+// key in the volume's attributes that is set to the volume mount group
+// with which the volume was published at the target path.
+const volMntGroupKeySuffix = "#volume_mount_group"
+
+// nodeMntPathKeysNoLock returns the keys of the volume's attributes that
+// are set to the volume's mock mount paths on the node.
+func (s *service) nodeMntPathKeysNoLock(v csi.Volume) []string {
+	var (
+		keys   []string
+		devKey = path.Join(s.nodeID, "dev")
+	)
+	for k := range v.VolumeContext {
+		if strings.HasPrefix(k, s.nodeID+"/") && k != devKey &&
+			!strings.HasSuffix(k, volMntGroupKeySuffix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
 func (s *service) NodeGetInfo(
 	ctx context.Context,
 	req *csi.NodeGetInfoRequest) (
@@ -114,7 +164,38 @@ func (s *service) NodeGetCapabilities(
 	req *csi.NodeGetCapabilitiesRequest) (
 	*csi.NodeGetCapabilitiesResponse, error) {
 
-	return &csi.NodeGetCapabilitiesResponse{}, nil
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+					},
+				},
+			},
+		},
+	}, nil
 }
 
 func (s *service) NodeGetVolumeStats(
@@ -122,13 +203,11 @@ func (s *service) NodeGetVolumeStats(
 	req *csi.NodeGetVolumeStatsRequest) (
 	*csi.NodeGetVolumeStatsResponse, error) {
 
-	var f *csi.Volume
-	for _, v := range s.vols {
-		if v.VolumeId == req.VolumeId {
-			f = &v
-		}
-	}
-	if f == nil {
+	s.volsRWL.RLock()
+	defer s.volsRWL.RUnlock()
+
+	i, f := s.findVolNoLock("id", req.VolumeId)
+	if i < 0 {
 		return nil, status.Errorf(codes.NotFound, "No volume found with id %s", req.VolumeId)
 	}
 
@@ -141,6 +220,7 @@ func (s *service) NodeGetVolumeStats(
 				Unit:      csi.VolumeUsage_BYTES,
 			},
 		},
+		VolumeCondition: s.volumeConditionNoLock(f.VolumeId),
 	}, nil
 }
 
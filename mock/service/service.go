@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -25,27 +28,52 @@ var Manifest = map[string]string{
 	"url": "https://github.com/rexray/gocsi/tree/master/mock",
 }
 
+// AbnormalParam is the CreateVolume parameter that creates a volume whose
+// condition is abnormal. The parameter's value is the condition's message.
+const AbnormalParam = "abnormal"
+
 // Service is the CSI Mock service provider.
 type Service interface {
 	csi.ControllerServer
+	csi.GroupControllerServer
 	csi.IdentityServer
 	csi.NodeServer
+
+	// SetVolumeCondition sets the condition reported for a volume by
+	// ControllerGetVolume, ListVolumes, and NodeGetVolumeStats. A NotFound
+	// error is returned if the volume does not exist.
+	SetVolumeCondition(volumeID string, abnormal bool, message string) error
 }
 
 type service struct {
 	sync.Mutex
 	nodeID   string
 	vols     []csi.Volume
+	conds    map[string]csi.VolumeCondition
 	snaps    []csi.Snapshot
 	volsRWL  sync.RWMutex
 	snapsRWL sync.RWMutex
 	volsNID  uint64
 	snapsNID uint64
+
+	// singleWriters maps the IDs of the volumes published for a single
+	// writer to the keys of their mock mount paths.
+	singleWriters map[string]string
+
+	// groups are the volume group snapshots, keyed by group snapshot ID.
+	groups    map[string]groupSnapshot
+	groupsRWL sync.RWMutex
+	groupsNID uint64
 }
 
 // New returns a new Service.
 func New() Service {
-	s := &service{nodeID: Name}
+	s := &service{
+		nodeID:        Name,
+		conds:         map[string]csi.VolumeCondition{},
+		singleWriters: map[string]string{},
+		groups:        map[string]groupSnapshot{},
+	}
 	s.vols = []csi.Volume{
 		s.newVolume("Mock Volume 1", gib100),
 		s.newVolume("Mock Volume 2", gib100),
@@ -113,3 +141,42 @@ func (s *service) findVolByName(
 
 	return s.findVol("name", name)
 }
+
+func (s *service) SetVolumeCondition(
+	volumeID string, abnormal bool, message string) error {
+
+	s.volsRWL.Lock()
+	defer s.volsRWL.Unlock()
+
+	if i, _ := s.findVolNoLock("id", volumeID); i < 0 {
+		return status.Error(codes.NotFound, volumeID)
+	}
+	s.conds[volumeID] = csi.VolumeCondition{
+		Abnormal: abnormal,
+		Message:  message,
+	}
+	return nil
+}
+
+// volumeConditionNoLock returns the condition of the volume with the
+// given ID. Volumes are healthy unless their condition has been set.
+func (s *service) volumeConditionNoLock(volumeID string) *csi.VolumeCondition {
+	if c, ok := s.conds[volumeID]; ok {
+		return &c
+	}
+	return &csi.VolumeCondition{Message: "volume is healthy"}
+}
+
+// publishedNodeIDs returns the IDs of the nodes to which the volume is
+// controller-published.
+func publishedNodeIDs(v csi.Volume) []string {
+	var nodeIDs []string
+	for k := range v.VolumeContext {
+		if nid := strings.TrimSuffix(k, "/dev"); nid != k &&
+			nid != "" && !strings.Contains(nid, "/") {
+			nodeIDs = append(nodeIDs, nid)
+		}
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
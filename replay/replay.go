@@ -0,0 +1,385 @@
+// Package replay re-issues the calls of a recording made with the
+// recorder middleware against an endpoint, with the recording's original
+// or compressed timing, and diffs the responses against the recorded
+// ones. Volatile fields, such as timestamps and IDs, may be ignored.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	// Registers the CSI messages and services.
+	_ "github.com/container-storage-interface/spec/lib/go/csi"
+
+	"github.com/rexray/gocsi/middleware/recorder"
+)
+
+// DefaultIgnore is the list of the fields ignored when Config.Ignore
+// is nil.
+var DefaultIgnore = []string{
+	"creation_time",
+	"volume_id",
+	"snapshot_id",
+	"group_snapshot_id",
+}
+
+// DefaultTimeout is the timeout of each RPC when Config.Timeout is not set.
+const DefaultTimeout = time.Minute
+
+// Config configures a replay.
+type Config struct {
+	// TimeScale scales the recorded intervals between the calls. A value
+	// of 1 replays the calls with the original timing, 0.5 replays them
+	// twice as fast, and 0 issues them back to back.
+	TimeScale float64
+
+	// Ignore is a list of the response fields that are not compared. A
+	// field name, ex. "creation_time", matches the field at any depth,
+	// and a dotted path, ex. "volume.volume_id", matches the field at
+	// that path. A "*" path element matches any field name. Repeated
+	// fields are matched by their name. DefaultIgnore is used if nil.
+	Ignore []string
+
+	// Secrets replace the redacted secrets of the recorded requests. The
+	// requests are sent with their redacted secrets if nil.
+	Secrets map[string]string
+
+	// Timeout is the timeout of each RPC.
+	Timeout time.Duration
+
+	// Output receives a line for each replayed call and its differences.
+	// Nothing is written if nil.
+	Output io.Writer
+}
+
+// Diff is a difference between a recorded and a replayed response. The
+// gRPC status codes are compared using the path "code".
+type Diff struct {
+	Path     string
+	Recorded interface{}
+	Replayed interface{}
+}
+
+// Result is the result of a single replayed call.
+type Result struct {
+	Index    int
+	Method   string
+	Duration time.Duration
+	Diffs    []Diff
+
+	// Err is set if the call could not be replayed.
+	Err error
+}
+
+// Report is the result of a replay.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns a flag indicating whether any call differed from the
+// recording or could not be replayed.
+func (r *Report) Failed() bool {
+	for _, res := range r.Results {
+		if res.Err != nil || len(res.Diffs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Run replays the recorded entries against the endpoint of conn, in order.
+// An error is returned only if ctx is canceled.
+func Run(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	entries []recorder.Entry,
+	config Config) (*Report, error) {
+
+	if config.Ignore == nil {
+		config.Ignore = DefaultIgnore
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	out := config.Output
+	if out == nil {
+		out = ioutil.Discard
+	}
+
+	var (
+		report = &Report{}
+		issued time.Time
+	)
+	for i, e := range entries {
+		if i > 0 && config.TimeScale > 0 {
+			gap := time.Duration(
+				float64(e.Time.Sub(entries[i-1].Time)) * config.TimeScale)
+			if d := time.Until(issued.Add(gap)); d > 0 {
+				select {
+				case <-ctx.Done():
+					return report, ctx.Err()
+				case <-time.After(d):
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		issued = time.Now()
+		res := replay(ctx, conn, e, config)
+		res.Index = i
+		res.Duration = time.Since(issued)
+		report.Results = append(report.Results, res)
+
+		switch {
+		case res.Err != nil:
+			fmt.Fprintf(out, "FAIL  %s: %v\n", res.Method, res.Err)
+		case len(res.Diffs) > 0:
+			fmt.Fprintf(out, "DIFF  %s\n", res.Method)
+			for _, d := range res.Diffs {
+				fmt.Fprintf(out, "      %s: recorded=%v, replayed=%v\n",
+					d.Path, jsonString(d.Recorded), jsonString(d.Replayed))
+			}
+		default:
+			fmt.Fprintf(out, "ok    %s\n", res.Method)
+		}
+	}
+	return report, nil
+}
+
+func replay(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	e recorder.Entry,
+	config Config) Result {
+
+	res := Result{Method: e.Method}
+
+	req, rep, err := newMessages(e.Method)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if len(e.Request) > 0 {
+		u := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+		if err := u.Unmarshal(bytes.NewReader(e.Request), req); err != nil {
+			res.Err = fmt.Errorf("invalid request: %v", err)
+			return res
+		}
+	}
+	if config.Secrets != nil {
+		setSecrets(req, config.Secrets)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	if md := outgoingMetadata(e.Metadata); len(md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	err = conn.Invoke(ctx, e.Method, req, rep)
+
+	if c := status.Code(err); c != e.Code {
+		res.Diffs = append(res.Diffs, Diff{
+			Path:     "code",
+			Recorded: e.Code.String(),
+			Replayed: c.String(),
+		})
+		return res
+	}
+	if err != nil {
+		return res
+	}
+
+	var recorded, replayed interface{}
+	if len(e.Response) > 0 {
+		if err := json.Unmarshal(e.Response, &recorded); err != nil {
+			res.Err = fmt.Errorf("invalid response: %v", err)
+			return res
+		}
+	}
+	buf, err := recorder.Marshal(rep)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if err := json.Unmarshal(buf, &replayed); err != nil {
+		res.Err = err
+		return res
+	}
+	if recorded == nil {
+		recorded = map[string]interface{}{}
+	}
+	compare(config.Ignore, "", nil, recorded, replayed, &res.Diffs)
+	return res
+}
+
+// newMessages returns new request and response messages for the given
+// full gRPC method name.
+func newMessages(method string) (req, rep proto.Message, err error) {
+	i := strings.LastIndex(method, "/")
+	if i <= 0 {
+		return nil, nil, fmt.Errorf("invalid method: %s", method)
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(
+		protoreflect.FullName(strings.TrimPrefix(method[:i], "/")))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown service: %s", method)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown service: %s", method)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method[i+1:]))
+	if md == nil {
+		return nil, nil, fmt.Errorf("unknown method: %s", method)
+	}
+	if req, err = newMessage(md.Input().FullName()); err != nil {
+		return nil, nil, err
+	}
+	if rep, err = newMessage(md.Output().FullName()); err != nil {
+		return nil, nil, err
+	}
+	return req, rep, nil
+}
+
+func newMessage(name protoreflect.FullName) (proto.Message, error) {
+	t := proto.MessageType(string(name))
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("unknown message: %s", name)
+	}
+	return reflect.New(t.Elem()).Interface().(proto.Message), nil
+}
+
+// setSecrets sets the Secrets field of req, if any.
+func setSecrets(req proto.Message, secrets map[string]string) {
+	f := reflect.ValueOf(req).Elem().FieldByName("Secrets")
+	if f.IsValid() && f.Kind() == reflect.Map && f.Len() > 0 {
+		f.Set(reflect.ValueOf(secrets))
+	}
+}
+
+// outgoingMetadata returns the recorded metadata that may be sent with
+// the replayed call.
+func outgoingMetadata(recorded map[string][]string) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range recorded {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") ||
+			k == "content-type" || k == "user-agent" ||
+			recorder.RedactedMetadata[k] {
+			continue
+		}
+		md[k] = v
+	}
+	return md
+}
+
+// compare appends the differences between a and b to diffs. The path is
+// the location of a and b, and the names are the field names of the path
+// without the indices of repeated fields.
+func compare(
+	ignore []string,
+	path string,
+	names []string,
+	a, b interface{},
+	diffs *[]Diff) {
+
+	switch ta := a.(type) {
+	case map[string]interface{}:
+		tb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range ta {
+			keys[k] = true
+		}
+		for k := range tb {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			knames := append(names[:len(names):len(names)], k)
+			if ignored(ignore, knames) {
+				continue
+			}
+			kpath := k
+			if path != "" {
+				kpath = path + "." + k
+			}
+			compare(ignore, kpath, knames, ta[k], tb[k], diffs)
+		}
+		return
+	case []interface{}:
+		tb, ok := b.([]interface{})
+		if !ok || len(ta) != len(tb) {
+			break
+		}
+		for i := range ta {
+			compare(ignore, fmt.Sprintf("%s[%d]", path, i), names,
+				ta[i], tb[i], diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, Diff{Path: path, Recorded: a, Replayed: b})
+	}
+}
+
+func ignored(ignore []string, names []string) bool {
+	for _, p := range ignore {
+		segs := strings.Split(p, ".")
+		if len(segs) == 1 {
+			if names[len(names)-1] == p {
+				return true
+			}
+			continue
+		}
+		if len(segs) != len(names) {
+			continue
+		}
+		match := true
+		for i, s := range segs {
+			if s != "*" && s != names[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonString(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(buf)
+}
@@ -0,0 +1,151 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akutz/memconn"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	"github.com/rexray/gocsi"
+	"github.com/rexray/gocsi/middleware/recorder"
+	"github.com/rexray/gocsi/mock/provider"
+	"github.com/rexray/gocsi/replay"
+)
+
+// startMock starts the mock SP with the given environment variables.
+func startMock(
+	t *testing.T, name string, env ...string) (*grpc.ClientConn, func()) {
+
+	ctx := context.Background()
+	addr := fmt.Sprintf("csi-replay-%s-%s", t.Name(), name)
+
+	sp := provider.New().(*gocsi.StoragePlugin)
+	sp.EnvVars = append(sp.EnvVars, env...)
+	lis, err := memconn.Listen("memu", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sp.Serve(ctx, lis)
+
+	conn, err := grpc.DialContext(ctx, "",
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return memconn.Dial("memu", addr)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		sp.GracefulStop(ctx)
+	}
+}
+
+// record records calls made to the mock SP and returns the recording.
+func record(t *testing.T, path string) []recorder.Entry {
+	conn, stop := startMock(t, "record", gocsi.EnvVarRecordFile+"="+path)
+
+	ctx := context.Background()
+	controller := csi.NewControllerClient(conn)
+	if _, err := controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: "replayed",
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+		}},
+		Secrets: map[string]string{"password": "hunter2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := controller.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		Name:           "replayed",
+		SourceVolumeId: "1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// A call that fails is recorded with its status code.
+	controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{})
+	stop()
+
+	entries, err := recorder.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := record(t, filepath.Join(dir, "recording.jsonl"))
+	if len(entries) != 3 {
+		t.Fatalf("entries=%d", len(entries))
+	}
+	if bytes.Contains(entries[0].Request, []byte("hunter2")) {
+		t.Fatalf("request=%s", entries[0].Request)
+	}
+
+	conn, stop := startMock(t, "replay")
+	defer stop()
+
+	// The snapshot's creation time is ignored by default.
+	var out bytes.Buffer
+	report, err := replay.Run(context.Background(), conn, entries,
+		replay.Config{Output: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed() {
+		t.Fatalf("replay failed:\n%s", out.String())
+	}
+
+	// The creation time differs when every field is compared.
+	report, err = replay.Run(context.Background(), conn, entries,
+		replay.Config{Ignore: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs := report.Results[1].Diffs
+	if len(diffs) == 0 || diffs[0].Path != "snapshot.creation_time" {
+		t.Fatalf("diffs=%+v", diffs)
+	}
+}
+
+func TestReplay_Timing(t *testing.T) {
+	now := time.Now()
+	entries := []recorder.Entry{
+		{Time: now, Method: "/csi.v1.Identity/Probe", Response: []byte("{}")},
+		{Time: now.Add(200 * time.Millisecond),
+			Method: "/csi.v1.Identity/Probe", Response: []byte("{}")},
+	}
+
+	conn, stop := startMock(t, "replay")
+	defer stop()
+
+	start := time.Now()
+	if _, err := replay.Run(context.Background(), conn, entries,
+		replay.Config{TimeScale: 0.25}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond ||
+		d >= 200*time.Millisecond {
+		t.Fatalf("duration=%v", d)
+	}
+}
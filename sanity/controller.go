@@ -0,0 +1,610 @@
+package sanity
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var controllerTests = []test{
+	{"Controller/GetCapabilities", testControllerGetCapabilities},
+	{"Controller/Capabilities", testControllerCapabilities},
+	{"Controller/CreateVolume/Idempotent", testCreateVolumeIdempotent},
+	{"Controller/DeleteVolume/Idempotent", testDeleteVolumeIdempotent},
+	{"Controller/DeleteVolume/NotFound", testDeleteVolumeNotFound},
+	{"Controller/PublishVolume/Idempotent", testControllerPublishIdempotent},
+	{"Controller/PublishVolume/NotFound", testControllerPublishNotFound},
+	{"Controller/UnpublishVolume/Idempotent", testControllerUnpublishIdempotent},
+	{"Controller/UnpublishVolume/NotFound", testControllerUnpublishNotFound},
+	{"Controller/ValidateVolumeCapabilities/NotFound", testValidateVolumeCapabilitiesNotFound},
+	{"Controller/ListVolumes/Pagination", testListVolumesPagination},
+	{"Controller/ListVolumes/InvalidToken", testListVolumesInvalidToken},
+	{"Controller/GetCapacity", testGetCapacity},
+	{"Controller/CreateSnapshot/Idempotent", testCreateSnapshotIdempotent},
+	{"Controller/DeleteSnapshot/Idempotent", testDeleteSnapshotIdempotent},
+	{"Controller/DeleteSnapshot/NotFound", testDeleteSnapshotNotFound},
+	{"Controller/ListSnapshots/Pagination", testListSnapshotsPagination},
+	{"Controller/ListSnapshots/InvalidToken", testListSnapshotsInvalidToken},
+	{"Controller/ExpandVolume/Idempotent", testControllerExpandIdempotent},
+	{"Controller/ExpandVolume/NotFound", testControllerExpandNotFound},
+	{"Controller/GetVolume", testControllerGetVolume},
+	{"Controller/GetVolume/NotFound", testControllerGetVolumeNotFound},
+}
+
+func testControllerGetCapabilities(t *T) {
+	t.requireController()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.ControllerGetCapabilities(
+		ctx, &csi.ControllerGetCapabilitiesRequest{})
+	t.noError("ControllerGetCapabilities", err)
+	for i, c := range rep.Capabilities {
+		if c.GetRpc() == nil {
+			t.Errorf("ControllerGetCapabilities: capabilities[%d] has no type", i)
+		}
+	}
+}
+
+// capabilityCheck is an RPC that is implemented only by a plug-in that
+// advertises a capability. The RPC is invoked with an unknown ID so that
+// nothing is created.
+type capabilityCheck struct {
+	cap  string
+	has  bool
+	rpc  string
+	call func(ctx context.Context) error
+}
+
+// checkCapabilities fails the test if an RPC is unimplemented although
+// its capability is advertised. An RPC that is implemented although its
+// capability is not advertised is noted in the test's output; the spec
+// does not prohibit it, but a CO will not invoke it.
+func checkCapabilities(t *T, checks []capabilityCheck) {
+	for _, c := range checks {
+		ctx, cancel := t.rpcContext()
+		err := c.call(ctx)
+		cancel()
+		unimpl := status.Code(err) == codes.Unimplemented
+		switch {
+		case c.has && unimpl:
+			t.Errorf("%s: unimplemented, but capability %s is advertised",
+				c.rpc, c.cap)
+		case !c.has && !unimpl:
+			t.Logf("%s: implemented, but capability %s is not advertised",
+				c.rpc, c.cap)
+		}
+	}
+}
+
+func testControllerCapabilities(t *T) {
+	t.requireController()
+
+	var (
+		id     = t.unknownID()
+		nodeID = t.s.nodeID
+		caps   = t.s.ctrlrCaps
+		sec    = t.s.config.Secrets
+		cli    = t.s.controller
+	)
+	if nodeID == "" {
+		nodeID = t.unknownID()
+	}
+	check := func(
+		c csi.ControllerServiceCapability_RPC_Type,
+		rpc string,
+		call func(ctx context.Context) error) capabilityCheck {
+
+		return capabilityCheck{cap: c.String(), has: caps[c], rpc: rpc, call: call}
+	}
+
+	checkCapabilities(t, []capabilityCheck{
+		check(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+			"DeleteVolume", func(ctx context.Context) error {
+				_, err := cli.DeleteVolume(ctx, &csi.DeleteVolumeRequest{
+					VolumeId: id, Secrets: sec})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+			"ControllerUnpublishVolume", func(ctx context.Context) error {
+				_, err := cli.ControllerUnpublishVolume(ctx,
+					&csi.ControllerUnpublishVolumeRequest{
+						VolumeId: id, NodeId: nodeID, Secrets: sec})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+			"ListVolumes", func(ctx context.Context) error {
+				_, err := cli.ListVolumes(ctx, &csi.ListVolumesRequest{})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+			"GetCapacity", func(ctx context.Context) error {
+				_, err := cli.GetCapacity(ctx, &csi.GetCapacityRequest{})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+			"DeleteSnapshot", func(ctx context.Context) error {
+				_, err := cli.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{
+					SnapshotId: id, Secrets: sec})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+			"ListSnapshots", func(ctx context.Context) error {
+				_, err := cli.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+			"ControllerExpandVolume", func(ctx context.Context) error {
+				_, err := cli.ControllerExpandVolume(ctx,
+					&csi.ControllerExpandVolumeRequest{
+						VolumeId: id,
+						CapacityRange: &csi.CapacityRange{
+							RequiredBytes: t.s.config.CapacityBytes,
+						},
+						Secrets: sec,
+					})
+				return err
+			}),
+		check(csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			"ControllerGetVolume", func(ctx context.Context) error {
+				_, err := cli.ControllerGetVolume(ctx,
+					&csi.ControllerGetVolumeRequest{VolumeId: id})
+				return err
+			}),
+	})
+}
+
+func testCreateVolumeIdempotent(t *T) {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME)
+
+	req := t.createVolumeRequest()
+	var ids []string
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		rep, err := t.s.controller.CreateVolume(ctx, req)
+		cancel()
+		t.noError("CreateVolume", err)
+		if rep.Volume == nil || rep.Volume.VolumeId == "" {
+			t.Fatalf("CreateVolume: response missing volume ID")
+		}
+		if i == 0 {
+			t.deleteVolumeOnCleanup(rep.Volume.VolumeId)
+		}
+		ids = append(ids, rep.Volume.VolumeId)
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("CreateVolume: name %q created volumes %q and %q",
+			req.Name, ids[0], ids[1])
+	}
+}
+
+func testDeleteVolumeIdempotent(t *T) {
+	vol := t.createVolume()
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		_, err := t.s.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{
+			VolumeId: vol.VolumeId,
+			Secrets:  t.s.config.Secrets,
+		})
+		cancel()
+		t.noError("DeleteVolume", err)
+	}
+}
+
+func testDeleteVolumeNotFound(t *T) {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME)
+
+	// Deleting a volume that does not exist succeeds.
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{
+		VolumeId: t.unknownID(),
+		Secrets:  t.s.config.Secrets,
+	})
+	t.noError("DeleteVolume", err)
+}
+
+func requireControllerPublish(t *T) {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME)
+	t.requireNode()
+}
+
+func testControllerPublishIdempotent(t *T) {
+	requireControllerPublish(t)
+	vol := t.createVolume()
+
+	pubCtx := t.controllerPublish(vol.VolumeId)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.ControllerPublishVolume(
+		ctx, t.controllerPublishRequest(vol.VolumeId))
+	t.noError("ControllerPublishVolume", err)
+	if len(pubCtx) > 0 || len(rep.PublishContext) > 0 {
+		if !reflect.DeepEqual(pubCtx, rep.PublishContext) {
+			t.Fatalf("ControllerPublishVolume: publish context %v != %v",
+				rep.PublishContext, pubCtx)
+		}
+	}
+}
+
+func testControllerPublishNotFound(t *T) {
+	requireControllerPublish(t)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ControllerPublishVolume(
+		ctx, t.controllerPublishRequest(t.unknownID()))
+	t.expectCode("ControllerPublishVolume", err, codes.NotFound)
+}
+
+func testControllerUnpublishIdempotent(t *T) {
+	requireControllerPublish(t)
+	vol := t.createVolume()
+	t.controllerPublish(vol.VolumeId)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		_, err := t.s.controller.ControllerUnpublishVolume(ctx,
+			&csi.ControllerUnpublishVolumeRequest{
+				VolumeId: vol.VolumeId,
+				NodeId:   t.s.nodeID,
+				Secrets:  t.s.config.Secrets,
+			})
+		cancel()
+		t.noError("ControllerUnpublishVolume", err)
+	}
+}
+
+func testControllerUnpublishNotFound(t *T) {
+	requireControllerPublish(t)
+
+	// A plug-in may assume a volume that does not exist is unpublished.
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ControllerUnpublishVolume(ctx,
+		&csi.ControllerUnpublishVolumeRequest{
+			VolumeId: t.unknownID(),
+			NodeId:   t.s.nodeID,
+			Secrets:  t.s.config.Secrets,
+		})
+	t.expectCode("ControllerUnpublishVolume", err, codes.OK, codes.NotFound)
+}
+
+func testValidateVolumeCapabilitiesNotFound(t *T) {
+	t.requireController()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ValidateVolumeCapabilities(ctx,
+		&csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           t.unknownID(),
+			VolumeCapabilities: []*csi.VolumeCapability{t.volumeCapability()},
+			Secrets:            t.s.config.Secrets,
+		})
+	t.expectCode("ValidateVolumeCapabilities", err, codes.NotFound)
+}
+
+// paginationVolumes is the number of volumes or snapshots created by the
+// pagination tests so that there is more than one page.
+const paginationVolumes = 3
+
+// maxPages bounds the number of pages read by the pagination tests in
+// case a plug-in always returns a next token.
+const maxPages = 10000
+
+// listVolumes returns the IDs of the volumes returned by ListVolumes in
+// pages of max entries.
+func listVolumes(t *T, max int32) []string {
+	var (
+		ids   []string
+		token string
+	)
+	for page := 0; page < maxPages; page++ {
+		ctx, cancel := t.rpcContext()
+		rep, err := t.s.controller.ListVolumes(ctx, &csi.ListVolumesRequest{
+			MaxEntries:    max,
+			StartingToken: token,
+		})
+		cancel()
+		t.noError("ListVolumes", err)
+		if max > 0 && int32(len(rep.Entries)) > max {
+			t.Fatalf("ListVolumes: %d entries > max_entries=%d",
+				len(rep.Entries), max)
+		}
+		for _, e := range rep.Entries {
+			if e.Volume == nil {
+				t.Fatalf("ListVolumes: entry missing volume")
+			}
+			ids = append(ids, e.Volume.VolumeId)
+		}
+		if rep.NextToken == "" {
+			return ids
+		}
+		if rep.NextToken == token {
+			t.Fatalf("ListVolumes: next token %q repeats the starting token",
+				token)
+		}
+		token = rep.NextToken
+	}
+	t.Fatalf("ListVolumes: more than %d pages", maxPages)
+	return nil
+}
+
+// checkPages fails the test if the IDs read in pages differ from those
+// read at once or do not include the IDs the test created.
+func checkPages(t *T, rpc string, all, paged, created []string) {
+	seen := map[string]bool{}
+	for _, id := range paged {
+		if seen[id] {
+			t.Errorf("%s: %q returned more than once", rpc, id)
+		}
+		seen[id] = true
+	}
+	for _, id := range all {
+		if !seen[id] {
+			t.Errorf("%s: %q missing from paginated results", rpc, id)
+		}
+	}
+	if len(paged) != len(all) {
+		t.Errorf("%s: %d paginated results, expected %d",
+			rpc, len(paged), len(all))
+	}
+	for _, id := range created {
+		if !seen[id] {
+			t.Errorf("%s: created %q missing from results", rpc, id)
+		}
+	}
+}
+
+func testListVolumesPagination(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_LIST_VOLUMES)
+
+	var created []string
+	if t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME] {
+		for i := 0; i < paginationVolumes; i++ {
+			created = append(created, t.createVolume().VolumeId)
+		}
+	}
+
+	all := listVolumes(t, 0)
+	if len(all) < 2 {
+		t.Skipf("ListVolumes: fewer than two volumes to paginate")
+	}
+	checkPages(t, "ListVolumes", all, listVolumes(t, 1), created)
+}
+
+func testListVolumesInvalidToken(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_LIST_VOLUMES)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ListVolumes(ctx, &csi.ListVolumesRequest{
+		StartingToken: t.unknownID(),
+	})
+	t.expectCode("ListVolumes", err, codes.Aborted)
+}
+
+func testGetCapacity(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.GetCapacity(ctx, &csi.GetCapacityRequest{
+		VolumeCapabilities: []*csi.VolumeCapability{t.volumeCapability()},
+		Parameters:         t.s.config.Parameters,
+	})
+	t.noError("GetCapacity", err)
+	if rep.AvailableCapacity < 0 {
+		t.Errorf("GetCapacity: available capacity %d < 0",
+			rep.AvailableCapacity)
+	}
+}
+
+func testCreateSnapshotIdempotent(t *T) {
+	vol := t.createVolume()
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT)
+
+	req := t.createSnapshotRequest(vol.VolumeId)
+	var ids []string
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		rep, err := t.s.controller.CreateSnapshot(ctx, req)
+		cancel()
+		t.noError("CreateSnapshot", err)
+		if rep.Snapshot == nil || rep.Snapshot.SnapshotId == "" {
+			t.Fatalf("CreateSnapshot: response missing snapshot ID")
+		}
+		if i == 0 {
+			t.deleteSnapshotOnCleanup(rep.Snapshot.SnapshotId)
+		}
+		ids = append(ids, rep.Snapshot.SnapshotId)
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("CreateSnapshot: name %q created snapshots %q and %q",
+			req.Name, ids[0], ids[1])
+	}
+}
+
+func testDeleteSnapshotIdempotent(t *T) {
+	snap := t.createSnapshot(t.createVolume().VolumeId)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		_, err := t.s.controller.DeleteSnapshot(ctx,
+			&csi.DeleteSnapshotRequest{
+				SnapshotId: snap.SnapshotId,
+				Secrets:    t.s.config.Secrets,
+			})
+		cancel()
+		t.noError("DeleteSnapshot", err)
+	}
+}
+
+func testDeleteSnapshotNotFound(t *T) {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT)
+
+	// Deleting a snapshot that does not exist succeeds.
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{
+		SnapshotId: t.unknownID(),
+		Secrets:    t.s.config.Secrets,
+	})
+	t.noError("DeleteSnapshot", err)
+}
+
+// listSnapshots returns the IDs of the snapshots returned by
+// ListSnapshots in pages of max entries.
+func listSnapshots(t *T, max int32) []string {
+	var (
+		ids   []string
+		token string
+	)
+	for page := 0; page < maxPages; page++ {
+		ctx, cancel := t.rpcContext()
+		rep, err := t.s.controller.ListSnapshots(ctx,
+			&csi.ListSnapshotsRequest{
+				MaxEntries:    max,
+				StartingToken: token,
+			})
+		cancel()
+		t.noError("ListSnapshots", err)
+		if max > 0 && int32(len(rep.Entries)) > max {
+			t.Fatalf("ListSnapshots: %d entries > max_entries=%d",
+				len(rep.Entries), max)
+		}
+		for _, e := range rep.Entries {
+			if e.Snapshot == nil {
+				t.Fatalf("ListSnapshots: entry missing snapshot")
+			}
+			ids = append(ids, e.Snapshot.SnapshotId)
+		}
+		if rep.NextToken == "" {
+			return ids
+		}
+		if rep.NextToken == token {
+			t.Fatalf("ListSnapshots: next token %q repeats the starting token",
+				token)
+		}
+		token = rep.NextToken
+	}
+	t.Fatalf("ListSnapshots: more than %d pages", maxPages)
+	return nil
+}
+
+func testListSnapshotsPagination(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+
+	var created []string
+	if t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT] &&
+		t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME] {
+		vol := t.createVolume()
+		for i := 0; i < paginationVolumes; i++ {
+			created = append(created, t.createSnapshot(vol.VolumeId).SnapshotId)
+		}
+	}
+
+	all := listSnapshots(t, 0)
+	if len(all) < 2 {
+		t.Skipf("ListSnapshots: fewer than two snapshots to paginate")
+	}
+	checkPages(t, "ListSnapshots", all, listSnapshots(t, 1), created)
+}
+
+func testListSnapshotsInvalidToken(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ListSnapshots(ctx, &csi.ListSnapshotsRequest{
+		StartingToken: t.unknownID(),
+	})
+	t.expectCode("ListSnapshots", err, codes.Aborted)
+}
+
+func testControllerExpandIdempotent(t *T) {
+	vol := t.createVolume()
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME)
+
+	size := vol.CapacityBytes
+	if size <= 0 {
+		size = t.s.config.CapacityBytes
+	}
+	req := &csi.ControllerExpandVolumeRequest{
+		VolumeId:      vol.VolumeId,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: size * 2},
+		Secrets:       t.s.config.Secrets,
+	}
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		rep, err := t.s.controller.ControllerExpandVolume(ctx, req)
+		cancel()
+		t.noError("ControllerExpandVolume", err)
+		if rep.CapacityBytes < req.CapacityRange.RequiredBytes {
+			t.Fatalf("ControllerExpandVolume: capacity %d < required %d",
+				rep.CapacityBytes, req.CapacityRange.RequiredBytes)
+		}
+	}
+}
+
+func testControllerExpandNotFound(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ControllerExpandVolume(ctx,
+		&csi.ControllerExpandVolumeRequest{
+			VolumeId: t.unknownID(),
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: t.s.config.CapacityBytes,
+			},
+			Secrets: t.s.config.Secrets,
+		})
+	t.expectCode("ControllerExpandVolume", err, codes.NotFound)
+}
+
+func testControllerGetVolume(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_GET_VOLUME)
+	vol := t.createVolume()
+	t.controllerPublish(vol.VolumeId)
+
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.ControllerGetVolume(ctx,
+		&csi.ControllerGetVolumeRequest{VolumeId: vol.VolumeId})
+	t.noError("ControllerGetVolume", err)
+	if id := rep.GetVolume().GetVolumeId(); id != vol.VolumeId {
+		t.Errorf("ControllerGetVolume: volume ID=%q, expected %q",
+			id, vol.VolumeId)
+	}
+	if rep.Status == nil {
+		t.Fatalf("ControllerGetVolume: status is nil")
+	}
+	if t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_VOLUME_CONDITION] &&
+		rep.Status.VolumeCondition == nil {
+		t.Errorf("ControllerGetVolume: volume condition is nil")
+	}
+	// The volume is published to the node if the plug-in has the
+	// capability to do so.
+	if t.s.nodeID != "" && t.s.ctrlrCaps[csi.
+		ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES] {
+
+		var found bool
+		for _, id := range rep.Status.PublishedNodeIds {
+			found = found || id == t.s.nodeID
+		}
+		if !found {
+			t.Errorf("ControllerGetVolume: published node IDs=%v, "+
+				"expected %q", rep.Status.PublishedNodeIds, t.s.nodeID)
+		}
+	}
+}
+
+func testControllerGetVolumeNotFound(t *T) {
+	t.requireControllerCap(csi.ControllerServiceCapability_RPC_GET_VOLUME)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.controller.ControllerGetVolume(ctx,
+		&csi.ControllerGetVolumeRequest{VolumeId: t.unknownID()})
+	t.expectCode("ControllerGetVolume", err, codes.NotFound)
+}
@@ -0,0 +1,44 @@
+package sanity
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var identityTests = []test{
+	{"Identity/GetPluginInfo", testGetPluginInfo},
+	{"Identity/GetPluginCapabilities", testGetPluginCapabilities},
+	{"Identity/Probe", testProbe},
+}
+
+func testGetPluginInfo(t *T) {
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.identity.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	t.noError("GetPluginInfo", err)
+	if rep.Name == "" {
+		t.Errorf("GetPluginInfo: name is empty")
+	}
+	if rep.VendorVersion == "" {
+		t.Errorf("GetPluginInfo: vendor version is empty")
+	}
+}
+
+func testGetPluginCapabilities(t *T) {
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.identity.GetPluginCapabilities(
+		ctx, &csi.GetPluginCapabilitiesRequest{})
+	t.noError("GetPluginCapabilities", err)
+	for i, c := range rep.Capabilities {
+		if c.Type == nil {
+			t.Errorf("GetPluginCapabilities: capabilities[%d] has no type", i)
+		}
+	}
+}
+
+func testProbe(t *T) {
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.identity.Probe(ctx, &csi.ProbeRequest{})
+	t.noError("Probe", err)
+}
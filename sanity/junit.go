@@ -0,0 +1,78 @@
+package sanity
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes the report to w as JUnit XML. The first element of a
+// test's name, e.g. "Controller", is used as the test case's class name.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	_, failed, skipped := r.Counts()
+	ts := junitTestSuite{
+		Name:     "csi-sanity",
+		Tests:    len(r.Results),
+		Failures: failed,
+		Skipped:  skipped,
+		Time:     junitTime(r.Duration),
+	}
+	for _, res := range r.Results {
+		tc := junitTestCase{
+			Name:      res.Name,
+			ClassName: strings.SplitN(res.Name, "/", 2)[0],
+			Time:      junitTime(res.Duration),
+		}
+		out := strings.Join(res.Output, "\n")
+		switch {
+		case res.Failed:
+			tc.Failure = &junitMessage{Message: "failed", Text: out}
+		case res.Skipped:
+			tc.Skipped = &junitMessage{Message: "skipped", Text: out}
+		default:
+			tc.SystemOut = out
+		}
+		ts.Cases = append(ts.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(ts); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,251 @@
+package sanity
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+)
+
+var nodeTests = []test{
+	{"Node/GetInfo", testNodeGetInfo},
+	{"Node/GetCapabilities", testNodeGetCapabilities},
+	{"Node/Capabilities", testNodeCapabilities},
+	{"Node/StageVolume/Idempotent", testNodeStageIdempotent},
+	{"Node/UnstageVolume/Idempotent", testNodeUnstageIdempotent},
+	{"Node/UnstageVolume/NotFound", testNodeUnstageNotFound},
+	{"Node/PublishVolume/Idempotent", testNodePublishIdempotent},
+	{"Node/PublishVolume/NotFound", testNodePublishNotFound},
+	{"Node/UnpublishVolume/Idempotent", testNodeUnpublishIdempotent},
+	{"Node/UnpublishVolume/NotFound", testNodeUnpublishNotFound},
+	{"Node/GetVolumeStats", testNodeGetVolumeStats},
+	{"Node/GetVolumeStats/NotFound", testNodeGetVolumeStatsNotFound},
+	{"Node/ExpandVolume/NotFound", testNodeExpandNotFound},
+}
+
+func testNodeGetInfo(t *T) {
+	t.requireNode()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.node.NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+	t.noError("NodeGetInfo", err)
+	if rep.NodeId == "" {
+		t.Errorf("NodeGetInfo: node ID is empty")
+	}
+}
+
+func testNodeGetCapabilities(t *T) {
+	t.requireNode()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.node.NodeGetCapabilities(
+		ctx, &csi.NodeGetCapabilitiesRequest{})
+	t.noError("NodeGetCapabilities", err)
+	for i, c := range rep.Capabilities {
+		if c.GetRpc() == nil {
+			t.Errorf("NodeGetCapabilities: capabilities[%d] has no type", i)
+		}
+	}
+}
+
+func testNodeCapabilities(t *T) {
+	t.requireNode()
+
+	var (
+		id   = t.unknownID()
+		path = t.stagingPath()
+		caps = t.s.nodeCaps
+		cli  = t.s.node
+	)
+	check := func(
+		c csi.NodeServiceCapability_RPC_Type,
+		rpc string,
+		call func(ctx context.Context) error) capabilityCheck {
+
+		return capabilityCheck{cap: c.String(), has: caps[c], rpc: rpc, call: call}
+	}
+
+	checkCapabilities(t, []capabilityCheck{
+		check(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+			"NodeUnstageVolume", func(ctx context.Context) error {
+				_, err := cli.NodeUnstageVolume(ctx,
+					&csi.NodeUnstageVolumeRequest{
+						VolumeId: id, StagingTargetPath: path})
+				return err
+			}),
+		check(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+			"NodeGetVolumeStats", func(ctx context.Context) error {
+				_, err := cli.NodeGetVolumeStats(ctx,
+					&csi.NodeGetVolumeStatsRequest{
+						VolumeId: id, VolumePath: path})
+				return err
+			}),
+		check(csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+			"NodeExpandVolume", func(ctx context.Context) error {
+				_, err := cli.NodeExpandVolume(ctx,
+					&csi.NodeExpandVolumeRequest{
+						VolumeId: id, VolumePath: path})
+				return err
+			}),
+	})
+}
+
+// prepareNode creates a volume and, if the plug-in has the capabilities
+// to do so, controller-publishes it to the node. The node service is
+// required.
+func prepareNode(t *T) (*csi.Volume, map[string]string) {
+	t.requireNode()
+	vol := t.createVolume()
+	return vol, t.controllerPublish(vol.VolumeId)
+}
+
+func testNodeStageIdempotent(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)
+	vol, pubCtx := prepareNode(t)
+
+	path := t.nodeStage(vol, pubCtx)
+	req := t.nodeStageRequest(vol, pubCtx)
+	req.StagingTargetPath = path
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeStageVolume(ctx, req)
+	t.noError("NodeStageVolume", err)
+}
+
+func testNodeUnstageIdempotent(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)
+	vol, pubCtx := prepareNode(t)
+
+	path := t.nodeStage(vol, pubCtx)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		_, err := t.s.node.NodeUnstageVolume(ctx,
+			&csi.NodeUnstageVolumeRequest{
+				VolumeId:          vol.VolumeId,
+				StagingTargetPath: path,
+			})
+		cancel()
+		t.noError("NodeUnstageVolume", err)
+	}
+}
+
+func testNodeUnstageNotFound(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+		VolumeId:          t.unknownID(),
+		StagingTargetPath: t.stagingPath(),
+	})
+	t.expectCode("NodeUnstageVolume", err, codes.NotFound)
+}
+
+func testNodePublishIdempotent(t *T) {
+	vol, pubCtx := prepareNode(t)
+	stagingPath := t.nodeStage(vol, pubCtx)
+
+	path := t.nodePublish(vol, pubCtx, stagingPath)
+	req := t.nodePublishRequest(vol, pubCtx, stagingPath)
+	req.TargetPath = path
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodePublishVolume(ctx, req)
+	t.noError("NodePublishVolume", err)
+}
+
+func testNodePublishNotFound(t *T) {
+	t.requireNode()
+
+	// A plug-in may require the publish context before it looks up the
+	// volume, so the context of a volume that does exist is used.
+	var (
+		pubCtx      map[string]string
+		stagingPath string
+	)
+	if t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME] {
+		vol, c := prepareNode(t)
+		pubCtx = c
+		stagingPath = t.nodeStage(vol, pubCtx)
+	}
+
+	req := t.nodePublishRequest(
+		&csi.Volume{VolumeId: t.unknownID()}, pubCtx, stagingPath)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodePublishVolume(ctx, req)
+	t.expectCode("NodePublishVolume", err, codes.NotFound)
+}
+
+func testNodeUnpublishIdempotent(t *T) {
+	vol, pubCtx := prepareNode(t)
+	stagingPath := t.nodeStage(vol, pubCtx)
+
+	path := t.nodePublish(vol, pubCtx, stagingPath)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := t.rpcContext()
+		_, err := t.s.node.NodeUnpublishVolume(ctx,
+			&csi.NodeUnpublishVolumeRequest{
+				VolumeId:   vol.VolumeId,
+				TargetPath: path,
+			})
+		cancel()
+		t.noError("NodeUnpublishVolume", err)
+	}
+}
+
+func testNodeUnpublishNotFound(t *T) {
+	t.requireNode()
+	id := t.unknownID()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeUnpublishVolume(ctx,
+		&csi.NodeUnpublishVolumeRequest{
+			VolumeId:   id,
+			TargetPath: t.targetPath(id),
+		})
+	t.expectCode("NodeUnpublishVolume", err, codes.NotFound)
+}
+
+func testNodeGetVolumeStats(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS)
+	vol, pubCtx := prepareNode(t)
+	stagingPath := t.nodeStage(vol, pubCtx)
+	path := t.nodePublish(vol, pubCtx, stagingPath)
+
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.node.NodeGetVolumeStats(ctx,
+		&csi.NodeGetVolumeStatsRequest{
+			VolumeId:   vol.VolumeId,
+			VolumePath: path,
+		})
+	t.noError("NodeGetVolumeStats", err)
+	if len(rep.Usage) == 0 {
+		t.Errorf("NodeGetVolumeStats: usage is empty")
+	}
+}
+
+func testNodeGetVolumeStatsNotFound(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS)
+	id := t.unknownID()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeGetVolumeStats(ctx,
+		&csi.NodeGetVolumeStatsRequest{
+			VolumeId:   id,
+			VolumePath: t.targetPath(id),
+		})
+	t.expectCode("NodeGetVolumeStats", err, codes.NotFound)
+}
+
+func testNodeExpandNotFound(t *T) {
+	t.requireNodeCap(csi.NodeServiceCapability_RPC_EXPAND_VOLUME)
+	id := t.unknownID()
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeExpandVolume(ctx, &csi.NodeExpandVolumeRequest{
+		VolumeId:   id,
+		VolumePath: t.targetPath(id),
+	})
+	t.expectCode("NodeExpandVolume", err, codes.NotFound)
+}
@@ -0,0 +1,386 @@
+// Package sanity is a CSI conformance suite that may be run against any
+// endpoint. The suite checks the idempotency of the mutating RPCs, the
+// NotFound behavior of RPCs given unknown IDs, the pagination of
+// ListVolumes and ListSnapshots, and that a plug-in's advertised
+// capabilities are consistent with the RPCs it implements. Everything
+// the suite creates is removed when the test that created it completes.
+package sanity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultCapacityBytes is the capacity requested for created volumes when
+// Config.CapacityBytes is not set.
+const DefaultCapacityBytes int64 = 1024 * 1024 * 1024
+
+// DefaultTimeout is the timeout of each RPC when Config.Timeout is not set.
+const DefaultTimeout = time.Minute
+
+// Config configures a run of the suite.
+type Config struct {
+	// Parameters are sent with CreateVolume and CreateSnapshot.
+	Parameters map[string]string
+
+	// Secrets are sent with every RPC that accepts secrets.
+	Secrets map[string]string
+
+	// ScratchDir is the directory beneath which the staging and target
+	// paths are created. The system's temporary directory is used if
+	// empty. The directories the suite creates are removed after the run.
+	ScratchDir string
+
+	// CapacityBytes is the capacity requested for created volumes.
+	CapacityBytes int64
+
+	// NamePrefix is prepended to the names of created volumes and
+	// snapshots. It defaults to "sanity-".
+	NamePrefix string
+
+	// Run selects the tests whose names match. All tests are selected
+	// if nil.
+	Run *regexp.Regexp
+
+	// Skip excludes the tests whose names match.
+	Skip *regexp.Regexp
+
+	// TargetPath returns the target path at which a volume is published.
+	// The returned path's parent directory must exist. If nil, the target
+	// paths are created beneath the scratch directory.
+	TargetPath func(volumeID string) (string, error)
+
+	// Timeout is the timeout of each RPC.
+	Timeout time.Duration
+
+	// Output receives a line for each test result and the messages of
+	// failed and skipped tests. Nothing is written if nil.
+	Output io.Writer
+}
+
+// Result is the result of a single test.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Failed   bool
+	Skipped  bool
+	Output   []string
+}
+
+// Report is the result of a run of the suite.
+type Report struct {
+	Results  []Result
+	Duration time.Duration
+}
+
+// Failed returns a flag indicating whether any test failed.
+func (r *Report) Failed() bool {
+	for _, res := range r.Results {
+		if res.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts returns the number of tests that passed, failed, and were skipped.
+func (r *Report) Counts() (passed, failed, skipped int) {
+	for _, res := range r.Results {
+		switch {
+		case res.Failed:
+			failed++
+		case res.Skipped:
+			skipped++
+		default:
+			passed++
+		}
+	}
+	return
+}
+
+type test struct {
+	name string
+	f    func(*T)
+}
+
+func allTests() []test {
+	var tests []test
+	tests = append(tests, identityTests...)
+	tests = append(tests, controllerTests...)
+	tests = append(tests, nodeTests...)
+	return tests
+}
+
+// Tests returns the names of the suite's tests in the order they are run.
+func Tests() []string {
+	var names []string
+	for _, t := range allTests() {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// suite is the state shared by the tests of a single run.
+type suite struct {
+	config  Config
+	scratch string
+	names   uint64
+
+	identity   csi.IdentityClient
+	controller csi.ControllerClient
+	node       csi.NodeClient
+
+	// hasController and hasNode indicate whether the endpoint serves the
+	// controller and node services.
+	hasController bool
+	hasNode       bool
+	nodeID        string
+
+	pluginCaps map[csi.PluginCapability_Service_Type]bool
+	ctrlrCaps  map[csi.ControllerServiceCapability_RPC_Type]bool
+	nodeCaps   map[csi.NodeServiceCapability_RPC_Type]bool
+}
+
+// Suite is a run of the suite against a single plug-in whose tests may
+// be run one at a time.
+type Suite struct {
+	s     *suite
+	tests []test
+}
+
+// NewSuite queries the services and capabilities of the plug-in served
+// by conn and returns a Suite of the tests selected by config. The
+// Suite must be closed to remove its scratch directory.
+func NewSuite(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	config Config) (*Suite, error) {
+
+	if config.CapacityBytes <= 0 {
+		config.CapacityBytes = DefaultCapacityBytes
+	}
+	if config.NamePrefix == "" {
+		config.NamePrefix = "sanity-"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Output == nil {
+		config.Output = ioutil.Discard
+	}
+
+	s := &suite{
+		config:     config,
+		identity:   csi.NewIdentityClient(conn),
+		controller: csi.NewControllerClient(conn),
+		node:       csi.NewNodeClient(conn),
+	}
+	if err := s.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	scratch, err := ioutil.TempDir(config.ScratchDir, "csi-sanity")
+	if err != nil {
+		return nil, err
+	}
+	s.scratch = scratch
+
+	suite := &Suite{s: s}
+	for _, t := range allTests() {
+		if config.Run != nil && !config.Run.MatchString(t.name) {
+			continue
+		}
+		if config.Skip != nil && config.Skip.MatchString(t.name) {
+			continue
+		}
+		suite.tests = append(suite.tests, t)
+	}
+	return suite, nil
+}
+
+// Tests returns the names of the selected tests in the order they are run.
+func (s *Suite) Tests() []string {
+	var names []string
+	for _, t := range s.tests {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// RunTest runs the selected test with the given name.
+func (s *Suite) RunTest(ctx context.Context, name string) Result {
+	for _, t := range s.tests {
+		if t.name == name {
+			res := s.s.run(ctx, t)
+			s.s.print(res)
+			return res
+		}
+	}
+	return Result{
+		Name:   name,
+		Failed: true,
+		Output: []string{"no such test"},
+	}
+}
+
+// Close removes the suite's scratch directory.
+func (s *Suite) Close() error {
+	return os.RemoveAll(s.s.scratch)
+}
+
+// Run runs the selected tests against the plug-in served by conn. An
+// error is returned only if the suite could not be started; the results
+// of the tests are recorded in the report.
+func Run(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	config Config) (*Report, error) {
+
+	suite, err := NewSuite(ctx, conn, config)
+	if err != nil {
+		return nil, err
+	}
+	defer suite.Close()
+
+	report := &Report{}
+	start := time.Now()
+	for _, name := range suite.Tests() {
+		report.Results = append(report.Results, suite.RunTest(ctx, name))
+	}
+	report.Duration = time.Since(start)
+
+	passed, failed, skipped := report.Counts()
+	fmt.Fprintf(suite.s.config.Output,
+		"passed=%d failed=%d skipped=%d (%s)\n",
+		passed, failed, skipped, report.Duration)
+	return report, nil
+}
+
+// discover queries the plug-in's services and capabilities.
+func (s *suite) discover(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	s.pluginCaps = map[csi.PluginCapability_Service_Type]bool{}
+	s.ctrlrCaps = map[csi.ControllerServiceCapability_RPC_Type]bool{}
+	s.nodeCaps = map[csi.NodeServiceCapability_RPC_Type]bool{}
+
+	prep, err := s.identity.GetPluginCapabilities(
+		ctx, &csi.GetPluginCapabilitiesRequest{})
+	if err != nil {
+		return fmt.Errorf("sanity: GetPluginCapabilities failed: %v", err)
+	}
+	for _, c := range prep.Capabilities {
+		if svc := c.GetService(); svc != nil {
+			s.pluginCaps[svc.Type] = true
+		}
+	}
+
+	if s.pluginCaps[csi.PluginCapability_Service_CONTROLLER_SERVICE] {
+		crep, err := s.controller.ControllerGetCapabilities(
+			ctx, &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			return fmt.Errorf(
+				"sanity: ControllerGetCapabilities failed: %v", err)
+		}
+		s.hasController = true
+		for _, c := range crep.Capabilities {
+			if rpc := c.GetRpc(); rpc != nil {
+				s.ctrlrCaps[rpc.Type] = true
+			}
+		}
+	}
+
+	// A plug-in may serve only the controller service, in which case the
+	// node RPCs are unimplemented.
+	irep, err := s.node.NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sanity: NodeGetInfo failed: %v", err)
+	}
+	nrep, err := s.node.NodeGetCapabilities(
+		ctx, &csi.NodeGetCapabilitiesRequest{})
+	if err != nil {
+		return fmt.Errorf("sanity: NodeGetCapabilities failed: %v", err)
+	}
+	s.hasNode = true
+	s.nodeID = irep.NodeId
+	for _, c := range nrep.Capabilities {
+		if rpc := c.GetRpc(); rpc != nil {
+			s.nodeCaps[rpc.Type] = true
+		}
+	}
+	return nil
+}
+
+// errAbort is the value with which a test's goroutine is unwound when
+// the test calls Fatalf or Skipf.
+var errAbort = &struct{}{}
+
+func (s *suite) run(ctx context.Context, tt test) (res Result) {
+	t := &T{ctx: ctx, name: tt.name, s: s}
+	start := time.Now()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil && r != errAbort {
+				t.failed = true
+				t.output = append(t.output, fmt.Sprintf("panic: %v", r))
+			}
+		}()
+		tt.f(t)
+	}()
+	t.runCleanups()
+
+	return Result{
+		Name:     t.name,
+		Duration: time.Since(start),
+		Failed:   t.failed,
+		Skipped:  t.skipped && !t.failed,
+		Output:   t.output,
+	}
+}
+
+func (s *suite) print(res Result) {
+	w := s.config.Output
+	switch {
+	case res.Failed:
+		fmt.Fprintf(w, "--- FAIL: %s (%s)\n", res.Name, res.Duration)
+	case res.Skipped:
+		fmt.Fprintf(w, "--- SKIP: %s\n", res.Name)
+	default:
+		fmt.Fprintf(w, "--- PASS: %s (%s)\n", res.Name, res.Duration)
+	}
+	if res.Failed || res.Skipped {
+		for _, l := range res.Output {
+			fmt.Fprintf(w, "    %s\n", l)
+		}
+	}
+}
+
+// uniqueName returns a name for a volume or snapshot created by a test.
+func (s *suite) uniqueName(test string) string {
+	n := atomic.AddUint64(&s.names, 1)
+	return fmt.Sprintf("%s%s-%d-%d",
+		s.config.NamePrefix, slug(test), time.Now().UnixNano(), n)
+}
+
+var slugRX = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+func slug(name string) string {
+	return strings.Trim(strings.ToLower(slugRX.ReplaceAllString(name, "-")), "-")
+}
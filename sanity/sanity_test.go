@@ -0,0 +1,168 @@
+package sanity_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/akutz/memconn"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	"github.com/rexray/gocsi/mock/provider"
+	"github.com/rexray/gocsi/sanity"
+)
+
+// mockDeviations matches the tests that the mock SP is known to fail:
+//
+//   - ValidateVolumeCapabilities does not check that the volume exists
+//   - ListVolumes returns InvalidArgument rather than Aborted for an
+//     invalid starting token
+var mockDeviations = regexp.MustCompile(
+	`^Controller/(ValidateVolumeCapabilities/NotFound|ListVolumes/InvalidToken)$`)
+
+func startMock(t *testing.T) (*grpc.ClientConn, func()) {
+	ctx := context.Background()
+	addr := fmt.Sprintf("csi-sanity-%s", t.Name())
+
+	sp := provider.New()
+	lis, err := memconn.Listen("memu", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sp.Serve(ctx, lis)
+
+	conn, err := grpc.DialContext(ctx, "",
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return memconn.Dial("memu", addr)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		sp.GracefulStop(ctx)
+	}
+}
+
+func listVolumeIDs(t *testing.T, conn *grpc.ClientConn) []string {
+	rep, err := csi.NewControllerClient(conn).ListVolumes(
+		context.Background(), &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range rep.Entries {
+		ids = append(ids, e.Volume.VolumeId)
+	}
+	return ids
+}
+
+func TestSanity_Mock(t *testing.T) {
+	conn, stop := startMock(t)
+	defer stop()
+	before := listVolumeIDs(t, conn)
+
+	var out bytes.Buffer
+	report, err := sanity.Run(context.Background(), conn, sanity.Config{
+		Skip:   mockDeviations,
+		Output: &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed() {
+		t.Fatalf("suite failed:\n%s", out.String())
+	}
+
+	// The tests that the mock's capabilities allow must not be skipped.
+	ran := map[string]bool{}
+	for _, res := range report.Results {
+		if !res.Skipped {
+			ran[res.Name] = true
+		}
+	}
+	for _, name := range []string{
+		"Controller/CreateVolume/Idempotent",
+		"Controller/PublishVolume/NotFound",
+		"Controller/ListVolumes/Pagination",
+		"Controller/ExpandVolume/Idempotent",
+		"Controller/GetVolume",
+		"Node/PublishVolume/Idempotent",
+		"Node/GetVolumeStats",
+		"Node/UnpublishVolume/NotFound",
+	} {
+		if !ran[name] {
+			t.Errorf("%s did not run:\n%s", name, out.String())
+		}
+	}
+
+	// Everything the suite created is removed.
+	if after := listVolumeIDs(t, conn); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("volumes=%v, expected %v", after, before)
+	}
+}
+
+func TestSanity_Failures(t *testing.T) {
+	conn, stop := startMock(t)
+	defer stop()
+	report, err := sanity.Run(context.Background(), conn, sanity.Config{
+		Run: mockDeviations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("results=%v", report.Results)
+	}
+	for _, res := range report.Results {
+		if !res.Failed || len(res.Output) == 0 {
+			t.Errorf("%s: failed=%v, output=%v",
+				res.Name, res.Failed, res.Output)
+		}
+	}
+}
+
+func TestSanity_JUnit(t *testing.T) {
+	conn, stop := startMock(t)
+	defer stop()
+	report, err := sanity.Run(context.Background(), conn, sanity.Config{
+		Run: regexp.MustCompile(`^Identity/|/InvalidToken$`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var ts struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Skipped  int `xml:"skipped,attr"`
+		Cases    []struct {
+			Name      string `xml:"name,attr"`
+			ClassName string `xml:"classname,attr"`
+		} `xml:"testcase"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &ts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mock does not advertise LIST_SNAPSHOTS.
+	if ts.Tests != 5 || ts.Failures != 1 || ts.Skipped != 1 {
+		t.Fatalf("tests=%d failures=%d skipped=%d:\n%s",
+			ts.Tests, ts.Failures, ts.Skipped, buf.String())
+	}
+	if c := ts.Cases[0]; c.Name != "Identity/GetPluginInfo" ||
+		c.ClassName != "Identity" {
+		t.Fatalf("case=%+v", c)
+	}
+}
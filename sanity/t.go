@@ -0,0 +1,388 @@
+package sanity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rexray/gocsi/utils"
+)
+
+// T is the state of a single test. Its methods are modeled on those of
+// testing.T.
+type T struct {
+	ctx      context.Context
+	name     string
+	s        *suite
+	failed   bool
+	skipped  bool
+	output   []string
+	cleanups []func()
+}
+
+// Name returns the name of the test.
+func (t *T) Name() string {
+	return t.name
+}
+
+// Logf records a message in the test's output.
+func (t *T) Logf(format string, args ...interface{}) {
+	t.output = append(t.output, fmt.Sprintf(format, args...))
+}
+
+// Errorf records a message and marks the test as failed.
+func (t *T) Errorf(format string, args ...interface{}) {
+	t.Logf(format, args...)
+	t.failed = true
+}
+
+// Fatalf records a message, marks the test as failed, and stops the test.
+func (t *T) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	panic(errAbort)
+}
+
+// Skipf records a message, marks the test as skipped, and stops the test.
+func (t *T) Skipf(format string, args ...interface{}) {
+	t.Logf(format, args...)
+	t.skipped = true
+	panic(errAbort)
+}
+
+// Failed returns a flag indicating whether the test has failed.
+func (t *T) Failed() bool {
+	return t.failed
+}
+
+// Cleanup registers a function to be called when the test completes.
+// Cleanup functions are called in the reverse order of registration,
+// even if the test fails or is skipped.
+func (t *T) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *T) runCleanups() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if r := recover(); r != nil && r != errAbort {
+					t.Errorf("cleanup: panic: %v", r)
+				}
+			}()
+			t.cleanups[i]()
+		}()
+	}
+	t.cleanups = nil
+}
+
+// rpcContext returns a context for a single RPC.
+func (t *T) rpcContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(t.ctx, t.s.config.Timeout)
+}
+
+func (t *T) requireController() {
+	if !t.s.hasController {
+		t.Skipf("controller service not supported")
+	}
+}
+
+func (t *T) requireNode() {
+	if !t.s.hasNode {
+		t.Skipf("node service not supported")
+	}
+}
+
+func (t *T) requireControllerCap(c csi.ControllerServiceCapability_RPC_Type) {
+	t.requireController()
+	if !t.s.ctrlrCaps[c] {
+		t.Skipf("missing controller capability %s", c)
+	}
+}
+
+func (t *T) requireNodeCap(c csi.NodeServiceCapability_RPC_Type) {
+	t.requireNode()
+	if !t.s.nodeCaps[c] {
+		t.Skipf("missing node capability %s", c)
+	}
+}
+
+// expectCode fails the test if err does not have one of the given codes.
+// An RPC that succeeds has the code OK.
+func (t *T) expectCode(rpc string, err error, exp ...codes.Code) {
+	c := status.Code(err)
+	for _, e := range exp {
+		if c == e {
+			return
+		}
+	}
+	if err == nil {
+		t.Fatalf("%s: succeeded, expected %v", rpc, exp)
+	}
+	t.Fatalf("%s: code=%v, expected %v: %s",
+		rpc, c, exp, status.Convert(err).Message())
+}
+
+// noError fails the test if err is not nil.
+func (t *T) noError(rpc string, err error) {
+	if err != nil {
+		t.Fatalf("%s: %v", rpc, err)
+	}
+}
+
+// unknownID returns an ID that is not expected to name a volume or
+// snapshot.
+func (t *T) unknownID() string {
+	return t.s.uniqueName("unknown-" + t.name)
+}
+
+func (t *T) volumeCapability() *csi.VolumeCapability {
+	return utils.NewMountCapability(
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "")
+}
+
+// path returns a path beneath the test's scratch directory. The path
+// itself is created if mkdir is true, otherwise only its parent is.
+func (t *T) path(name string, mkdir bool) string {
+	p := filepath.Join(t.s.scratch, slug(t.name), name)
+	d := p
+	if !mkdir {
+		d = filepath.Dir(p)
+	}
+	if err := os.MkdirAll(d, 0755); err != nil {
+		t.Fatalf("failed to create scratch path: %v", err)
+	}
+	return p
+}
+
+// stagingPath returns a staging target path. The CO is responsible for
+// creating the directory.
+func (t *T) stagingPath() string {
+	return t.path("staging", true)
+}
+
+// targetPath returns a target path for a volume. The CO is responsible
+// for creating the path's parent directory.
+func (t *T) targetPath(volumeID string) string {
+	if f := t.s.config.TargetPath; f != nil {
+		p, err := f(volumeID)
+		if err != nil {
+			t.Fatalf("failed to create target path: %v", err)
+		}
+		return p
+	}
+	return t.path(filepath.Join("target", "mnt"), false)
+}
+
+// createVolume creates a volume that is deleted when the test completes.
+func (t *T) createVolume() *csi.Volume {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME)
+
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.CreateVolume(ctx, t.createVolumeRequest())
+	t.noError("CreateVolume", err)
+	if rep.Volume == nil || rep.Volume.VolumeId == "" {
+		t.Fatalf("CreateVolume: response missing volume ID")
+	}
+	t.deleteVolumeOnCleanup(rep.Volume.VolumeId)
+	return rep.Volume
+}
+
+func (t *T) createVolumeRequest() *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name: t.s.uniqueName(t.name),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: t.s.config.CapacityBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{t.volumeCapability()},
+		Parameters:         t.s.config.Parameters,
+		Secrets:            t.s.config.Secrets,
+	}
+}
+
+func (t *T) deleteVolumeOnCleanup(id string) {
+	t.Cleanup(func() {
+		ctx, cancel := t.rpcContext()
+		defer cancel()
+		if _, err := t.s.controller.DeleteVolume(ctx,
+			&csi.DeleteVolumeRequest{
+				VolumeId: id,
+				Secrets:  t.s.config.Secrets,
+			}); err != nil {
+			t.Errorf("cleanup: DeleteVolume %s: %v", id, err)
+		}
+	})
+}
+
+// createSnapshot creates a snapshot of a volume that is deleted when the
+// test completes.
+func (t *T) createSnapshot(volumeID string) *csi.Snapshot {
+	t.requireControllerCap(
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT)
+
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.CreateSnapshot(
+		ctx, t.createSnapshotRequest(volumeID))
+	t.noError("CreateSnapshot", err)
+	if rep.Snapshot == nil || rep.Snapshot.SnapshotId == "" {
+		t.Fatalf("CreateSnapshot: response missing snapshot ID")
+	}
+	t.deleteSnapshotOnCleanup(rep.Snapshot.SnapshotId)
+	return rep.Snapshot
+}
+
+func (t *T) createSnapshotRequest(volumeID string) *csi.CreateSnapshotRequest {
+	return &csi.CreateSnapshotRequest{
+		SourceVolumeId: volumeID,
+		Name:           t.s.uniqueName(t.name),
+		Parameters:     t.s.config.Parameters,
+		Secrets:        t.s.config.Secrets,
+	}
+}
+
+func (t *T) deleteSnapshotOnCleanup(id string) {
+	t.Cleanup(func() {
+		ctx, cancel := t.rpcContext()
+		defer cancel()
+		if _, err := t.s.controller.DeleteSnapshot(ctx,
+			&csi.DeleteSnapshotRequest{
+				SnapshotId: id,
+				Secrets:    t.s.config.Secrets,
+			}); err != nil {
+			t.Errorf("cleanup: DeleteSnapshot %s: %v", id, err)
+		}
+	})
+}
+
+// controllerPublish publishes a volume to the node if the plug-in has
+// the PUBLISH_UNPUBLISH_VOLUME capability and returns the publish
+// context. The volume is unpublished when the test completes.
+func (t *T) controllerPublish(volumeID string) map[string]string {
+	if !t.s.ctrlrCaps[csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME] {
+		return nil
+	}
+
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	rep, err := t.s.controller.ControllerPublishVolume(
+		ctx, t.controllerPublishRequest(volumeID))
+	t.noError("ControllerPublishVolume", err)
+	t.Cleanup(func() {
+		ctx, cancel := t.rpcContext()
+		defer cancel()
+		if _, err := t.s.controller.ControllerUnpublishVolume(ctx,
+			&csi.ControllerUnpublishVolumeRequest{
+				VolumeId: volumeID,
+				NodeId:   t.s.nodeID,
+				Secrets:  t.s.config.Secrets,
+			}); err != nil {
+			t.Errorf("cleanup: ControllerUnpublishVolume %s: %v",
+				volumeID, err)
+		}
+	})
+	return rep.PublishContext
+}
+
+func (t *T) controllerPublishRequest(
+	volumeID string) *csi.ControllerPublishVolumeRequest {
+
+	return &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volumeID,
+		NodeId:           t.s.nodeID,
+		VolumeCapability: t.volumeCapability(),
+		Secrets:          t.s.config.Secrets,
+	}
+}
+
+// nodeStage stages a volume if the plug-in has the STAGE_UNSTAGE_VOLUME
+// capability and returns the staging target path. The volume is unstaged
+// when the test completes.
+func (t *T) nodeStage(volume *csi.Volume, pubCtx map[string]string) string {
+	if !t.s.nodeCaps[csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME] {
+		return ""
+	}
+
+	req := t.nodeStageRequest(volume, pubCtx)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodeStageVolume(ctx, req)
+	t.noError("NodeStageVolume", err)
+	t.Cleanup(func() {
+		ctx, cancel := t.rpcContext()
+		defer cancel()
+		if _, err := t.s.node.NodeUnstageVolume(ctx,
+			&csi.NodeUnstageVolumeRequest{
+				VolumeId:          volume.VolumeId,
+				StagingTargetPath: req.StagingTargetPath,
+			}); err != nil {
+			t.Errorf("cleanup: NodeUnstageVolume %s: %v",
+				volume.VolumeId, err)
+		}
+	})
+	return req.StagingTargetPath
+}
+
+func (t *T) nodeStageRequest(
+	volume *csi.Volume,
+	pubCtx map[string]string) *csi.NodeStageVolumeRequest {
+
+	return &csi.NodeStageVolumeRequest{
+		VolumeId:          volume.VolumeId,
+		PublishContext:    pubCtx,
+		StagingTargetPath: t.stagingPath(),
+		VolumeCapability:  t.volumeCapability(),
+		Secrets:           t.s.config.Secrets,
+		VolumeContext:     volume.VolumeContext,
+	}
+}
+
+// nodePublish publishes a volume, which must have already been
+// controller-published and staged, and returns the target path. The
+// volume is unpublished when the test completes.
+func (t *T) nodePublish(
+	volume *csi.Volume,
+	pubCtx map[string]string,
+	stagingPath string) string {
+
+	req := t.nodePublishRequest(volume, pubCtx, stagingPath)
+	ctx, cancel := t.rpcContext()
+	defer cancel()
+	_, err := t.s.node.NodePublishVolume(ctx, req)
+	t.noError("NodePublishVolume", err)
+	t.Cleanup(func() {
+		ctx, cancel := t.rpcContext()
+		defer cancel()
+		if _, err := t.s.node.NodeUnpublishVolume(ctx,
+			&csi.NodeUnpublishVolumeRequest{
+				VolumeId:   volume.VolumeId,
+				TargetPath: req.TargetPath,
+			}); err != nil {
+			t.Errorf("cleanup: NodeUnpublishVolume %s: %v",
+				volume.VolumeId, err)
+		}
+	})
+	return req.TargetPath
+}
+
+func (t *T) nodePublishRequest(
+	volume *csi.Volume,
+	pubCtx map[string]string,
+	stagingPath string) *csi.NodePublishVolumeRequest {
+
+	return &csi.NodePublishVolumeRequest{
+		VolumeId:          volume.VolumeId,
+		PublishContext:    pubCtx,
+		StagingTargetPath: stagingPath,
+		TargetPath:        t.targetPath(volume.VolumeId),
+		VolumeCapability:  t.volumeCapability(),
+		Secrets:           t.s.config.Secrets,
+		VolumeContext:     volume.VolumeContext,
+	}
+}
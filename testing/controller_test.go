@@ -9,9 +9,11 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
+	"github.com/rexray/gocsi/middleware/specvalidator"
 	"github.com/rexray/gocsi/mock/service"
 	"github.com/rexray/gocsi/utils"
 )
@@ -40,6 +42,7 @@ var _ = Describe("Controller", func() {
 		// userCreds map[string]string
 		pubInfo map[string]string
 		nodeId  string
+		topoReq *csi.TopologyRequirement
 	)
 	BeforeEach(func() {
 		ctx = context.Background()
@@ -55,6 +58,7 @@ var _ = Describe("Controller", func() {
 		params = map[string]string{"tag": "gold"}
 		// userCreds = map[string]string{"beour": "guest"}
 		nodeId = service.Name
+		topoReq = nil
 	})
 	JustBeforeEach(func() {
 		gclient, stopMock, err = startMockServer(ctx)
@@ -136,7 +140,8 @@ var _ = Describe("Controller", func() {
 				utils.NewMountCapability(0, fsType, mntFlags...),
 			},
 			// ControllerCreateCredentials: userCreds,
-			Parameters: params,
+			Parameters:                params,
+			AccessibilityRequirements: topoReq,
 		}
 		res, err := client.CreateVolume(ctx, req)
 		if res == nil {
@@ -249,6 +254,41 @@ var _ = Describe("Controller", func() {
 		Context("Normal Create Volume Call", func() {
 			It("Should Be Valid", validateNewSnapshot)
 		})
+		Context("Missing Name", func() {
+			BeforeEach(func() {
+				snapName = ""
+			})
+			It("Should Be Invalid", func() {
+				Ω(err).Should(ΣCM(codes.InvalidArgument, "required: Name"))
+				Ω(snap).Should(BeNil())
+			})
+		})
+		Context("Missing Name And Source Volume ID", func() {
+			BeforeEach(func() {
+				snapName = ""
+				volID = ""
+			})
+			It("Should Report Both Violations", func() {
+				Ω(err).Should(ΣCM(codes.InvalidArgument, "required: Name"))
+				fvs := specvalidator.FieldViolations(err)
+				Ω(fvs).Should(HaveLen(2))
+				Ω(fvs[0].Field).Should(Equal("name"))
+				Ω(fvs[0].Description).Should(Equal("required: Name"))
+				Ω(fvs[1].Field).Should(Equal("source_volume_id"))
+				Ω(fvs[1].Description).Should(
+					Equal("required: SourceVolumeID"))
+			})
+		})
+		Context("Missing Source Volume ID", func() {
+			BeforeEach(func() {
+				volID = ""
+			})
+			It("Should Be Invalid", func() {
+				Ω(err).Should(ΣCM(
+					codes.InvalidArgument, "required: SourceVolumeID"))
+				Ω(snap).Should(BeNil())
+			})
+		})
 	})
 
 	Describe("CreateVolume", func() {
@@ -333,6 +373,41 @@ var _ = Describe("Controller", func() {
 				Ω(vol).Should(BeNil())
 			})
 		})
+		Context("Preferred Topology Not Requisite", func() {
+			BeforeEach(func() {
+				topoReq = &csi.TopologyRequirement{
+					Requisite: []*csi.Topology{
+						{Segments: map[string]string{"zone": "z1"}},
+					},
+					Preferred: []*csi.Topology{
+						{Segments: map[string]string{"zone": "z2"}},
+					},
+				}
+			})
+			It("Should Be Invalid", func() {
+				Ω(err).Should(ΣCM(
+					codes.InvalidArgument,
+					"invalid: AccessibilityRequirements.Preferred[0]: "+
+						"not in AccessibilityRequirements.Requisite"))
+				Ω(vol).Should(BeNil())
+			})
+		})
+		Context("Invalid Topology Key", func() {
+			BeforeEach(func() {
+				topoReq = &csi.TopologyRequirement{
+					Requisite: []*csi.Topology{
+						{Segments: map[string]string{"-zone": "z1"}},
+					},
+				}
+			})
+			It("Should Be Invalid", func() {
+				Ω(err).Should(ΣCM(
+					codes.InvalidArgument,
+					"invalid: AccessibilityRequirements.Requisite[0]."+
+						"Segments[-zone]: key: invalid name"))
+				Ω(vol).Should(BeNil())
+			})
+		})
 		Context("Idempotent Create", func() {
 
 			const bucketSize = 250
@@ -613,6 +688,15 @@ var _ = Describe("Controller", func() {
 				Ω(snaps).Should(HaveLen(5))
 			})
 		})
+		Context("Negative Max Entries", func() {
+			It("Should Be Invalid", func() {
+				_, err := client.ListSnapshots(
+					ctx,
+					&csi.ListSnapshotsRequest{MaxEntries: -1})
+				Ω(err).Should(ΣCM(
+					codes.InvalidArgument, "invalid: MaxEntries=-1"))
+			})
+		})
 	})
 
 	Describe("Publication", func() {
@@ -722,5 +806,121 @@ var _ = Describe("Controller", func() {
 		Context("ExpandVolume", func() {
 			It("Should be expanded", validateVolumeExpand)
 		})
+		Context("Missing Capacity Range", func() {
+			It("Should Be Invalid", func() {
+				_, err := client.ControllerExpandVolume(
+					ctx,
+					&csi.ControllerExpandVolumeRequest{VolumeId: volID})
+				Ω(err).Should(ΣCM(
+					codes.InvalidArgument, "required: CapacityRange"))
+			})
+		})
+		Context("Limit Less Than Required", func() {
+			It("Should Be Invalid", func() {
+				_, err := client.ControllerExpandVolume(
+					ctx,
+					&csi.ControllerExpandVolumeRequest{
+						VolumeId: volID,
+						CapacityRange: &csi.CapacityRange{
+							RequiredBytes: expBytes,
+							LimitBytes:    limBytes,
+						},
+					})
+				Ω(err).Should(HaveOccurred())
+				Ω(status.Code(err)).Should(Equal(codes.InvalidArgument))
+			})
+		})
+	})
+
+	Describe("ControllerGetVolume", func() {
+		getVolume := func(id string) (*csi.ControllerGetVolumeResponse, error) {
+			return client.ControllerGetVolume(
+				ctx, &csi.ControllerGetVolumeRequest{VolumeId: id})
+		}
+
+		Context("Existing Volume", func() {
+			It("Should Be Healthy", func() {
+				rep, err := getVolume("1")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(rep.Volume.VolumeId).Should(Equal("1"))
+				Ω(rep.Status.PublishedNodeIds).Should(BeEmpty())
+				Ω(rep.Status.VolumeCondition).ShouldNot(BeNil())
+				Ω(rep.Status.VolumeCondition.Abnormal).Should(BeFalse())
+			})
+		})
+		Context("Published Volume", func() {
+			It("Should List The Node", func() {
+				_, err := client.ControllerPublishVolume(
+					ctx,
+					&csi.ControllerPublishVolumeRequest{
+						VolumeId: "1",
+						NodeId:   nodeId,
+						VolumeCapability: utils.NewMountCapability(
+							csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+							fsType),
+					})
+				Ω(err).ShouldNot(HaveOccurred())
+				rep, err := getVolume("1")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(rep.Status.PublishedNodeIds).Should(Equal([]string{nodeId}))
+			})
+		})
+		Context("Abnormal Volume", func() {
+			BeforeEach(func() {
+				params = map[string]string{
+					service.AbnormalParam: "disk failing",
+				}
+			})
+			JustBeforeEach(func() {
+				createNewVolume()
+				validateNewVolume()
+			})
+			It("Should Be Abnormal", func() {
+				rep, err := getVolume(volID)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(rep.Status.VolumeCondition.Abnormal).Should(BeTrue())
+				Ω(rep.Status.VolumeCondition.Message).Should(
+					Equal("disk failing"))
+
+				lrep, err := client.ListVolumes(
+					ctx, &csi.ListVolumesRequest{})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(lrep.Entries).Should(HaveLen(4))
+				Ω(lrep.Entries[3].Status.VolumeCondition.Abnormal).
+					Should(BeTrue())
+			})
+		})
+		Context("Missing Volume", func() {
+			It("Should Be Not Found", func() {
+				_, err := getVolume("5")
+				Ω(status.Code(err)).Should(Equal(codes.NotFound))
+			})
+		})
+	})
+
+	Describe("GetCapacity", func() {
+		It("Should Be Valid", func() {
+			rep, err := client.GetCapacity(ctx, &csi.GetCapacityRequest{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rep.AvailableCapacity).Should(BeNumerically(">", 0))
+		})
+	})
+
+	Describe("ValidateVolumeCapabilities", func() {
+		It("Should Be Confirmed", func() {
+			rep, err := client.ValidateVolumeCapabilities(
+				ctx,
+				&csi.ValidateVolumeCapabilitiesRequest{
+					VolumeId: volID,
+					VolumeCapabilities: []*csi.VolumeCapability{
+						utils.NewMountCapability(
+							csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+							fsType, mntFlags...),
+					},
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rep.Confirmed).ShouldNot(BeNil())
+			Ω(rep.Confirmed.VolumeCapabilities).Should(HaveLen(1))
+		})
 	})
 })
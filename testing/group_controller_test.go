@@ -0,0 +1,157 @@
+package gocsi_test
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+var _ = Describe("GroupController", func() {
+	var (
+		err      error
+		stopMock func()
+		ctx      context.Context
+		gclient  *grpc.ClientConn
+		client   csi.GroupControllerClient
+	)
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+	JustBeforeEach(func() {
+		gclient, stopMock, err = startMockServer(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		client = csi.NewGroupControllerClient(gclient)
+	})
+	AfterEach(func() {
+		ctx = nil
+		gclient.Close()
+		gclient = nil
+		client = nil
+		stopMock()
+	})
+
+	createGroup := func(name string, volIDs ...string) (
+		*csi.VolumeGroupSnapshot, error) {
+
+		rep, err := client.CreateVolumeGroupSnapshot(
+			ctx,
+			&csi.CreateVolumeGroupSnapshotRequest{
+				Name:            name,
+				SourceVolumeIds: volIDs,
+			})
+		if err != nil {
+			return nil, err
+		}
+		return rep.GroupSnapshot, nil
+	}
+
+	snapIDs := func(g *csi.VolumeGroupSnapshot) []string {
+		var ids []string
+		for _, s := range g.Snapshots {
+			ids = append(ids, s.SnapshotId)
+		}
+		return ids
+	}
+
+	Describe("GroupControllerGetCapabilities", func() {
+		It("Should Be Valid", func() {
+			rep, err := client.GroupControllerGetCapabilities(
+				ctx,
+				&csi.GroupControllerGetCapabilitiesRequest{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rep.Capabilities).Should(HaveLen(1))
+			Ω(rep.Capabilities[0].GetRpc().Type).Should(Equal(
+				csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT))
+		})
+	})
+
+	Describe("CreateVolumeGroupSnapshot", func() {
+		It("Should Snapshot Each Volume", func() {
+			g, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(g.ReadyToUse).Should(BeTrue())
+			Ω(g.Snapshots).Should(HaveLen(2))
+			for i, s := range g.Snapshots {
+				Ω(s.GroupSnapshotId).Should(Equal(g.GroupSnapshotId))
+				Ω(s.SourceVolumeId).Should(Equal([]string{"1", "2"}[i]))
+			}
+		})
+		It("Should Be Idempotent", func() {
+			g1, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			g2, err := createGroup("Test Group", "2", "1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(g2.GroupSnapshotId).Should(Equal(g1.GroupSnapshotId))
+		})
+		It("Should Fail With Different Source Volumes", func() {
+			_, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = createGroup("Test Group", "1", "3")
+			Ω(status.Code(err)).Should(Equal(codes.AlreadyExists))
+		})
+		It("Should Fail With Duplicate Source Volumes", func() {
+			_, err := createGroup("Test Group", "1", "1")
+			Ω(status.Code(err)).Should(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("GetVolumeGroupSnapshot", func() {
+		It("Should Get The Group Snapshot", func() {
+			g, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			rep, err := client.GetVolumeGroupSnapshot(
+				ctx,
+				&csi.GetVolumeGroupSnapshotRequest{
+					GroupSnapshotId: g.GroupSnapshotId,
+					SnapshotIds:     snapIDs(g),
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rep.GroupSnapshot.Snapshots).Should(HaveLen(2))
+		})
+		It("Should Fail With A Snapshot List Mismatch", func() {
+			g, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.GetVolumeGroupSnapshot(
+				ctx,
+				&csi.GetVolumeGroupSnapshotRequest{
+					GroupSnapshotId: g.GroupSnapshotId,
+					SnapshotIds:     snapIDs(g)[:1],
+				})
+			Ω(status.Code(err)).Should(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("DeleteVolumeGroupSnapshot", func() {
+		It("Should Delete The Group Snapshot", func() {
+			g, err := createGroup("Test Group", "1", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.DeleteVolumeGroupSnapshot(
+				ctx,
+				&csi.DeleteVolumeGroupSnapshotRequest{
+					GroupSnapshotId: g.GroupSnapshotId,
+					SnapshotIds:     snapIDs(g),
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.GetVolumeGroupSnapshot(
+				ctx,
+				&csi.GetVolumeGroupSnapshotRequest{
+					GroupSnapshotId: g.GroupSnapshotId,
+					SnapshotIds:     snapIDs(g),
+				})
+			Ω(status.Code(err)).Should(Equal(codes.NotFound))
+
+			// Deleting it again succeeds.
+			_, err = client.DeleteVolumeGroupSnapshot(
+				ctx,
+				&csi.DeleteVolumeGroupSnapshotRequest{
+					GroupSnapshotId: g.GroupSnapshotId,
+					SnapshotIds:     snapIDs(g),
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
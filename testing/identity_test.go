@@ -2,7 +2,10 @@ package gocsi_test
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -10,6 +13,8 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/rexray/gocsi"
 	csictx "github.com/rexray/gocsi/context"
+	llflock "github.com/rexray/gocsi/middleware/leaderelection/flock"
+	lltypes "github.com/rexray/gocsi/middleware/leaderelection/types"
 	"github.com/rexray/gocsi/mock/service"
 )
 
@@ -81,11 +86,15 @@ var _ = Describe("Identity", func() {
 					`^[\w\d]+\.[\w\d\.\-_]*[\w\d]$`))
 				st, ok := status.FromError(err)
 				Ω(ok).Should(BeTrue())
-				Ω(st.Details()).Should(HaveLen(1))
+				Ω(st.Details()).Should(HaveLen(2))
 				rep, ok := st.Details()[0].(*csi.GetPluginInfoResponse)
 				Ω(ok).Should(BeTrue())
 				Ω(rep.Name).Should(Equal("Mock"))
 				Ω(rep.VendorVersion).Should(Equal("v1.0.0"))
+				br, ok := st.Details()[1].(*errdetails.BadRequest)
+				Ω(ok).Should(BeTrue())
+				Ω(br.FieldViolations).Should(HaveLen(1))
+				Ω(br.FieldViolations[0].Field).Should(Equal("name"))
 			})
 		})
 	})
@@ -96,11 +105,14 @@ var _ = Describe("Identity", func() {
 				ctx, &csi.GetPluginCapabilitiesRequest{})
 			Ω(err).ShouldNot(HaveOccurred())
 			Ω(rep).ShouldNot(BeNil())
-			Ω(rep.Capabilities).Should(HaveLen(2))
+			Ω(rep.Capabilities).Should(HaveLen(3))
 			svc := rep.Capabilities[0].GetService()
 			Ω(svc).ShouldNot(BeNil())
 			Ω(svc.Type).Should(Equal(csi.PluginCapability_Service_CONTROLLER_SERVICE))
-			svc2 := rep.Capabilities[1].GetVolumeExpansion()
+			svc = rep.Capabilities[1].GetService()
+			Ω(svc).ShouldNot(BeNil())
+			Ω(svc.Type).Should(Equal(csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE))
+			svc2 := rep.Capabilities[2].GetVolumeExpansion()
 			Ω(svc2).ShouldNot(BeNil())
 			Ω(svc2.Type).Should(Equal(csi.PluginCapability_VolumeExpansion_ONLINE))
 		})
@@ -114,5 +126,54 @@ var _ = Describe("Identity", func() {
 			Ω(rep).ShouldNot(BeNil())
 			Ω(rep.GetReady().GetValue()).To(Equal(true))
 		})
+
+		Context("With Leader Election", func() {
+			var (
+				dir     string
+				leader  lltypes.Elector
+				environ []string
+			)
+			BeforeEach(func() {
+				dir, err = ioutil.TempDir("", "gocsi-leader")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				// Another process is the leader.
+				leader, err = llflock.New(ctx, dir, "mock", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(leader.Campaign(ctx)).ShouldNot(HaveOccurred())
+
+				environ = []string{
+					gocsi.EnvVarLeaderElection + "=true",
+					gocsi.EnvVarLeaderElectionName + "=mock",
+					gocsi.EnvVarLeaderElectionFlockDir + "=" + dir,
+				}
+				ctx = csictx.WithEnviron(ctx, environ)
+			})
+			AfterEach(func() {
+				leader.Resign(context.Background())
+				os.RemoveAll(dir)
+			})
+			It("Should Be Ready In Combined Mode", func() {
+				rep, err := client.Probe(ctx, &csi.ProbeRequest{})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(rep.GetReady().GetValue()).To(Equal(true))
+
+				_, err = csi.NewControllerClient(gclient).ListVolumes(
+					ctx, &csi.ListVolumesRequest{})
+				Ω(err).Should(ΣCM(codes.Unavailable, "not leader"))
+			})
+			Context("In Controller Mode", func() {
+				BeforeEach(func() {
+					ctx = csictx.WithEnviron(ctx, append(environ,
+						gocsi.EnvVarMode+"=controller"))
+				})
+				It("Should Not Be Ready", func() {
+					rep, err := client.Probe(ctx, &csi.ProbeRequest{})
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(rep.GetReady()).ShouldNot(BeNil())
+					Ω(rep.GetReady().GetValue()).To(Equal(false))
+				})
+			})
+		})
 	})
 })
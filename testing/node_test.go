@@ -5,6 +5,8 @@ import (
 	"path"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/rexray/gocsi/mock/service"
@@ -83,6 +85,16 @@ var _ = Describe("Node", func() {
 		})
 	})
 
+	Describe("NodeGetVolumeStats Missing Volume Path", func() {
+		It("Should Be Invalid", func() {
+			_, err := client.NodeGetVolumeStats(
+				ctx,
+				&csi.NodeGetVolumeStatsRequest{VolumeId: "2"})
+			Ω(err).Should(ΣCM(
+				codes.InvalidArgument, "required: VolumePath"))
+		})
+	})
+
 	Describe("NodeGetInfo", func() {
 		var nodeID string
 		var maxVolsPerNode int64
@@ -151,4 +163,97 @@ var _ = Describe("Node", func() {
 			})
 		})
 	})
+
+	Describe("Volume Mount Group", func() {
+		targetPath := "/mnt/mock"
+		groupKey := path.Join(service.Name, targetPath) + "#volume_mount_group"
+
+		It("Should Be Recorded", func() {
+			volCap := utils.NewMountCapability(
+				csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "nfs")
+			volCap.GetMount().VolumeMountGroup = "1000"
+			_, err := client.NodePublishVolume(
+				ctx,
+				&csi.NodePublishVolumeRequest{
+					VolumeId:         "1",
+					PublishContext:   map[string]string{"device": "/dev/mock"},
+					VolumeCapability: volCap,
+					TargetPath:       targetPath,
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+			vols, err := listVolumes()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(vols[0].VolumeContext[groupKey]).Should(Equal("1000"))
+
+			_, err = client.NodeUnpublishVolume(
+				ctx,
+				&csi.NodeUnpublishVolumeRequest{
+					VolumeId:   "1",
+					TargetPath: targetPath,
+				})
+			Ω(err).ShouldNot(HaveOccurred())
+			vols, err = listVolumes()
+			Ω(err).ShouldNot(HaveOccurred())
+			_, ok := vols[0].VolumeContext[groupKey]
+			Ω(ok).Should(BeFalse())
+		})
+	})
+
+	Describe("Single Node Access Modes", func() {
+		publishVolume := func(
+			mode csi.VolumeCapability_AccessMode_Mode,
+			targetPath string) error {
+
+			_, err := client.NodePublishVolume(
+				ctx,
+				&csi.NodePublishVolumeRequest{
+					VolumeId:         "2",
+					PublishContext:   map[string]string{"device": "/dev/mock"},
+					VolumeCapability: utils.NewMountCapability(mode, "mock"),
+					TargetPath:       targetPath,
+				})
+			return err
+		}
+
+		Context("Single Writer", func() {
+			It("Should Not Be Published Twice", func() {
+				Ω(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+					"/mnt/mock1")).ShouldNot(HaveOccurred())
+				Ω(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+					"/mnt/mock1")).ShouldNot(HaveOccurred())
+				Ω(status.Code(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+					"/mnt/mock2"))).Should(
+					Equal(codes.FailedPrecondition))
+
+				_, err := client.NodeUnpublishVolume(
+					ctx,
+					&csi.NodeUnpublishVolumeRequest{
+						VolumeId:   "2",
+						TargetPath: "/mnt/mock1",
+					})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+					"/mnt/mock2")).ShouldNot(HaveOccurred())
+				Ω(status.Code(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+					"/mnt/mock1"))).Should(
+					Equal(codes.FailedPrecondition))
+			})
+		})
+
+		Context("Multi Writer", func() {
+			It("Should Be Published Twice", func() {
+				Ω(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+					"/mnt/mock1")).ShouldNot(HaveOccurred())
+				Ω(publishVolume(
+					csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+					"/mnt/mock2")).ShouldNot(HaveOccurred())
+			})
+		})
+	})
 })
@@ -29,7 +29,8 @@ GLOBAL OPTIONS
 
         If unset or set to an empty value the storage plug-in activates
         both controller and node services. The identity service is always
-        activated.
+        activated. The group controller service, if provided, is activated
+        along with the controller service.
 
     X_CSI_ENDPOINT_PERMS
         When CSI_ENDPOINT is set to a UNIX socket file this environment
@@ -106,6 +107,18 @@ GLOBAL OPTIONS
 
         Only takes effect if Request or Reply logging is enabled.
 
+    X_CSI_SECRET_GUARD
+        A flag that enables the secret guard. The values of a request's
+        secrets are redacted from the response and from the returned
+        error's message and details, and a warning that names the leaking
+        fields is logged. Values shorter than four characters are ignored.
+
+    X_CSI_SECRET_GUARD_FAIL
+        A flag that fails calls whose response or error contains a value of
+        the request's secrets with the gRPC error code Internal.
+
+        Enabling this option sets X_CSI_SECRET_GUARD=true.
+
     X_CSI_REQ_ID_INJECTION
         A flag that enables request ID injection. The ID is parsed from
         the incoming request's metadata with a key of "csi.requestid".
@@ -119,11 +132,41 @@ GLOBAL OPTIONS
 
     X_CSI_SPEC_REQ_VALIDATION
         A flag that enables the validation of CSI request messages.
+        Invalid requests are rejected with a gRPC error with a code of
+        "InvalidArgument" and a google.rpc.BadRequest detail that lists
+        every field violation.
 
     X_CSI_SPEC_REP_VALIDATION
         A flag that enables the validation of CSI response messages.
         Invalid responses are marshalled into a gRPC error with a code
-        of "Internal."
+        of "Internal." The error's details contain the response followed
+        by a google.rpc.BadRequest that lists every field violation.
+
+    X_CSI_SPEC_ERR_CODE_VALIDATION
+        A flag that enables the validation of the gRPC status codes of
+        errors returned by RPCs against the codes the CSI specification
+        permits for each RPC. Errors with unexpected codes and errors that
+        are not gRPC status errors are replaced with a gRPC error with a
+        code of "Internal." If X_CSI_SPEC_REP_REPORT_ONLY=true then errors
+        with unexpected codes are logged and counted instead and returned
+        unchanged.
+
+    X_CSI_SPEC_REPORT_ONLY
+        Setting X_CSI_SPEC_REPORT_ONLY=true is the same as:
+            X_CSI_SPEC_REQ_REPORT_ONLY=true
+            X_CSI_SPEC_REP_REPORT_ONLY=true
+
+    X_CSI_SPEC_REQ_REPORT_ONLY
+        A flag that enables the validation of CSI request messages in
+        report-only mode. Invalid requests are logged as warnings with the
+        method, request ID, and field violations, and counted per rule in
+        the expvar map csi_spec_violations, but are passed to the plug-in
+        unchanged.
+
+    X_CSI_SPEC_REP_REPORT_ONLY
+        A flag that enables the validation of CSI response messages in
+        report-only mode. Invalid responses are logged and counted like
+        invalid requests, but are returned to the client unchanged.
 
     X_CSI_SPEC_DISABLE_LEN_CHECK
         A flag that disables validation of CSI message field lengths.
@@ -158,6 +201,9 @@ GLOBAL OPTIONS
             X_CSI_REQUIRE_CREDS_CTRLR_UNPUB_VOL=true
             X_CSI_REQUIRE_CREDS_NODE_PUB_VOL=true
             X_CSI_REQUIRE_CREDS_NODE_UNPUB_VOL=true
+            X_CSI_REQUIRE_CREDS_CREATE_SNAP=true
+            X_CSI_REQUIRE_CREDS_DELETE_SNAP=true
+            X_CSI_REQUIRE_CREDS_CTRLR_EXPAND_VOL=true
 
         Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
 
@@ -195,6 +241,116 @@ GLOBAL OPTIONS
 
         Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
 
+    X_CSI_REQUIRE_CREDS_CREATE_SNAP
+        A flag that enables treating the following fields as required:
+            * CreateSnapshotRequest.Secrets
+
+        Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
+
+    X_CSI_REQUIRE_CREDS_DELETE_SNAP
+        A flag that enables treating the following fields as required:
+            * DeleteSnapshotRequest.Secrets
+
+        Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
+
+    X_CSI_REQUIRE_CREDS_LIST_SNAP
+        A flag that enables treating the following fields as required:
+            * ListSnapshotsRequest.Secrets
+
+        This option is not enabled by X_CSI_REQUIRE_CREDS.
+
+        Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
+
+    X_CSI_REQUIRE_CREDS_CTRLR_EXPAND_VOL
+        A flag that enables treating the following fields as required:
+            * ControllerExpandVolumeRequest.Secrets
+
+        Enabling this option sets X_CSI_SPEC_REQ_VALIDATION=true.
+
+    X_CSI_LIFECYCLE_VALIDATION
+        A flag that enables the lifecycle validator. The validator tracks
+        the lifecycle of each volume and logs and counts calls made out of
+        the order defined by the spec, ex. NodePublishVolume with a
+        StagingTargetPath that was never staged, NodeUnstageVolume while a
+        target is still published, or DeleteVolume while the volume is
+        controller-published. The expected order depends on the plug-in's
+        advertised capabilities. Checks that span the Controller and Node
+        services are only made when X_CSI_MODE is unset.
+
+    X_CSI_LIFECYCLE_ENFORCE
+        A flag that rejects calls made out of order with the gRPC error
+        code FailedPrecondition.
+
+        Enabling this option sets X_CSI_LIFECYCLE_VALIDATION=true.
+
+    X_CSI_LIFECYCLE_STATE_FILE
+        The file in which the lifecycle validator persists the volumes'
+        states so they survive a restart.
+
+    X_CSI_CAPABILITY_GATING
+        A flag that enables capability gating. The plug-in's capabilities
+        are cached at startup and refreshed when the process receives
+        SIGHUP, which no longer stops the server. RPCs whose capability is
+        not advertised are rejected with the gRPC error code Unimplemented,
+        and requests that use unsupported features, ex. cloning a volume
+        without CLONE_VOLUME, are rejected with InvalidArgument.
+
+    X_CSI_DRY_RUN
+        A flag that enables dry-run mode. Mutating RPCs, ex. CreateVolume
+        or NodePublishVolume, are validated, serialized and logged, and then
+        answered with synthesized responses instead of reaching the plug-in.
+        Read RPCs are handled by the plug-in.
+
+    X_CSI_DRY_RUN_RECORD_FILE
+        The JSON-lines file to which the calls short-circuited in dry-run
+        mode are appended. The values of the requests' secrets are redacted.
+
+    X_CSI_RECORD_FILE
+        The file to which every call's request, response, status, timing
+        and metadata are appended as versioned JSON lines. The values of
+        the requests' secrets are redacted. The calls may be replayed
+        against an endpoint with "csc replay".
+
+    X_CSI_FAULT_INJECT_RULES
+        A JSON array of the rules with which the fault injector fails,
+        delays or hangs calls. Each rule matches calls by a method regular
+        expression, a volume ID regular expression and a probability, and
+        has one of the actions "error", "latency", "fail-after" or "hang".
+        Every injected fault is logged. Setting this option, or either of
+        the two following, enables the fault injector.
+
+    X_CSI_FAULT_INJECT_FILE
+        A file that contains a JSON array of fault injection rules. The
+        rules of X_CSI_FAULT_INJECT_RULES are appended to them.
+
+    X_CSI_FAULT_INJECT_ADDR
+        The address of the fault injector's HTTP admin endpoint, ex.
+        127.0.0.1:9099. The rules are read with GET, replaced with PUT and
+        removed with DELETE at the path /faultinject/rules.
+
+    X_CSI_LEADER_ELECTION
+        A flag that enables leader election. Only the elected leader
+        handles Controller and GroupController RPCs. Other replicas respond
+        to those RPCs with the gRPC error code Unavailable. When
+        X_CSI_MODE=controller they also report they are not ready via
+        Probe. The election uses etcd if
+        X_CSI_SERIAL_VOL_ACCESS_ETCD_ENDPOINTS is set, otherwise a file lock
+        in X_CSI_LEADER_ELECTION_FLOCK_DIR. Leader election is disabled when
+        X_CSI_MODE=node.
+
+    X_CSI_LEADER_ELECTION_NAME
+        The name of the election. Replicas of the same plug-in must use the
+        same name. The default value is the plug-in's name if
+        X_CSI_PLUGIN_INFO is set, otherwise the program's name.
+
+    X_CSI_LEADER_ELECTION_FLOCK_DIR
+        The directory in which the file lock used for leader election is
+        created when etcd is not configured.
+
+    X_CSI_LEADER_ELECTION_HANDOVER_TIMEOUT
+        How long a leader waits for in-flight Controller RPCs to complete
+        when stepping down. The default value is 5s.
+
     X_CSI_SERIAL_VOL_ACCESS
         A flag that enables the serial volume access middleware.
 
@@ -254,6 +410,11 @@ GLOBAL OPTIONS
     X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD
         The password used for authentication.
 
+    X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD_FILE
+        The path to a file that contains the password used for
+        authentication. May not be used with
+        X_CSI_SERIAL_VOL_ACCESS_ETCD_PASSWORD.
+
     X_CSI_SERIAL_VOL_ACCESS_ETCD_REJECT_OLD_CLUSTER
         A flag that indicates refusal to create a client against an outdated
         cluster.
@@ -265,5 +426,29 @@ GLOBAL OPTIONS
         A flag that indicates the TLS connection should not verify peer
         certificates.
 
+    X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CA
+        The path to a PEM-encoded CA bundle used to verify the server's
+        certificate. Setting this value enables TLS.
+
+    X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_CERT
+    X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_KEY
+        The paths to a PEM-encoded client certificate and its private
+        key. Both values must be set together. Setting them enables TLS.
+
+    X_CSI_SERIAL_VOL_ACCESS_ETCD_TLS_SERVER_NAME
+        The server name used to verify the server's certificate. Setting
+        this value enables TLS.
+
+    X_CSI_SERIAL_VOL_ACCESS_FLOCK_DIR
+        The directory in which lock files are created when using advisory
+        file locks for serial volume access. If this environment variable
+        is defined, and X_CSI_SERIAL_VOL_ACCESS_ETCD_ENDPOINTS is not, then
+        the serial volume access middleware uses file locks, providing
+        serial volume access between processes on the same host.
+
+    X_CSI_SERIAL_VOL_ACCESS_FLOCK_POLL_INTERVAL
+        How often an attempt is made to obtain a file lock held by another
+        process. The default value is 100ms.
+
 The flags -?,-h,-help may be used to print this screen.
 `
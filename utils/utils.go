@@ -546,7 +546,9 @@ func IsSuccess(err error, successCodes ...codes.Code) error {
 
 // AreVolumeCapabilitiesCompatible returns a flag indicating whether
 // the volume capability array "a" is compatible with "b". A true value
-// indicates that "a" and "b" are equivalent or "b" is a superset of "a".
+// indicates that each capability in "a" is compatible with a capability
+// in "b". Capabilities are compatible if their access types are equal
+// and their access modes are compatible per IsAccessModeCompatible.
 func AreVolumeCapabilitiesCompatible(
 	a, b []*csi.VolumeCapability) (bool, error) {
 
@@ -556,30 +558,72 @@ func AreVolumeCapabilitiesCompatible(
 			"requested capabilities exceed existing")
 	}
 
-	var i int
-
 	for _, va := range a {
+		var ok bool
 		for _, vb := range b {
-			if EqualVolumeCapability(va, vb) {
-				i++
+			if ok = isVolumeCapabilityCompatible(va, vb); ok {
+				break
 			}
 		}
+		if !ok {
+			return false, nil
+		}
 	}
 
-	return i >= len(a), nil
+	return true, nil
 }
 
 // IsVolumeCapabilityCompatible returns a flag indicating whether
 // the volume capability "a" is compatible with the set "b". A true value
-// indicates that "a" and "b" are equivalent or "b" is a superset of "a".
+// indicates that "a" is compatible with a capability in "b".
 func IsVolumeCapabilityCompatible(
 	a *csi.VolumeCapability, b []*csi.VolumeCapability) (bool, error) {
 
 	return AreVolumeCapabilitiesCompatible([]*csi.VolumeCapability{a}, b)
 }
 
+// IsAccessModeCompatible returns a flag indicating whether a volume that
+// supports the access mode "b" may be used with the access mode "a".
+//
+// Modes are compatible with themselves. Because plug-ins that support
+// SINGLE_NODE_SINGLE_WRITER or SINGLE_NODE_MULTI_WRITER must also accept
+// SINGLE_NODE_WRITER, SINGLE_NODE_WRITER is compatible with both modes.
+// SINGLE_NODE_SINGLE_WRITER, which permits a single writer only, is
+// compatible with SINGLE_NODE_WRITER and SINGLE_NODE_MULTI_WRITER. A
+// request for SINGLE_NODE_MULTI_WRITER requires SINGLE_NODE_MULTI_WRITER.
+func IsAccessModeCompatible(a, b csi.VolumeCapability_AccessMode_Mode) bool {
+	if a == b {
+		return true
+	}
+	switch a {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER:
+		return b == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER ||
+			b == csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER:
+		return b == csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER ||
+			b == csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER
+	}
+	return false
+}
+
+func isVolumeCapabilityCompatible(a, b *csi.VolumeCapability) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if (a.AccessMode == nil) != (b.AccessMode == nil) {
+		return false
+	}
+	if a.AccessMode != nil &&
+		!IsAccessModeCompatible(a.AccessMode.Mode, b.AccessMode.Mode) {
+		return false
+	}
+	return equalAccessType(a, b)
+}
+
 // EqualVolumeCapability returns a flag indicating if two csi.VolumeCapability
-// objects are equal. If a and b are both nil then false is returned.
+// objects are equal. If a and b are both nil then false is returned. Access
+// modes are equal only if they are the same mode; for example,
+// SINGLE_NODE_WRITER is not equal to SINGLE_NODE_MULTI_WRITER.
 func EqualVolumeCapability(a, b *csi.VolumeCapability) bool {
 	if a == nil || b == nil {
 		return false
@@ -597,6 +641,13 @@ func EqualVolumeCapability(a, b *csi.VolumeCapability) bool {
 		return false
 	}
 
+	return equalAccessType(a, b)
+}
+
+// equalAccessType returns a flag indicating if the access types of two
+// csi.VolumeCapability objects are equal.
+func equalAccessType(a, b *csi.VolumeCapability) bool {
+
 	// If both capabilities are block then return true.
 	if a.GetBlock() != nil && b.GetBlock() != nil {
 		return true
@@ -611,6 +662,11 @@ func EqualVolumeCapability(a, b *csi.VolumeCapability) bool {
 			return false
 		}
 
+		// If the volume mount groups differ then return false.
+		if aMount.VolumeMountGroup != bMount.VolumeMountGroup {
+			return false
+		}
+
 		// Compare the mount flags lengths.
 		if len(aMount.MountFlags) != len(bMount.MountFlags) {
 			return false
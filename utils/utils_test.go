@@ -410,6 +410,10 @@ var _ = Describe("EqualVolumeCapability", func() {
 		Ω(utils.EqualVolumeCapability(a, b)).Should(BeFalse())
 		bAT.Mount.MountFlags = nil
 		Ω(utils.EqualVolumeCapability(a, b)).Should(BeTrue())
+		aAT.Mount.VolumeMountGroup = "1000"
+		Ω(utils.EqualVolumeCapability(a, b)).Should(BeFalse())
+		bAT.Mount.VolumeMountGroup = "1000"
+		Ω(utils.EqualVolumeCapability(a, b)).Should(BeTrue())
 	})
 })
 
@@ -461,3 +465,38 @@ var _ = Describe("AreVolumeCapabilitiesCompatible", func() {
 		Ω(utils.AreVolumeCapabilitiesCompatible(a, b)).Should(BeTrue())
 	})
 })
+
+var _ = Describe("IsAccessModeCompatible", func() {
+	const (
+		snw  = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+		snro = csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+		snsw = csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+		snmw = csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER
+	)
+	It("compatible", func() {
+		Ω(utils.IsAccessModeCompatible(snmw, snmw)).Should(BeTrue())
+		Ω(utils.IsAccessModeCompatible(snw, snsw)).Should(BeTrue())
+		Ω(utils.IsAccessModeCompatible(snw, snmw)).Should(BeTrue())
+		Ω(utils.IsAccessModeCompatible(snsw, snw)).Should(BeTrue())
+		Ω(utils.IsAccessModeCompatible(snsw, snmw)).Should(BeTrue())
+	})
+	It("incompatible", func() {
+		Ω(utils.IsAccessModeCompatible(snmw, snw)).Should(BeFalse())
+		Ω(utils.IsAccessModeCompatible(snmw, snsw)).Should(BeFalse())
+		Ω(utils.IsAccessModeCompatible(snro, snmw)).Should(BeFalse())
+		Ω(utils.IsAccessModeCompatible(snsw, snro)).Should(BeFalse())
+	})
+	It("volume capabilities", func() {
+		a := []*csi.VolumeCapability{
+			utils.NewMountCapability(snsw, "ext4"),
+		}
+		b := []*csi.VolumeCapability{
+			utils.NewMountCapability(snmw, "ext4"),
+		}
+		Ω(utils.EqualVolumeCapability(a[0], b[0])).Should(BeFalse())
+		Ω(utils.AreVolumeCapabilitiesCompatible(a, b)).Should(BeTrue())
+		Ω(utils.AreVolumeCapabilitiesCompatible(b, a)).Should(BeFalse())
+		a[0] = utils.NewMountCapability(snsw, "xfs")
+		Ω(utils.AreVolumeCapabilitiesCompatible(a, b)).Should(BeFalse())
+	})
+})